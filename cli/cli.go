@@ -1,55 +1,90 @@
 package cli
 
 import (
-	"github.com/CanPacis/tstud-core/controllers"
-	"github.com/CanPacis/tstud-core/db"
+	"slices"
+	"strings"
+
+	"github.com/CanPacis/tstud-core/tstud"
 	"github.com/alecthomas/kong"
 )
 
-var FileController *controllers.FileController
-var TagController *controllers.TagController
-
-func init() {
-	dbs, err := db.Connect()
-	if err != nil {
-		panic(err)
-	}
-	FileController = controllers.NewFileController(dbs)
-	TagController = controllers.NewTagController(dbs)
-}
-
 /*
 tstud file index <filepath>
 tstud file index --dir <dirpath>
 tstud file unindex <filepath|dirpath>
+tstud file rehash [--all]
 tstud file rename <old path> <new path>
 tstud file tag <file id> <tag id>
 tstud file untag <file id> <tag id>
-tstud file meta set author <file id> <author>
-tstud file meta unset author <file id>
+tstud file meta set <file id> <key> <value>
+tstud file meta unset <file id> <key>
 tstud file list --page <page> --per-page <per page>
 tstud file search term --tags <tag name list>
+tstud file search [term] --where <field><op><value> --sort <field> [--desc]
 tstud file details <file id>
 
 tstud tag create <tag name>
 tstud tag delete <tag id>
 tstud tag alias <tag id> <alias name>
 tstud tag unalias <tag id> <alias id>
-tstud tag parent <tag id> <parent tag id>
+tstud tag parent <tag id> [parent tag id]
 tstud tag list --page <page> --per-page <per page> [--all | --parent <parent id>]
+tstud tag ancestors <tag id>
+tstud tag descendants <tag id>
 tstud tag search term
+
+tstud field create <name> <type> [--values <enum values>]
+tstud field delete <name>
+tstud field list
+
+tstud serve --library <name>=<db path>
+tstud serve --broker <unix:path|tcp:host:port>
+tstud serve --codec <text|lsp|ndjson>
+tstud serve --http <metrics address>
+
+tstud undo
+tstud redo
+
+tstud jobs ls [--state <state>]
+tstud jobs wait <job id>
+tstud jobs cancel <job id>
+
+tstud library create <name> [--path <db path>] [--use]
+tstud library list
+tstud library use <name>
+tstud library remove <name> [--delete]
+
+tstud db migrate status
+tstud db migrate up [--to <version>]
+tstud db migrate down [--to <version>]
+
+tstud --db <db path> ...
+tstud --lib <name> ...
+tstud --memory serve
+
+tstud gen ts -o <output path>
+
+tstud rpc call <path> [json] [--exec <command> | --connect <address>]
+tstud rpc tap [--listen <address>] [--exec <command> | --connect <address>]
 */
 
 type Context struct {
 	Debug bool
+	// Options selects the database, Library is opened from it.
+	Options tstud.Options
+	Library *tstud.Library
 }
 
 var cli struct {
-	Debug bool `help:"Enable debug mode."`
+	Debug    bool   `help:"Enable debug mode."`
+	Database string `name:"db" help:"Database to use, overrides $TSTUD_DB and the default library." type:"path" placeholder:"PATH"`
+	Memory   bool   `help:"Keep the library in memory, nothing is saved. Meant for demos with serve."`
+	Lib      string `short:"L" help:"Named library to use instead of the default one." placeholder:"NAME"`
 
 	File struct {
 		Index   FileIndexCmd   `cmd:"" help:"Index files and directories."`
 		Unindex FileUnindexCmd `cmd:"" help:"Unindex files and directories."`
+		Rehash  FileRehashCmd  `cmd:"" help:"Record size, modification time and hash of files indexed without them."`
 		Rename  FileRenameCmd  `cmd:"" help:"Change a file's path."`
 		Tag     FileTagCmd     `cmd:"" help:"Tag a file."`
 		Untag   FileUntagCmd   `cmd:"" help:"Untag a file."`
@@ -58,23 +93,85 @@ var cli struct {
 		List    FileListCmd    `cmd:"" help:"List indexed files."`
 
 		Meta struct {
-			Set   FileMetaSetCmd   `cmd:""`
-			Unset FileMetaUnsetCmd `cmd:""`
+			Set   FileMetaSetCmd   `cmd:"" help:"Set a meta field of a file."`
+			Unset FileMetaUnsetCmd `cmd:"" help:"Remove a meta field from a file."`
 		} `cmd:""`
 	} `cmd:"" help:"Work with files. Index, tag, list and search files."`
 
 	Tag struct {
-		Create  TagCreateCmd  `cmd:"" help:"Create a new tag."`
-		Delete  TagDeleteCmd  `cmd:"" help:"Delete existing tag."`
-		Alias   TagAliasCmd   `cmd:"" help:"Create an alias for a tag."`
-		Unalias TagUnaliasCmd `cmd:"" help:"Remove an alias from a tag."`
-		List    TagListCmd    `cmd:"" help:"List created tags."`
-		Search  TagSearchCmd  `cmd:"" help:"Search through created tags."`
+		Create      TagCreateCmd      `cmd:"" help:"Create a new tag."`
+		Delete      TagDeleteCmd      `cmd:"" help:"Delete existing tag."`
+		Alias       TagAliasCmd       `cmd:"" help:"Create an alias for a tag."`
+		Unalias     TagUnaliasCmd     `cmd:"" help:"Remove an alias from a tag."`
+		Parent      TagParentCmd      `cmd:"" help:"Move a tag under another tag or to the root."`
+		List        TagListCmd        `cmd:"" help:"List created tags."`
+		Ancestors   TagAncestorsCmd   `cmd:"" help:"List the tags above a tag, nearest first."`
+		Descendants TagDescendantsCmd `cmd:"" help:"List every tag below a tag."`
+		Search      TagSearchCmd      `cmd:"" help:"Search through created tags."`
 	} `cmd:"" help:"Work with tags. Create, delete and alias tags"`
+
+	Field struct {
+		Create FieldCreateCmd `cmd:"" help:"Define a typed custom meta field."`
+		Delete FieldDeleteCmd `cmd:"" help:"Delete a field and its value on every file."`
+		List   FieldListCmd   `cmd:"" help:"List custom meta fields."`
+	} `cmd:"" help:"Work with custom meta fields. Create, delete and list fields."`
+
+	Undo UndoCmd `cmd:"" help:"Reverse the last change to the library."`
+	Redo RedoCmd `cmd:"" help:"Reapply the last undone change."`
+
+	Jobs struct {
+		Ls     JobsLsCmd     `cmd:"" help:"List recent background jobs."`
+		Wait   JobsWaitCmd   `cmd:"" help:"Wait for a job to finish, running queued jobs when no other process does."`
+		Cancel JobsCancelCmd `cmd:"" help:"Cancel a queued or running job."`
+	} `cmd:"" help:"Inspect background jobs started through /jobs/start."`
+
+	Library struct {
+		Create LibraryCreateCmd `cmd:"" help:"Create a named library."`
+		List   LibraryListCmd   `cmd:"" help:"List named libraries, the default one is marked."`
+		Use    LibraryUseCmd    `cmd:"" help:"Make a named library the default."`
+		Remove LibraryRemoveCmd `cmd:"" help:"Forget a named library."`
+	} `cmd:"" help:"Manage named libraries kept in separate databases."`
+
+	DB struct {
+		Migrate struct {
+			Status DBMigrateStatusCmd `cmd:"" help:"List migrations and whether they were applied."`
+			Up     DBMigrateUpCmd     `cmd:"" help:"Apply pending migrations."`
+			Down   DBMigrateDownCmd   `cmd:"" help:"Revert applied migrations, the database is backed up first."`
+		} `cmd:"" help:"Manage schema migrations."`
+	} `cmd:"" name:"db" help:"Maintain the library database."`
+
+	Serve ServeCmd `cmd:"" help:"Serve one or more libraries over stdio."`
+
+	Gen struct {
+		Ts GenTsCmd `cmd:"" help:"Generate a typed typescript client for the stdio core."`
+	} `cmd:"" help:"Generate client code from the protocol routes."`
+
+	RPC struct {
+		Call RPCCallCmd `cmd:"" help:"Send a single request and print the response."`
+		Tap  RPCTapCmd  `cmd:"" help:"Relay frames between two peers and print every frame."`
+	} `cmd:"" name:"rpc" help:"Talk to a p2pjson peer directly."`
 }
 
 func Run() {
 	ctx := kong.Parse(&cli, kong.Name("tstud"))
-	err := ctx.Run(&Context{Debug: cli.Debug})
+
+	options := tstud.Options{Path: cli.Database, Library: cli.Lib, Memory: cli.Memory}
+
+	// Library commands only touch the config and db commands manage the
+	// schema themselves, gen and rpc talk to no library at all. None of them
+	// should open and migrate the library.
+	command := ctx.Command()
+	if slices.ContainsFunc([]string{"library ", "db ", "gen ", "rpc "}, func(prefix string) bool {
+		return strings.HasPrefix(command, prefix)
+	}) {
+		ctx.FatalIfErrorf(ctx.Run(&Context{Debug: cli.Debug, Options: options}))
+		return
+	}
+
+	lib, err := tstud.Open(options)
+	ctx.FatalIfErrorf(err)
+
+	err = ctx.Run(&Context{Debug: cli.Debug, Options: options, Library: lib})
+	lib.Close()
 	ctx.FatalIfErrorf(err)
 }
@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/lipgloss"
+)
+
+type FieldCreateCmd struct {
+	Values []string `short:"v" help:"Allowed values of an enum field."`
+
+	Name string `arg:"" name:"name" help:"Field name to create."`
+	Type string `arg:"" name:"type" help:"One of string, number, date, url, boolean or enum."`
+}
+
+func (c *FieldCreateCmd) Run(ctx *Context) error {
+	field, err := ctx.Library.Field.Create(c.Name, c.Type, c.Values)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Created %s field %s\n", field.Type, field.Name)
+	return nil
+}
+
+type FieldDeleteCmd struct {
+	Name string `arg:"" name:"name" help:"Field name to delete."`
+}
+
+func (c *FieldDeleteCmd) Run(ctx *Context) error {
+	field, err := ctx.Library.Field.Delete(c.Name)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Deleted field %s\n", field.Name)
+	return nil
+}
+
+type FieldListCmd struct{}
+
+func (c *FieldListCmd) Run(ctx *Context) error {
+	fields, err := ctx.Library.Field.List()
+	if err != nil {
+		return err
+	}
+
+	columns := []table.Column{
+		{Title: "ID", Width: 4},
+		{Title: "Name", Width: 24},
+		{Title: "Type", Width: 10},
+		{Title: "Values", Width: 40},
+	}
+
+	rows := []table.Row{}
+	for _, field := range fields {
+		values := "-"
+		if len(field.Values) > 0 {
+			values = strings.Join(field.Values, ", ")
+		}
+		rows = append(rows, table.Row{fmt.Sprintf("%d", field.ID), field.Name, field.Type, values})
+	}
+
+	t := table.New(
+		table.WithColumns(columns),
+		table.WithRows(rows),
+		table.WithFocused(false),
+		table.WithHeight(len(rows)+1),
+	)
+	s := table.DefaultStyles()
+	s.Header = s.Header.BorderStyle(lipgloss.NormalBorder()).BorderBottom(true)
+	s.Selected = s.Selected.Foreground(lipgloss.Color("f"))
+	t.SetStyles(s)
+	fmt.Println(t.View())
+	return nil
+}
@@ -1,10 +1,13 @@
 package cli
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 
 	"github.com/CanPacis/tstud-core/controllers"
 	"github.com/CanPacis/tstud-core/db"
@@ -14,21 +17,17 @@ import (
 	"gorm.io/gorm"
 )
 
-func fileDtoToRows(items []any) []table.Row {
+func fileDtoToRows(items []db.FileDTO) []table.Row {
 	result := []table.Row{}
 
-	for _, item := range items {
-		file, ok := item.(db.FileDTO)
-		if !ok {
-			continue
-		}
+	for _, file := range items {
 		result = append(result, table.Row{fmt.Sprintf("%d", file.ID), file.Name, file.MimeType, filepath.Dir(file.FilePath)})
 	}
 
 	return result
 }
 
-func printFileDtoTable(title string, resource controllers.PaginatedResource) {
+func printFileDtoTable(title string, resource controllers.PaginatedResource[db.FileDTO]) {
 	w, _, _ := term.GetSize(int(os.Stdout.Fd()))
 
 	columns := []table.Column{
@@ -79,6 +78,32 @@ func printFileDtoDetails(file db.FileDTO) {
 		fmt.Println(file.Description)
 	}
 
+	if len(file.Fields) > 0 {
+		names := slices.Sorted(maps.Keys(file.Fields))
+		for _, name := range names {
+			fmt.Print(faint.Render(fmt.Sprintf("%s: ", name)))
+			fmt.Println(file.Fields[name])
+		}
+	}
+
+	if file.ModTime != nil {
+		fmt.Print("\n")
+		fmt.Print(faint.Render("Size: "))
+		fmt.Printf("%d bytes\n", file.Size)
+		fmt.Print(faint.Render("Modified: "))
+		fmt.Println(file.ModTime.Format("2006-01-02 15:04:05"))
+		if file.Inode != 0 {
+			fmt.Print(faint.Render("Inode: "))
+			fmt.Printf("%d on device %d\n", file.Inode, file.Device)
+		}
+		fmt.Print(faint.Render("SHA-256: "))
+		if len(file.SHA256) > 0 {
+			fmt.Println(file.SHA256)
+		} else {
+			fmt.Println(faint.Render("not hashed"))
+		}
+	}
+
 	fmt.Print("\n")
 	fmt.Println("Tags")
 	box := lipgloss.NewStyle().BorderStyle(lipgloss.NormalBorder())
@@ -98,12 +123,14 @@ type FileIndexCmd struct {
 	Dir       bool     `short:"d" help:"Index a whole directory"`
 	Recursive bool     `short:"r" help:"Index the directory recursively"`
 	Exclude   []string `short:"e" help:"Exclude directory names"`
+	HashLimit int64    `help:"Do not hash files larger than this many MiB, 0 hashes every file." placeholder:"MIB"`
 
 	Path string `arg:"" name:"path" help:"Paths to index." type:"path"`
 }
 
 func (c *FileIndexCmd) Run(ctx *Context) error {
-	result, err := FileController.Index(c.Path, c.Recursive, c.Exclude)
+	ctx.Library.File.HashLimit = c.HashLimit << 20
+	result, err := ctx.Library.File.Index(c.Path, c.Recursive, c.Exclude)
 
 	if err != nil {
 		if errors.Is(err, gorm.ErrDuplicatedKey) {
@@ -126,7 +153,7 @@ type FileUnindexCmd struct {
 }
 
 func (c *FileUnindexCmd) Run(ctx *Context) error {
-	result, err := FileController.Unindex(c.Path, c.Recursive, c.Exclude)
+	result, err := ctx.Library.File.Unindex(c.Path, c.Recursive, c.Exclude)
 	if err != nil {
 		return err
 	}
@@ -136,13 +163,29 @@ func (c *FileUnindexCmd) Run(ctx *Context) error {
 	return nil
 }
 
+type FileRehashCmd struct {
+	All       bool  `short:"a" help:"Fingerprint every file again, not only the ones indexed without one."`
+	HashLimit int64 `help:"Do not hash files larger than this many MiB, 0 hashes every file." placeholder:"MIB"`
+}
+
+func (c *FileRehashCmd) Run(ctx *Context) error {
+	ctx.Library.File.HashLimit = c.HashLimit << 20
+	updated, err := ctx.Library.File.Rehash(context.Background(), c.All, nil)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Updated the fingerprint of %d files\n", updated)
+	return nil
+}
+
 type FileRenameCmd struct {
 	OldPath string `arg:"" type:"path"`
 	NewPath string `arg:"" type:"path"`
 }
 
 func (c *FileRenameCmd) Run(ctx *Context) error {
-	file, err := FileController.Rename(c.OldPath, c.NewPath)
+	file, err := ctx.Library.File.Rename(c.OldPath, c.NewPath)
 	if err != nil {
 		return err
 	}
@@ -157,7 +200,7 @@ type FileListCmd struct {
 }
 
 func (c *FileListCmd) Run(ctx *Context) error {
-	var result *controllers.PaginatedResource
+	var result *controllers.PaginatedResource[db.FileDTO]
 	page := c.Page - 1
 
 	if page < 0 {
@@ -169,7 +212,7 @@ func (c *FileListCmd) Run(ctx *Context) error {
 	}
 
 	var err error
-	result, err = FileController.List(controllers.ListOptions{
+	result, err = ctx.Library.File.List(controllers.ListOptions{
 		PerPage: c.PerPage,
 		Page:    page,
 	})
@@ -188,7 +231,7 @@ type FileTagCmd struct {
 }
 
 func (c *FileTagCmd) Run(ctx *Context) error {
-	file, tag, err := FileController.Tag(c.File, c.Tag)
+	file, tag, err := ctx.Library.File.Tag(c.File, c.Tag)
 	if err != nil {
 		return err
 	}
@@ -203,7 +246,7 @@ type FileUntagCmd struct {
 }
 
 func (c *FileUntagCmd) Run(ctx *Context) error {
-	file, tag, err := FileController.Untag(c.File, c.Tag)
+	file, tag, err := ctx.Library.File.Untag(c.File, c.Tag)
 	if err != nil {
 		return err
 	}
@@ -221,9 +264,9 @@ func (c *FileDetailsCmd) Run(ctx *Context) error {
 	var file *db.FileDTO
 	var err error
 	if c.ID != 0 {
-		file, err = FileController.FindByID(c.ID)
+		file, err = ctx.Library.File.FindByID(c.ID)
 	} else {
-		file, err = FileController.FindByPath(c.Path)
+		file, err = ctx.Library.File.FindByPath(c.Path)
 	}
 
 	if err != nil {
@@ -235,34 +278,13 @@ func (c *FileDetailsCmd) Run(ctx *Context) error {
 }
 
 type FileMetaSetCmd struct {
-	Author struct {
-		FileID uint   `arg:"" name:"file id" help:"File id to attach an author to."`
-		Value  string `arg:"" name:"author" help:"File author name."`
-	} `cmd:"" help:"Set the author meta field of a file."`
-	Description struct {
-		FileID uint   `arg:"" name:"file id" help:"File id to attach a description to."`
-		Value  string `arg:"" name:"description" help:"File description value."`
-	} `cmd:"" help:"Set the description meta field of a file."`
+	FileID uint   `arg:"" name:"file id" help:"File id to set the field on."`
+	Key    string `arg:"" name:"key" help:"author, description or a field created with tstud field create."`
+	Value  string `arg:"" name:"value" help:"Field value, checked against the field type."`
 }
 
 func (c *FileMetaSetCmd) Run(ctx *Context) error {
-	var fileId uint
-	if c.Author.FileID != 0 {
-		fileId = c.Author.FileID
-	} else if c.Description.FileID != 0 {
-		fileId = c.Description.FileID
-	}
-
-	meta := controllers.FileMetaData{}
-
-	if len(c.Author.Value) > 0 {
-		meta.Author = &c.Author.Value
-	}
-	if len(c.Description.Value) > 0 {
-		meta.Description = &c.Description.Value
-	}
-
-	file, err := FileController.SetMeta(fileId, meta)
+	file, err := ctx.Library.File.SetField(c.FileID, c.Key, c.Value)
 	if err != nil {
 		return err
 	}
@@ -272,28 +294,12 @@ func (c *FileMetaSetCmd) Run(ctx *Context) error {
 }
 
 type FileMetaUnsetCmd struct {
-	Author struct {
-		FileID uint `arg:"" name:"file id" help:"File id to remove the author from."`
-	} `cmd:"" help:"Remove the author meta field of a file."`
-	Description struct {
-		FileID uint `arg:"" name:"file id" help:"File id to remove the description from."`
-	} `cmd:"" help:"Remove the description meta field of a file."`
+	FileID uint   `arg:"" name:"file id" help:"File id to remove the field from."`
+	Key    string `arg:"" name:"key" help:"author, description or a custom field name."`
 }
 
 func (c *FileMetaUnsetCmd) Run(ctx *Context) error {
-	var fileId uint
-	meta := controllers.FileMetaData{}
-	empty := ""
-
-	if c.Author.FileID != 0 {
-		fileId = c.Author.FileID
-		meta.Author = &empty
-	} else if c.Description.FileID != 0 {
-		fileId = c.Description.FileID
-		meta.Description = &empty
-	}
-
-	file, err := FileController.SetMeta(fileId, meta)
+	file, err := ctx.Library.File.UnsetField(c.FileID, c.Key)
 	if err != nil {
 		return err
 	}
@@ -303,11 +309,14 @@ func (c *FileMetaUnsetCmd) Run(ctx *Context) error {
 }
 
 type FileSearchCmd struct {
-	Term string `arg:"" help:"Tags to search"`
+	Term string `arg:"" optional:"" help:"Tags to search"`
 
 	Tags        []string `cmd:"" short:"t" help:"Tags to search."`
 	Author      string   `cmd:"" short:"a" help:"Search author of a file."`
 	Description string   `cmd:"" short:"d" help:"Search description of a file."`
+	Where       []string `short:"w" help:"Filter by a custom field, author or description, e.g. rating>=4 or author~doe." placeholder:"FILTER"`
+	Sort        string   `short:"s" help:"Sort by a custom field, author or description." placeholder:"FIELD"`
+	Desc        bool     `help:"Sort in descending order."`
 }
 
 func (c *FileSearchCmd) Run(ctx *Context) error {
@@ -316,12 +325,15 @@ func (c *FileSearchCmd) Run(ctx *Context) error {
 		Tags:        c.Tags,
 		Author:      c.Author,
 		Description: c.Description,
+		Where:       c.Where,
+		Sort:        c.Sort,
+		Desc:        c.Desc,
 		ListOptions: controllers.ListOptions{
 			Page:    0,
 			PerPage: 10,
 		},
 	}
-	result, err := FileController.Search(options)
+	result, err := ctx.Library.File.Search(options)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"io"
+	"os"
+
+	"github.com/CanPacis/tstud-core/proto"
+	"github.com/CanPacis/tstud-core/tsgen"
+)
+
+type GenTsCmd struct {
+	Output string `short:"o" help:"File to write the client to. Defaults to stdout." type:"path"`
+}
+
+func (c *GenTsCmd) Run(ctx *Context) error {
+	routes := []tsgen.Route{}
+	for _, route := range proto.Routes {
+		routes = append(routes, tsgen.Route{
+			Path:     route.Path,
+			Request:  route.Request,
+			Response: route.Response,
+			Stream:   route.Stream,
+		})
+	}
+
+	var w io.Writer = os.Stdout
+	if len(c.Output) > 0 {
+		f, err := os.Create(c.Output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	return tsgen.Generate(w, routes)
+}
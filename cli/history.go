@@ -0,0 +1,29 @@
+package cli
+
+import (
+	"fmt"
+)
+
+type UndoCmd struct{}
+
+func (c *UndoCmd) Run(ctx *Context) error {
+	op, err := ctx.Library.History.Undo()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Undid: %s\n", op.Description)
+	return nil
+}
+
+type RedoCmd struct{}
+
+func (c *RedoCmd) Run(ctx *Context) error {
+	op, err := ctx.Library.History.Redo()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Redid: %s\n", op.Description)
+	return nil
+}
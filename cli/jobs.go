@@ -0,0 +1,139 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/CanPacis/tstud-core/db"
+	"github.com/CanPacis/tstud-core/jobs"
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/lipgloss"
+	"gorm.io/gorm"
+)
+
+func jobProgress(job db.JobDTO) string {
+	if job.Total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d/%d", job.Done, job.Total)
+}
+
+func printJobTable(items []db.JobDTO) {
+	columns := []table.Column{
+		{Title: "ID", Width: 4},
+		{Title: "Kind", Width: 12},
+		{Title: "State", Width: 10},
+		{Title: "Progress", Width: 14},
+		{Title: "Created", Width: 20},
+		{Title: "Error", Width: 32},
+	}
+
+	rows := []table.Row{}
+	for _, job := range items {
+		rows = append(rows, table.Row{
+			fmt.Sprintf("%d", job.ID),
+			job.Kind,
+			job.State,
+			jobProgress(job),
+			job.CreatedAt.Format("2006-01-02 15:04:05"),
+			job.Error,
+		})
+	}
+
+	t := table.New(
+		table.WithColumns(columns),
+		table.WithRows(rows),
+		table.WithFocused(false),
+		table.WithHeight(len(rows)+1),
+	)
+	s := table.DefaultStyles()
+	s.Header = s.Header.BorderStyle(lipgloss.NormalBorder()).BorderBottom(true)
+	s.Selected = s.Selected.Foreground(lipgloss.Color("f"))
+	t.SetStyles(s)
+	fmt.Println(t.View())
+}
+
+func jobNotFound(id uint, err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("job with id %d not found", id)
+	}
+	return err
+}
+
+type JobsLsCmd struct {
+	State string `short:"s" help:"Only list jobs in this state." enum:",queued,running,done,failed,canceled" default:""`
+	Limit int    `short:"n" help:"Number of recent jobs to list." default:"20"`
+}
+
+func (c *JobsLsCmd) Run(ctx *Context) error {
+	result, err := ctx.Library.Jobs.List(c.State, c.Limit)
+	if err != nil {
+		return err
+	}
+
+	printJobTable(result)
+	return nil
+}
+
+type JobsWaitCmd struct {
+	ID uint `arg:"" name:"id" help:"Job id to wait for."`
+}
+
+func (c *JobsWaitCmd) Run(ctx *Context) error {
+	signalCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// Without a serving process nothing would ever run the job, so this one
+	// takes part in running the queue while it waits. Closing the library
+	// queues whatever it did not finish again.
+	if err := ctx.Library.Jobs.Start(); err != nil {
+		return err
+	}
+
+	faint := lipgloss.NewStyle().Faint(true)
+	last := ""
+	job, err := ctx.Library.Jobs.Wait(signalCtx, c.ID, func(job *db.JobDTO) {
+		line := fmt.Sprintf("%s %s", job.State, jobProgress(*job))
+		if line != last {
+			fmt.Println(faint.Render(line))
+			last = line
+		}
+	})
+	if err != nil {
+		return jobNotFound(c.ID, err)
+	}
+
+	switch job.State {
+	case jobs.StateFailed:
+		return fmt.Errorf("job %d failed: %s", job.ID, job.Error)
+	case jobs.StateCanceled:
+		return fmt.Errorf("job %d was canceled", job.ID)
+	}
+
+	fmt.Printf("Job %d done\n", job.ID)
+	if len(job.Result) > 0 {
+		fmt.Println(string(job.Result))
+	}
+	return nil
+}
+
+type JobsCancelCmd struct {
+	ID uint `arg:"" name:"id" help:"Job id to cancel."`
+}
+
+func (c *JobsCancelCmd) Run(ctx *Context) error {
+	job, err := ctx.Library.Jobs.Cancel(c.ID)
+	if err != nil {
+		return jobNotFound(c.ID, err)
+	}
+
+	if job.State == jobs.StateCanceled {
+		fmt.Printf("Canceled job %d\n", job.ID)
+	} else {
+		fmt.Printf("Requested cancellation of job %d\n", job.ID)
+	}
+	return nil
+}
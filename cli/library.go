@@ -0,0 +1,135 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/CanPacis/tstud-core/tstud"
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/lipgloss"
+)
+
+type LibraryCreateCmd struct {
+	Name string `arg:"" help:"Name of the library."`
+	Path string `help:"Database path, defaults to the data directory." type:"path"`
+	Use  bool   `help:"Make it the default library."`
+}
+
+func (c *LibraryCreateCmd) Run(ctx *Context) error {
+	config, err := tstud.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	path, err := config.Create(c.Name, c.Path)
+	if err != nil {
+		return err
+	}
+	if c.Use {
+		config.Use(c.Name)
+	}
+
+	// Opening creates the database and its schema.
+	lib, err := tstud.Open(tstud.Options{Path: path})
+	if err != nil {
+		return err
+	}
+	lib.Close()
+
+	if err := config.Save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Created library %s at %s\n", c.Name, path)
+	return nil
+}
+
+type LibraryListCmd struct{}
+
+func (c *LibraryListCmd) Run(ctx *Context) error {
+	config, err := tstud.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	columns := []table.Column{
+		{Title: "", Width: 1},
+		{Title: "Name", Width: 16},
+		{Title: "Path", Width: 60},
+	}
+
+	rows := []table.Row{}
+	for _, name := range config.Names() {
+		mark := ""
+		if name == config.Default {
+			mark = "*"
+		}
+		rows = append(rows, table.Row{mark, name, config.Libraries[name]})
+	}
+
+	t := table.New(
+		table.WithColumns(columns),
+		table.WithRows(rows),
+		table.WithFocused(false),
+		table.WithHeight(len(rows)+1),
+	)
+	s := table.DefaultStyles()
+	s.Header = s.Header.BorderStyle(lipgloss.NormalBorder()).BorderBottom(true)
+	s.Selected = s.Selected.Foreground(lipgloss.Color("f"))
+	t.SetStyles(s)
+	fmt.Println(t.View())
+	return nil
+}
+
+type LibraryUseCmd struct {
+	Name string `arg:"" help:"Name of the library."`
+}
+
+func (c *LibraryUseCmd) Run(ctx *Context) error {
+	config, err := tstud.LoadConfig()
+	if err != nil {
+		return err
+	}
+	if err := config.Use(c.Name); err != nil {
+		return err
+	}
+	if err := config.Save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Using library %s\n", c.Name)
+	return nil
+}
+
+type LibraryRemoveCmd struct {
+	Name   string `arg:"" help:"Name of the library."`
+	Delete bool   `help:"Also delete the database file."`
+}
+
+func (c *LibraryRemoveCmd) Run(ctx *Context) error {
+	config, err := tstud.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	path, err := config.Remove(c.Name)
+	if err != nil {
+		return err
+	}
+	if err := config.Save(); err != nil {
+		return err
+	}
+
+	if c.Delete {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		fmt.Printf("Removed library %s and deleted %s\n", c.Name, path)
+		return nil
+	}
+
+	fmt.Printf("Removed library %s, its database is kept at %s\n", c.Name, path)
+	return nil
+}
@@ -0,0 +1,132 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/CanPacis/tstud-core/db"
+	"github.com/CanPacis/tstud-core/tstud"
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/lipgloss"
+	"gorm.io/gorm"
+)
+
+// openUnmigrated opens the selected database without applying migrations.
+func openUnmigrated(ctx *Context) (*gorm.DB, func(), error) {
+	path, err := tstud.ResolvePath(ctx.Options)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dbs, err := db.OpenUnmigrated(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return dbs, func() {
+		if sqlDB, err := dbs.DB(); err == nil {
+			sqlDB.Close()
+		}
+	}, nil
+}
+
+func printMigrations(verb string, ran []db.Migration, backup string) {
+	if len(backup) > 0 {
+		fmt.Printf("Backed up the database to %s\n", backup)
+	}
+	if len(ran) == 0 {
+		fmt.Println("Nothing to migrate")
+		return
+	}
+	for _, m := range ran {
+		fmt.Printf("%s %d %s\n", verb, m.Version, m.Name)
+	}
+}
+
+type DBMigrateStatusCmd struct{}
+
+func (c *DBMigrateStatusCmd) Run(ctx *Context) error {
+	dbs, close, err := openUnmigrated(ctx)
+	if err != nil {
+		return err
+	}
+	defer close()
+
+	status, err := db.Status(dbs)
+	if err != nil {
+		return err
+	}
+
+	columns := []table.Column{
+		{Title: "Version", Width: 8},
+		{Title: "Name", Width: 32},
+		{Title: "Destructive", Width: 12},
+		{Title: "Applied", Width: 20},
+	}
+
+	rows := []table.Row{}
+	for _, s := range status {
+		destructive := "-"
+		if s.Destructive {
+			destructive = "yes"
+		}
+		applied := "pending"
+		if s.Applied() {
+			applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		rows = append(rows, table.Row{fmt.Sprintf("%d", s.Version), s.Name, destructive, applied})
+	}
+
+	t := table.New(
+		table.WithColumns(columns),
+		table.WithRows(rows),
+		table.WithFocused(false),
+		table.WithHeight(len(rows)+1),
+	)
+	s := table.DefaultStyles()
+	s.Header = s.Header.BorderStyle(lipgloss.NormalBorder()).BorderBottom(true)
+	s.Selected = s.Selected.Foreground(lipgloss.Color("f"))
+	t.SetStyles(s)
+	fmt.Println(t.View())
+	return nil
+}
+
+type DBMigrateUpCmd struct {
+	To int `help:"Stop after this version instead of applying every pending migration." placeholder:"VERSION"`
+}
+
+func (c *DBMigrateUpCmd) Run(ctx *Context) error {
+	dbs, close, err := openUnmigrated(ctx)
+	if err != nil {
+		return err
+	}
+	defer close()
+
+	ran, backup, err := db.Up(dbs, c.To)
+	printMigrations("Applied", ran, backup)
+	return err
+}
+
+type DBMigrateDownCmd struct {
+	To int `help:"Revert every migration above this version, only the latest one by default." placeholder:"VERSION" default:"-1"`
+}
+
+func (c *DBMigrateDownCmd) Run(ctx *Context) error {
+	dbs, close, err := openUnmigrated(ctx)
+	if err != nil {
+		return err
+	}
+	defer close()
+
+	target := c.To
+	if target < 0 {
+		version, err := db.Version(dbs)
+		if err != nil {
+			return err
+		}
+		target = version - 1
+	}
+
+	ran, backup, err := db.Down(dbs, max(target, 0))
+	printMigrations("Reverted", ran, backup)
+	return err
+}
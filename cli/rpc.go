@@ -0,0 +1,384 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/CanPacis/tstud-core/p2pjson"
+	"github.com/charmbracelet/lipgloss"
+)
+
+type RPCTarget struct {
+	Exec    string `short:"e" help:"Spawn this command and talk to it over its stdio, arguments are quoted like in a shell. Defaults to this tstud binary serving with --codec." placeholder:"CMD"`
+	Connect string `short:"c" help:"Connect to a unix:<path> or tcp:<host:port> address instead of spawning a process." placeholder:"ADDR"`
+	Codec   string `help:"Wire format to speak." enum:"text,lsp,ndjson" default:"text"`
+}
+
+// splitCommand splits a command line into arguments the way a POSIX shell
+// does for quoting, e.g. `tstud serve --library "work=my docs/work.db"`.
+// Expansions and operators are not supported.
+func splitCommand(command string) ([]string, error) {
+	args := []string{}
+	arg := strings.Builder{}
+	inArg := false
+	var quote rune
+	escaped := false
+
+	for _, r := range command {
+		switch {
+		case escaped:
+			// Inside double quotes a backslash only escapes a few characters.
+			if quote == '"' && !strings.ContainsRune(`"\$`+"`", r) {
+				arg.WriteRune('\\')
+			}
+			arg.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if escaped || quote != 0 {
+		return nil, fmt.Errorf("unterminated quote or escape in %q", command)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// startCommand spawns command, or this binary serving with codec when the
+// command is empty.
+func startCommand(command, codec string) (*p2pjson.CommandConn, error) {
+	args, err := splitCommand(command)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		self, err := os.Executable()
+		if err != nil {
+			return nil, err
+		}
+		args = []string{self, "serve", "--codec", codec}
+	}
+
+	return p2pjson.StartCommand(context.Background(), os.Stderr, args[0], args[1:]...)
+}
+
+func (t *RPCTarget) dial() (io.ReadWriteCloser, p2pjson.CodecFactory, error) {
+	codec, err := p2pjson.CodecByName(t.Codec)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(t.Connect) > 0 {
+		conn, err := p2pjson.DialConn(t.Connect)
+		if err != nil {
+			return nil, nil, err
+		}
+		return conn, codec, nil
+	}
+
+	conn, err := startCommand(t.Exec, t.Codec)
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, codec, nil
+}
+
+type RPCCallCmd struct {
+	RPCTarget `embed:""`
+
+	Host    string `short:"H" help:"Url host to address, e.g. a library or broker peer name." default:"tstud"`
+	Headers bool   `short:"i" help:"Print response headers."`
+	Stream  bool   `short:"s" help:"Print every partial content frame of a streaming route."`
+
+	Path string `arg:"" help:"Route path, e.g. /tag/list."`
+	Body string `arg:"" optional:"" help:"JSON request body." default:"{}"`
+}
+
+func (c *RPCCallCmd) Run(ctx *Context) error {
+	if !json.Valid([]byte(c.Body)) {
+		return errors.New("request body is not valid json")
+	}
+
+	conn, codec, err := c.dial()
+	if err != nil {
+		return err
+	}
+	peer := p2pjson.NewWithCodec(conn, codec)
+	go peer.Listen(p2pjson.NewMux())
+	defer peer.Close()
+
+	url := fmt.Sprintf("%s://%s/%s", p2pjson.P2PJSONScheme, c.Host, strings.TrimPrefix(c.Path, "/"))
+	req := p2pjson.NewRequest(url, bytes.NewBufferString(c.Body))
+
+	if !c.Stream {
+		resp, err := peer.Request(req)
+		if err != nil {
+			return err
+		}
+		printResponse(os.Stdout, resp, c.Headers)
+		return nil
+	}
+
+	for resp, err := range peer.Stream(req) {
+		if err != nil {
+			return err
+		}
+		printResponse(os.Stdout, resp, c.Headers)
+	}
+	return nil
+}
+
+type RPCTapCmd struct {
+	RPCTarget `embed:""`
+
+	Listen string `short:"l" help:"Accept the upstream peer on a unix:<path> or tcp:<host:port> address instead of stdio." placeholder:"ADDR"`
+}
+
+func (c *RPCTapCmd) Run(ctx *Context) error {
+	var upstream io.ReadWriteCloser = p2pjson.NewStdIOPeer()
+	if len(c.Listen) > 0 {
+		l, err := p2pjson.Listen(c.Listen)
+		if err != nil {
+			return err
+		}
+		conn, err := l.Accept()
+		l.Close()
+		if err != nil {
+			return err
+		}
+		upstream = conn
+	}
+
+	downstream, codec, err := c.dial()
+	if err != nil {
+		return err
+	}
+
+	up := &tapCodec{Codec: codec(upstream)}
+	down := &tapCodec{Codec: codec(downstream)}
+
+	done := make(chan error, 2)
+	go func() { done <- tap(up, down, "→") }()
+	go func() { done <- tap(down, up, "←") }()
+
+	err = <-done
+	upstream.Close()
+	downstream.Close()
+	return err
+}
+
+// tapCodec serializes writes, both directions of a tap may write to the
+// same side.
+type tapCodec struct {
+	p2pjson.Codec
+	mu sync.Mutex
+}
+
+func (c *tapCodec) WriteFrame(f *p2pjson.Frame) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Codec.WriteFrame(f)
+}
+
+// tap copies frames from src to dst and prints each one to stderr. Malformed
+// frames are answered on src with an error response, the way a peer would,
+// and are not passed on.
+func tap(src, dst p2pjson.Codec, arrow string) error {
+	for {
+		f, err := src.ReadFrame()
+		if err != nil {
+			var ferr *p2pjson.FrameError
+			if errors.As(err, &ferr) {
+				fmt.Fprintln(os.Stderr, stderrStyle.Foreground(lipgloss.Color("1")).Render(fmt.Sprintf("%s %s", arrow, ferr)))
+				if err := replyMalformed(src, ferr, arrow); err != nil {
+					return err
+				}
+				continue
+			}
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		printFrame(os.Stderr, f, arrow)
+		if err := dst.WriteFrame(f); err != nil {
+			return err
+		}
+		if f.Type == p2pjson.ExitMessageType {
+			return nil
+		}
+	}
+}
+
+// replyMalformed answers a malformed frame read from src like Peer.Listen
+// does. Broken responses are not answered, that could bounce errors between
+// the peers forever.
+func replyMalformed(src p2pjson.Codec, ferr *p2pjson.FrameError, arrow string) error {
+	if ferr.Type == p2pjson.ResponseMessageType {
+		return nil
+	}
+
+	resp := p2pjson.ErrorResponse(nil, p2pjson.StatusBadRequest, ferr)
+	resp.Identifier = ferr.Identifier
+	f := &p2pjson.Frame{Type: p2pjson.ResponseMessageType, Response: resp}
+
+	back := "←"
+	if arrow == "←" {
+		back = "→"
+	}
+	printFrame(os.Stderr, f, back)
+	return src.WriteFrame(f)
+}
+
+var stderrStyle = lipgloss.NewRenderer(os.Stderr).NewStyle()
+
+func printFrame(w io.Writer, f *p2pjson.Frame, arrow string) {
+	faint := stderrStyle.Faint(true)
+	bold := stderrStyle.Bold(true)
+
+	switch f.Type {
+	case p2pjson.RequestMessageType:
+		r := f.Request
+		fmt.Fprintf(w, "%s %s %s %s\n", arrow, bold.Render(f.Type), faint.Render(fmt.Sprintf("#%d", r.Identifier)), r.URL)
+		printHeaders(w, r.Header, faint)
+		r.Body = printBody(w, r.Body, stderrStyle)
+	case p2pjson.ResponseMessageType:
+		r := f.Response
+		fmt.Fprintf(w, "%s %s %s %s\n", arrow, bold.Render(f.Type), faint.Render(fmt.Sprintf("#%d", r.Identifier)), statusStyle(stderrStyle, r.StatusCode).Render(fmt.Sprintf("%d %s", r.StatusCode, r.Status)))
+		printHeaders(w, r.Header, faint)
+		r.Body = printBody(w, r.Body, stderrStyle)
+	default:
+		fmt.Fprintf(w, "%s %s\n", arrow, bold.Render(f.Type))
+	}
+	fmt.Fprintln(w)
+}
+
+func printResponse(w io.Writer, r *p2pjson.Response, headers bool) {
+	style := lipgloss.NewStyle()
+	fmt.Fprintln(w, statusStyle(style, r.StatusCode).Render(fmt.Sprintf("%d %s", r.StatusCode, r.Status)))
+	if headers {
+		printHeaders(w, r.Header, style.Faint(true))
+	}
+	printBody(w, r.Body, style)
+}
+
+func statusStyle(style lipgloss.Style, code int) lipgloss.Style {
+	switch {
+	case code >= 400:
+		return style.Bold(true).Foreground(lipgloss.Color("1"))
+	case code >= 300:
+		return style.Bold(true).Foreground(lipgloss.Color("3"))
+	default:
+		return style.Bold(true).Foreground(lipgloss.Color("2"))
+	}
+}
+
+func printHeaders(w io.Writer, header map[string][]string, style lipgloss.Style) {
+	keys := []string{}
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		fmt.Fprintln(w, style.Render(fmt.Sprintf("%s: %s", key, strings.Join(header[key], " "))))
+	}
+}
+
+// printBody prints a body and returns a reader with the same contents.
+func printBody(w io.Writer, body io.Reader, style lipgloss.Style) io.Reader {
+	if body == nil {
+		return nil
+	}
+
+	raw, err := io.ReadAll(body)
+	if err != nil || len(raw) == 0 {
+		return bytes.NewReader(raw)
+	}
+
+	indented := bytes.NewBuffer([]byte{})
+	if err := json.Indent(indented, raw, "", "  "); err != nil {
+		fmt.Fprintln(w, style.Faint(true).Render(fmt.Sprintf("<%d bytes>", len(raw))))
+	} else {
+		fmt.Fprintln(w, colorJSON(indented.String(), style))
+	}
+	return bytes.NewReader(raw)
+}
+
+func colorJSON(src string, style lipgloss.Style) string {
+	key := style.Foreground(lipgloss.Color("4"))
+	str := style.Foreground(lipgloss.Color("2"))
+	num := style.Foreground(lipgloss.Color("6"))
+	lit := style.Foreground(lipgloss.Color("5"))
+
+	out := strings.Builder{}
+	for i := 0; i < len(src); {
+		switch ch := src[i]; {
+		case ch == '"':
+			end := i + 1
+			for end < len(src) && src[end] != '"' {
+				if src[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end = min(end+1, len(src))
+
+			token := src[i:end]
+			if end < len(src) && src[end] == ':' {
+				out.WriteString(key.Render(token))
+			} else {
+				out.WriteString(str.Render(token))
+			}
+			i = end
+		case ch == '-' || (ch >= '0' && ch <= '9'):
+			end := i
+			for end < len(src) && strings.ContainsRune("-+.eE0123456789", rune(src[end])) {
+				end++
+			}
+			out.WriteString(num.Render(src[i:end]))
+			i = end
+		case strings.HasPrefix(src[i:], "true"), strings.HasPrefix(src[i:], "null"):
+			out.WriteString(lit.Render(src[i : i+4]))
+			i += 4
+		case strings.HasPrefix(src[i:], "false"):
+			out.WriteString(lit.Render(src[i : i+5]))
+			i += 5
+		default:
+			out.WriteByte(ch)
+			i++
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/CanPacis/tstud-core/metrics"
+	"github.com/CanPacis/tstud-core/p2pjson"
+	"github.com/CanPacis/tstud-core/proto"
+	"github.com/CanPacis/tstud-core/tstud"
+)
+
+type ServeCmd struct {
+	Library []string `short:"l" help:"Serve an additional library, reachable at p2pjson://<name>/... A bare name opens a library from tstud library create." sep:"none" placeholder:"NAME[=DBPATH]"`
+	Broker  string   `short:"b" help:"Relay requests between peers connected to this address (unix:<path> or tcp:<host:port>)." placeholder:"ADDR"`
+	Codec   string   `short:"c" help:"Wire format to speak." enum:"text,lsp,ndjson" default:"text"`
+	HTTP    string   `help:"Serve prometheus metrics at /metrics on this http address." placeholder:"ADDR"`
+
+	HashLimit int64 `help:"Do not hash indexed files larger than this many MiB, 0 hashes every file." placeholder:"MIB"`
+}
+
+func serveMetrics(addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		metrics.Default.WritePrometheus(w)
+	})
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	go http.Serve(l, mux)
+	return nil
+}
+
+// drainJobs keeps running background jobs after the frontend went away, until
+// every queue is empty. An interrupt stops right away, unfinished jobs then
+// start over with the next runner.
+func drainJobs(libs []*tstud.Library) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	for _, lib := range libs {
+		lib.Jobs.Drain(ctx)
+	}
+}
+
+func (c *ServeCmd) Run(ctx *Context) error {
+	codec, err := p2pjson.CodecByName(c.Codec)
+	if err != nil {
+		return err
+	}
+
+	ctx.Library.File.HashLimit = c.HashLimit << 20
+	if err := ctx.Library.Jobs.Start(); err != nil {
+		return err
+	}
+	registry := proto.NewRegistry(&proto.Library{Name: proto.DefaultLibrary, Library: ctx.Library})
+	libs := []*tstud.Library{ctx.Library}
+
+	for _, spec := range c.Library {
+		name, path, _ := strings.Cut(spec, "=")
+		options := tstud.Options{Path: path, HashLimit: c.HashLimit << 20}
+		if len(path) == 0 {
+			options.Library = name
+		}
+
+		lib, err := tstud.Open(options)
+		if err != nil {
+			return fmt.Errorf("could not open library %s: %w", name, err)
+		}
+		defer lib.Close()
+		if err := lib.Jobs.Start(); err != nil {
+			return err
+		}
+
+		registry.Register(&proto.Library{Name: name, Library: lib})
+		libs = append(libs, lib)
+	}
+
+	if len(c.HTTP) > 0 {
+		if err := serveMetrics(c.HTTP); err != nil {
+			return err
+		}
+	}
+
+	stdio := p2pjson.NewWithCodec(p2pjson.NewStdIOPeer(), codec)
+	if len(c.Broker) == 0 {
+		proto.Serve(registry, stdio)
+		drainJobs(libs)
+		return nil
+	}
+
+	l, err := p2pjson.Listen(c.Broker)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	broker := p2pjson.NewBroker(proto.NewHandler(registry))
+	broker.Codec = codec
+	broker.Reserved = registry.Serves
+	broker.Limiter = proto.NewLimiter()
+	go broker.Serve(l)
+
+	broker.ServePeer(stdio)
+	drainJobs(libs)
+	return nil
+}
@@ -25,7 +25,7 @@ func (c *TagCreateCmd) Run(ctx *Context) error {
 		parent = &c.Parent
 	}
 
-	tag, err := TagController.Create(c.Name, parent)
+	tag, err := ctx.Library.Tag.Create(c.Name, parent)
 	fmt.Printf("Created tag %s\n", tag.Name)
 	return err
 }
@@ -35,7 +35,7 @@ type TagDeleteCmd struct {
 }
 
 func (c *TagDeleteCmd) Run(ctx *Context) error {
-	tag, err := TagController.Delete(c.ID)
+	tag, err := ctx.Library.Tag.Delete(c.ID)
 
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return fmt.Errorf("tag with id %d not found", c.ID)
@@ -51,7 +51,7 @@ type TagAliasCmd struct {
 }
 
 func (c *TagAliasCmd) Run(ctx *Context) error {
-	return TagController.Alias(c.Tag, c.Alias)
+	return ctx.Library.Tag.Alias(c.Tag, c.Alias)
 }
 
 type TagUnaliasCmd struct {
@@ -60,17 +60,40 @@ type TagUnaliasCmd struct {
 }
 
 func (c *TagUnaliasCmd) Run(ctx *Context) error {
-	return TagController.Unlias(c.Tag, c.Alias)
+	return ctx.Library.Tag.Unlias(c.Tag, c.Alias)
 }
 
-func tagDtoToRows(items []any) []table.Row {
-	result := []table.Row{}
+type TagParentCmd struct {
+	Tag    uint `arg:"" name:"tag id" help:"Tag id to move."`
+	Parent uint `arg:"" optional:"" name:"parent tag id" help:"New parent tag id. Leave empty to move the tag to the root."`
+}
+
+func (c *TagParentCmd) Run(ctx *Context) error {
+	var parent *uint
+	if c.Parent != 0 {
+		parent = &c.Parent
+	}
 
-	for _, item := range items {
-		tag, ok := item.(db.TagDTO)
-		if !ok {
-			continue
+	tag, err := ctx.Library.Tag.SetParent(c.Tag, parent)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("tag not found")
 		}
+		return err
+	}
+
+	if tag.Parent == nil {
+		fmt.Printf("Moved tag %s to the root\n", tag.Name)
+	} else {
+		fmt.Printf("Moved tag %s under %s\n", tag.Name, tag.Parent.Name)
+	}
+	return nil
+}
+
+func tagDtoToRows(items []db.TagDTO) []table.Row {
+	result := []table.Row{}
+
+	for _, tag := range items {
 		aliases := []string{}
 		for _, alias := range tag.Aliases {
 			aliases = append(aliases, alias.Name)
@@ -91,7 +114,7 @@ func tagDtoToRows(items []any) []table.Row {
 	return result
 }
 
-func printTagDtoTable(result controllers.PaginatedResource) {
+func printTagDtoTable(result controllers.PaginatedResource[db.TagDTO]) {
 	columns := []table.Column{
 		{Title: "ID", Width: 4},
 		{Title: "Parent ID", Width: 12},
@@ -120,7 +143,7 @@ type TagListCmd struct {
 }
 
 func (c *TagListCmd) Run(ctx *Context) error {
-	var result *controllers.PaginatedResource
+	var result *controllers.PaginatedResource[db.TagDTO]
 	var err error
 	var parent *int
 
@@ -132,8 +155,36 @@ func (c *TagListCmd) Run(ctx *Context) error {
 			parent = &c.Parent
 		}
 	}
-	result, err = TagController.List(parent)
+	result, err = ctx.Library.Tag.List(parent)
+
+	if err != nil {
+		return err
+	}
+
+	printTagDtoTable(*result)
+	return nil
+}
+
+type TagAncestorsCmd struct {
+	Tag uint `arg:"" name:"tag id" help:"Tag id to list the ancestors of."`
+}
+
+func (c *TagAncestorsCmd) Run(ctx *Context) error {
+	result, err := ctx.Library.Tag.Ancestors(c.Tag)
+	if err != nil {
+		return err
+	}
+
+	printTagDtoTable(*result)
+	return nil
+}
+
+type TagDescendantsCmd struct {
+	Tag uint `arg:"" name:"tag id" help:"Tag id to list the descendants of."`
+}
 
+func (c *TagDescendantsCmd) Run(ctx *Context) error {
+	result, err := ctx.Library.Tag.Descendants(c.Tag)
 	if err != nil {
 		return err
 	}
@@ -147,7 +198,7 @@ type TagSearchCmd struct {
 }
 
 func (c *TagSearchCmd) Run(ctx *Context) error {
-	result, err := TagController.Search(c.Term, controllers.ListOptions{
+	result, err := ctx.Library.Tag.Search(c.Term, controllers.ListOptions{
 		Page:    0,
 		PerPage: 12,
 	})
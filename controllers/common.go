@@ -1,14 +1,40 @@
 package controllers
 
+import (
+	"iter"
+	"math"
+)
+
+// walkPageSize is the page size eachPage walks with when no page is given.
+const walkPageSize = 100
+
+// defaultPerPage is the page size of List and Search calls without one.
+const defaultPerPage = 10
+
 type ListOptions struct {
 	Page    int
 	PerPage int
 }
 
-type PaginatedResource struct {
-	Items      []any `json:"items"`
-	Page       int   `json:"page"`
-	TotalPages int   `json:"total_pages"`
+// paged returns options with a page size, a page outside the first one
+// starts at it.
+func (o ListOptions) paged() ListOptions {
+	if o.PerPage <= 0 {
+		o.PerPage = defaultPerPage
+	}
+	o.Page = max(0, o.Page)
+	return o
+}
+
+// pageCount is the number of pages count items fill, at least one.
+func pageCount(count int64, perPage int) int {
+	return max(1, int(math.Ceil(float64(count)/float64(perPage))))
+}
+
+type PaginatedResource[T any] struct {
+	Items      []T `json:"items"`
+	Page       int `json:"page"`
+	TotalPages int `json:"total_pages"`
 }
 
 type SearchOptions struct {
@@ -17,4 +43,43 @@ type SearchOptions struct {
 	Tags        []string
 	Author      string
 	Description string
+	// Where filters by custom fields, author and description, like rating>=4
+	// or status=done.
+	Where []string
+	// Sort orders by a custom field, author or description, in descending
+	// order when Desc is set.
+	Sort string
+	Desc bool
+}
+
+// eachPage yields the items of the page options selects. Without PerPage it
+// walks every page until one comes back empty, keeping a single page in
+// memory at a time.
+func eachPage[T any](options ListOptions, fetch func(ListOptions) (*PaginatedResource[T], error)) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		walk := options.PerPage == 0
+		if walk {
+			options = ListOptions{Page: 0, PerPage: walkPageSize}
+		}
+
+		for {
+			result, err := fetch(options)
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+
+			for _, item := range result.Items {
+				if !yield(item, nil) {
+					return
+				}
+			}
+
+			if !walk || len(result.Items) == 0 {
+				return
+			}
+			options.Page++
+		}
+	}
 }
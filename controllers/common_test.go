@@ -0,0 +1,71 @@
+package controllers_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/CanPacis/tstud-core/controllers"
+	"github.com/CanPacis/tstud-core/db"
+	"github.com/CanPacis/tstud-core/store"
+)
+
+func newFileController(t *testing.T, count int) *controllers.FileController {
+	m := store.NewMemory()
+	files := []db.File{}
+	for i := range count {
+		files = append(files, db.File{FilePath: fmt.Sprintf("/files/%d.txt", i)})
+	}
+	if err := m.Files.Create(files); err != nil {
+		t.Fatal(err)
+	}
+	return &controllers.FileController{Files: m.Files, Tags: m.Tags, Fields: m.Fields}
+}
+
+func TestPages(t *testing.T) {
+	c := newFileController(t, 20)
+
+	cases := []struct {
+		options controllers.ListOptions
+		items   int
+		pages   int
+	}{
+		{controllers.ListOptions{}, 10, 2},
+		{controllers.ListOptions{PerPage: -1, Page: -1}, 10, 2},
+		{controllers.ListOptions{PerPage: 5, Page: 1}, 5, 4},
+		{controllers.ListOptions{PerPage: 20}, 20, 1},
+		{controllers.ListOptions{PerPage: 7, Page: 2}, 6, 3},
+	}
+	for _, tc := range cases {
+		result, err := c.List(tc.options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Items) != tc.items || result.TotalPages != tc.pages {
+			t.Errorf("list %+v: got %d items on %d pages, expected %d on %d", tc.options, len(result.Items), result.TotalPages, tc.items, tc.pages)
+		}
+	}
+
+	search := []controllers.SearchOptions{
+		{Term: "3.txt"},
+		{Term: "3.txt", Sort: "author"},
+		{ListOptions: controllers.ListOptions{PerPage: 1}, Term: "3.txt"},
+	}
+	for _, options := range search {
+		result, err := c.Search(options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.TotalPages != 1 {
+			t.Errorf("search %+v: got %d pages, expected 1", options, result.TotalPages)
+		}
+	}
+
+	empty := newFileController(t, 0)
+	result, err := empty.List(controllers.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.TotalPages != 1 {
+		t.Errorf("empty list: got %d pages, expected 1", result.TotalPages)
+	}
+}
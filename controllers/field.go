@@ -0,0 +1,248 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CanPacis/tstud-core/db"
+	"github.com/CanPacis/tstud-core/events"
+	"github.com/CanPacis/tstud-core/store"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUnknownField      = errors.New("unknown field")
+	ErrInvalidField      = errors.New("invalid field")
+	ErrInvalidFieldValue = errors.New("invalid field value")
+	ErrInvalidFilter     = errors.New("invalid filter")
+)
+
+var FieldTypes = []string{db.FieldString, db.FieldNumber, db.FieldDate, db.FieldURL, db.FieldBoolean, db.FieldEnum}
+
+type FieldController struct {
+	Fields FieldRepository
+	// Journal records changes for undo, it may be nil.
+	Journal Journal
+	// Events receives an event after every committed change, it may be nil.
+	Events *events.Bus
+}
+
+func NewFieldController(dbs *gorm.DB) *FieldController {
+	return &FieldController{Fields: store.NewGormFields(dbs), Journal: NewJournal(dbs)}
+}
+
+// Create defines a custom field. Values lists the choices of an enum field
+// and must be empty for other types.
+func (c *FieldController) Create(name, fieldType string, values []string) (*db.FieldDTO, error) {
+	if len(name) == 0 || strings.ContainsAny(name, "=!<>~ ") {
+		return nil, fmt.Errorf("%w: %q is not a valid field name", ErrInvalidField, name)
+	}
+	if slices.Contains(db.BuiltinFields, name) {
+		return nil, fmt.Errorf("%w: %s is a built-in field", ErrInvalidField, name)
+	}
+	if !slices.Contains(FieldTypes, fieldType) {
+		return nil, fmt.Errorf("%w: unknown type %q", ErrInvalidField, fieldType)
+	}
+	if fieldType == db.FieldEnum && len(values) == 0 {
+		return nil, fmt.Errorf("%w: enum fields need values", ErrInvalidField)
+	}
+	if fieldType != db.FieldEnum && len(values) > 0 {
+		return nil, fmt.Errorf("%w: only enum fields have values", ErrInvalidField)
+	}
+
+	field := db.Field{Name: name, Type: fieldType}
+	if len(values) > 0 {
+		encoded, err := json.Marshal(values)
+		if err != nil {
+			return nil, err
+		}
+		field.Values = encoded
+	}
+
+	if err := c.Fields.Create(&field); err != nil {
+		return nil, err
+	}
+
+	record(c.Journal, opFieldCreate, fmt.Sprintf("create field %s", field.Name), newFieldOp(&field, nil))
+	c.Events.Publish(events.FieldCreated{Field: *field.ToDTO()})
+	return field.ToDTO(), nil
+}
+
+func (c *FieldController) List() ([]db.FieldDTO, error) {
+	fields, err := c.Fields.List()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []db.FieldDTO{}
+	for _, field := range fields {
+		result = append(result, *field.ToDTO())
+	}
+	return result, nil
+}
+
+// Delete removes a field and its value on every file. Undoing it brings the
+// values back.
+func (c *FieldController) Delete(name string) (*db.FieldDTO, error) {
+	field, err := lookupField(c.Fields, name)
+	if err != nil {
+		return nil, err
+	}
+	values, err := c.Fields.Values(field.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.Fields.Delete(field.ID); err != nil {
+		return nil, err
+	}
+
+	record(c.Journal, opFieldDelete, fmt.Sprintf("delete field %s", field.Name), newFieldOp(field, values))
+	c.Events.Publish(events.FieldDeleted{Field: *field.ToDTO()})
+	return field.ToDTO(), nil
+}
+
+func lookupField(fields FieldRepository, name string) (*db.Field, error) {
+	field, err := fields.GetByName(name)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w %q", ErrUnknownField, name)
+	}
+	return field, err
+}
+
+// parseFieldValue validates raw against the type of field and converts it to
+// its canonical form.
+func parseFieldValue(field db.Field, raw string) (db.FileField, error) {
+	value := db.FileField{FieldID: field.ID, Field: field, Value: raw}
+	invalid := func(reason string) error {
+		return fmt.Errorf("%w: %s %s", ErrInvalidFieldValue, field.Name, reason)
+	}
+
+	switch field.Type {
+	case db.FieldString:
+	case db.FieldNumber:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+			return value, invalid("must be a number")
+		}
+		value.Value = strconv.FormatFloat(n, 'f', -1, 64)
+		value.Number = &n
+	case db.FieldDate:
+		t, err := time.Parse(time.DateOnly, raw)
+		if err == nil {
+			value.Value = t.Format(time.DateOnly)
+		} else {
+			t, err = time.Parse(time.RFC3339, raw)
+			if err != nil {
+				return value, invalid("must be a date like 2006-01-02 or 2006-01-02T15:04:05Z")
+			}
+			value.Value = t.UTC().Format(time.RFC3339)
+		}
+		n := float64(t.Unix())
+		value.Number = &n
+	case db.FieldURL:
+		u, err := url.Parse(raw)
+		if err != nil || len(u.Scheme) == 0 || len(u.Host) == 0 {
+			return value, invalid("must be an absolute url")
+		}
+	case db.FieldBoolean:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return value, invalid("must be true or false")
+		}
+		n := 0.0
+		if b {
+			n = 1
+		}
+		value.Value = strconv.FormatBool(b)
+		value.Number = &n
+	case db.FieldEnum:
+		choices := field.Choices()
+		if !slices.Contains(choices, raw) {
+			return value, invalid(fmt.Sprintf("must be one of %s", strings.Join(choices, ", ")))
+		}
+	default:
+		return value, fmt.Errorf("%w: unknown type %q", ErrInvalidField, field.Type)
+	}
+	return value, nil
+}
+
+// filterOps is ordered so that two character operators match first.
+var filterOps = []string{">=", "<=", "!=", "=", "<", ">", "~"}
+
+// ParseFilter splits a filter like rating>=4 into the field name, the
+// operator and the value.
+func ParseFilter(expr string) (name, op, value string, err error) {
+	i := strings.IndexAny(expr, "=!<>~")
+	if i <= 0 {
+		return "", "", "", fmt.Errorf("%w %q, expected <field><op><value> with op one of %s", ErrInvalidFilter, expr, strings.Join(filterOps, " "))
+	}
+
+	for _, candidate := range filterOps {
+		if strings.HasPrefix(expr[i:], candidate) {
+			return expr[:i], candidate, expr[i+len(candidate):], nil
+		}
+	}
+	return "", "", "", fmt.Errorf("%w %q, unknown operator", ErrInvalidFilter, expr)
+}
+
+// fileQuery resolves the field filters and sort of a search.
+func (c *FileController) fileQuery(options SearchOptions) (db.FileQuery, error) {
+	query := db.FileQuery{Desc: options.Desc}
+
+	for _, expr := range options.Where {
+		name, op, raw, err := ParseFilter(expr)
+		if err != nil {
+			return query, err
+		}
+		field, err := c.queryField(name)
+		if err != nil {
+			return query, err
+		}
+
+		value := db.FileField{Field: *field, Value: raw}
+		if op != "~" {
+			if value, err = parseFieldValue(*field, raw); err != nil {
+				return query, err
+			}
+		}
+		query.Filters = append(query.Filters, db.FieldFilter{Field: *field, Op: op, Value: value})
+	}
+
+	// Author and description match like author~term in Where.
+	for _, meta := range []struct{ name, term string }{{"author", options.Author}, {"description", options.Description}} {
+		if len(meta.term) == 0 {
+			continue
+		}
+		field, err := c.queryField(meta.name)
+		if err != nil {
+			return query, err
+		}
+		query.Filters = append(query.Filters, db.FieldFilter{Field: *field, Op: "~", Value: db.FileField{Field: *field, Value: meta.term}})
+	}
+
+	if len(options.Sort) > 0 {
+		field, err := c.queryField(options.Sort)
+		if err != nil {
+			return query, err
+		}
+		query.Sort = field
+	}
+	return query, nil
+}
+
+// queryField looks up a field to filter or sort by, the author and
+// description included.
+func (c *FileController) queryField(name string) (*db.Field, error) {
+	if slices.Contains(db.BuiltinFields, name) {
+		return &db.Field{Name: name, Type: db.FieldString}, nil
+	}
+	return lookupField(c.Fields, name)
+}
@@ -1,24 +1,37 @@
 package controllers
 
 import (
+	"context"
 	"errors"
-	"math"
+	"fmt"
+	"iter"
 	"os"
 	"path/filepath"
 	"slices"
 	"strings"
 
 	"github.com/CanPacis/tstud-core/db"
+	"github.com/CanPacis/tstud-core/events"
+	"github.com/CanPacis/tstud-core/store"
 	"github.com/gabriel-vasile/mimetype"
 	"gorm.io/gorm"
 )
 
 type FileController struct {
-	DB *gorm.DB
+	Files  FileRepository
+	Tags   TagRepository
+	Fields FieldRepository
+	// Journal records changes for undo, it may be nil.
+	Journal Journal
+	// Files larger than HashLimit bytes are indexed without a content hash,
+	// 0 hashes every file.
+	HashLimit int64
+	// Events receives an event after every committed change, it may be nil.
+	Events *events.Bus
 }
 
-func NewFileController(db *gorm.DB) *FileController {
-	return &FileController{DB: db}
+func NewFileController(dbs *gorm.DB) *FileController {
+	return &FileController{Files: store.NewGormFiles(dbs), Tags: store.NewGormTags(dbs), Fields: store.NewGormFields(dbs), Journal: NewJournal(dbs)}
 }
 
 func extractFiles(dir string, recursive bool, exclude []string) ([]db.File, error) {
@@ -86,7 +99,17 @@ func chunkFiles(files []db.File, capacity int) [][]db.File {
 	return chunks
 }
 
-func (c *FileController) Index(path string, recursive bool, exclude []string) (*PaginatedResource, error) {
+// Progress is called with the number of processed and total items of a long
+// operation.
+type Progress func(done, total int)
+
+func (c *FileController) Index(path string, recursive bool, exclude []string) (*PaginatedResource[db.FileDTO], error) {
+	return c.IndexContext(context.Background(), path, recursive, exclude, nil)
+}
+
+// IndexContext is Index with cancellation and progress reports. Files indexed
+// before ctx is canceled stay indexed.
+func (c *FileController) IndexContext(ctx context.Context, path string, recursive bool, exclude []string, progress Progress) (*PaginatedResource[db.FileDTO], error) {
 	info, err := os.Stat(path)
 	if err != nil {
 		return nil, err
@@ -109,31 +132,93 @@ func (c *FileController) Index(path string, recursive bool, exclude []string) (*
 
 	chunks := chunkFiles(files, 20)
 
-	for _, chunk := range chunks {
-		// TODO: Known bug: if you index a directory, create a new file in that direactory and then reindex, this will throw because other resources violate unique constraints so the new file won't be indexed.
-		tx := c.DB.Create(&chunk)
-		if tx.Error != nil {
-			if !(info.IsDir() && errors.Is(tx.Error, gorm.ErrDuplicatedKey)) {
-				return nil, tx.Error
+	// Record whatever got indexed, also when canceled halfway.
+	indexed := []uint{}
+	defer func() {
+		if len(indexed) > 0 {
+			record(c.Journal, opFileIndex, fmt.Sprintf("index %d files in %s", len(indexed), path), fileIDsOp{FileIDs: indexed})
+		}
+	}()
+
+	created := []db.File{}
+	for i, chunk := range chunks {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if progress != nil {
+			progress(i*20, len(files))
+		}
+
+		// Hashing is the slow part, leave out whatever is indexed already.
+		chunk, err := c.unindexed(chunk)
+		if err != nil {
+			return nil, err
+		}
+		if len(chunk) == 0 {
+			if !info.IsDir() {
+				return nil, gorm.ErrDuplicatedKey
 			}
+			continue
 		}
-	}
 
-	result := &PaginatedResource{}
+		for j := range chunk {
+			if err := fingerprint(ctx, &chunk[j], c.HashLimit); err != nil {
+				return nil, err
+			}
+		}
 
-	for _, file := range files {
-		dto := *file.ToDTO()
-		if dto.ID != 0 {
-			result.Items = append(result.Items, *file.ToDTO())
+		// Another index may have added one of the paths meanwhile.
+		err = c.Files.Create(chunk)
+		if err != nil {
+			if !(info.IsDir() && errors.Is(err, gorm.ErrDuplicatedKey)) {
+				return nil, err
+			}
+			continue
+		}
+		filesIndexed.With().Add(float64(len(chunk)))
+		created = append(created, chunk...)
+		for _, file := range chunk {
+			indexed = append(indexed, file.ID)
+			c.Events.Publish(events.FileIndexed{File: *file.ToDTO()})
 		}
 	}
+
+	if progress != nil {
+		progress(len(files), len(files))
+	}
+
+	result := &PaginatedResource[db.FileDTO]{}
+
+	for _, file := range created {
+		result.Items = append(result.Items, *file.ToDTO())
+	}
 	result.Page = 0
 	result.TotalPages = 1
 
 	return result, nil
 }
 
-func (c *FileController) Unindex(path string, recursive bool, exclude []string) (*PaginatedResource, error) {
+// unindexed returns the files of chunk whose path is not indexed yet.
+func (c *FileController) unindexed(chunk []db.File) ([]db.File, error) {
+	paths := []string{}
+	for _, file := range chunk {
+		paths = append(paths, file.FilePath)
+	}
+
+	indexed, err := c.Files.Indexed(paths)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(slices.Clone(chunk), func(file db.File) bool {
+		return slices.Contains(indexed, file.FilePath)
+	}), nil
+}
+
+func (c *FileController) Unindex(path string, recursive bool, exclude []string) (*PaginatedResource[db.FileDTO], error) {
+	return c.UnindexContext(context.Background(), path, recursive, exclude, nil)
+}
+
+func (c *FileController) UnindexContext(ctx context.Context, path string, recursive bool, exclude []string, progress Progress) (*PaginatedResource[db.FileDTO], error) {
 	info, err := os.Stat(path)
 	if err != nil {
 		return nil, err
@@ -154,17 +239,41 @@ func (c *FileController) Unindex(path string, recursive bool, exclude []string)
 		files = []db.File{*file}
 	}
 
-	result := &PaginatedResource{}
+	result := &PaginatedResource[db.FileDTO]{}
 
-	for _, file := range files {
-		dto := *file.ToDTO()
-		tx := c.DB.Delete(&file, "file_path = ?", file.FilePath)
-		if tx.Error != nil {
+	unindexed := []uint{}
+	defer func() {
+		if len(unindexed) > 0 {
+			record(c.Journal, opFileUnindex, fmt.Sprintf("unindex %d files in %s", len(unindexed), path), fileIDsOp{FileIDs: unindexed})
+		}
+	}()
+
+	for i, file := range files {
+		if err := ctx.Err(); err != nil {
 			return nil, err
 		}
-		if dto.ID != 0 {
-			result.Items = append(result.Items, *file.ToDTO())
+		if progress != nil {
+			progress(i, len(files))
 		}
+
+		indexed, err := c.Files.GetByPath(file.FilePath)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if err := c.Files.Delete(indexed.ID); err != nil {
+			return nil, err
+		}
+		unindexed = append(unindexed, indexed.ID)
+		result.Items = append(result.Items, *indexed.ToDTO())
+		filesUnindexed.With().Inc()
+		c.Events.Publish(events.FileUnindexed{File: *indexed.ToDTO()})
+	}
+	if progress != nil {
+		progress(len(files), len(files))
 	}
 
 	result.Page = 0
@@ -174,72 +283,76 @@ func (c *FileController) Unindex(path string, recursive bool, exclude []string)
 }
 
 func (c *FileController) Rename(oldPath, newPath string) (*db.FileDTO, error) {
-	var file db.File
-	tx := c.DB.First(&file, "file_path = ?", oldPath)
-	if tx.Error != nil {
-		return nil, tx.Error
+	file, err := c.Files.GetByPath(oldPath)
+	if err != nil {
+		return nil, err
 	}
 
 	// TODO: maybe check the path? I don't know if something should exist or not exist there. Maybe just check if the path is valid.
 	file.FilePath = newPath
-	tx = c.DB.Save(&file)
-	if tx.Error != nil {
-		return nil, tx.Error
+	if err := c.Files.Save(file); err != nil {
+		return nil, err
 	}
 
+	record(c.Journal, opFileRename, fmt.Sprintf("rename %s to %s", oldPath, newPath), fileRenameOp{FileID: file.ID, OldPath: oldPath, NewPath: newPath})
+	c.Events.Publish(events.FileRenamed{File: *file.ToDTO(), OldPath: oldPath})
 	return file.ToDTO(), nil
 }
 
 func (c *FileController) FindByID(id uint) (*db.FileDTO, error) {
-	var file db.File
-	tx := c.DB.Preload("Tags").First(&file, "id = ?", id)
-	if tx.Error != nil {
-		return nil, tx.Error
+	file, err := c.Files.Get(id)
+	if err != nil {
+		return nil, err
 	}
 
-	return file.ToDTO(), tx.Error
+	return file.ToDTO(), nil
 }
 
 func (c *FileController) FindByPath(path string) (*db.FileDTO, error) {
-	var file db.File
-	tx := c.DB.Preload("Tags").First(&file, "file_path = ?", path)
-	if tx.Error != nil {
-		return nil, tx.Error
+	file, err := c.Files.GetByPath(path)
+	if err != nil {
+		return nil, err
 	}
 
-	return file.ToDTO(), tx.Error
+	return file.ToDTO(), nil
 }
 
 func (c *FileController) Tag(fileId uint, tagId uint) (*db.FileDTO, *db.TagDTO, error) {
-	var file db.File
-	var tag db.Tag
-
-	tx := c.DB.First(&file, "id = ?", fileId)
-	if tx.Error != nil {
-		return nil, nil, tx.Error
+	file, err := c.Files.Get(fileId)
+	if err != nil {
+		return nil, nil, err
 	}
-	c.DB.First(&tag, "id = ?", tagId)
-	if tx.Error != nil {
-		return nil, nil, tx.Error
+	tag, err := c.Tags.Get(tagId)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return file.ToDTO(), tag.ToDTO(), c.DB.Model(&file).Association("Tags").Append(&tag)
+	if err := c.Files.AddTag(file.ID, tag.ID); err != nil {
+		return nil, nil, err
+	}
+
+	record(c.Journal, opFileTag, fmt.Sprintf("tag %s with %s", file.Name(), tag.TagName), fileTagOp{FileID: file.ID, TagID: tag.ID})
+	c.Events.Publish(events.FileTagged{File: *file.ToDTO(), Tag: *tag.ToDTO()})
+	return file.ToDTO(), tag.ToDTO(), nil
 }
 
 func (c *FileController) Untag(fileId uint, tagId uint) (*db.FileDTO, *db.TagDTO, error) {
-	var file db.File
-	var tag db.Tag
-
-	tx := c.DB.First(&file, "id = ?", fileId)
-	if tx.Error != nil {
-		return nil, nil, tx.Error
+	file, err := c.Files.Get(fileId)
+	if err != nil {
+		return nil, nil, err
+	}
+	tag, err := c.Tags.Get(tagId)
+	if err != nil {
+		return nil, nil, err
 	}
-	c.DB.First(&tag, "id = ?", tagId)
-	if tx.Error != nil {
-		return nil, nil, tx.Error
+
+	if err := c.Files.RemoveTag(file.ID, tag.ID); err != nil {
+		return nil, nil, err
 	}
 
-	return file.ToDTO(), tag.ToDTO(), c.DB.Model(&file).Association("Tags").Delete(&tag)
+	record(c.Journal, opFileUntag, fmt.Sprintf("untag %s from %s", tag.TagName, file.Name()), fileTagOp{FileID: file.ID, TagID: tag.ID})
+	c.Events.Publish(events.FileUntagged{File: *file.ToDTO(), Tag: *tag.ToDTO()})
+	return file.ToDTO(), tag.ToDTO(), nil
 }
 
 type FileMetaData struct {
@@ -248,14 +361,13 @@ type FileMetaData struct {
 }
 
 func (c *FileController) SetMeta(fileId uint, meta FileMetaData) (*db.FileDTO, error) {
-	var file db.File
-
-	tx := c.DB.First(&file, "id = ?", fileId)
-	if tx.Error != nil {
-		return nil, tx.Error
+	file, err := c.Files.Get(fileId)
+	if err != nil {
+		return nil, err
 	}
 
-	// TODO: update this to be more dynamic
+	before := fileMeta{Author: file.Author, Description: file.Description}
+
 	if meta.Author != nil {
 		file.Author = *meta.Author
 	}
@@ -264,143 +376,183 @@ func (c *FileController) SetMeta(fileId uint, meta FileMetaData) (*db.FileDTO, e
 		file.Description = *meta.Description
 	}
 
-	tx = c.DB.Save(&file)
-	if tx.Error != nil {
-		return nil, tx.Error
+	if err := c.Files.Save(file); err != nil {
+		return nil, err
 	}
 
+	after := fileMeta{Author: file.Author, Description: file.Description}
+	record(c.Journal, opFileMeta, fmt.Sprintf("change metadata of %s", file.Name()), fileMetaOp{FileID: file.ID, Before: before, After: after})
+	c.Events.Publish(events.FileMetaChanged{File: *file.ToDTO()})
 	return file.ToDTO(), nil
 }
 
-func (c *FileController) List(options ListOptions) (*PaginatedResource, error) {
-	var files []db.File
-
-	tx := c.DB.Order("file_path desc").Limit(options.PerPage).Offset(options.Page * options.PerPage).Find(&files)
-	if tx.Error != nil {
-		return nil, tx.Error
-	}
-
-	var count int64
-	tx = c.DB.Model(&db.File{}).Count(&count)
-	if tx.Error != nil {
-		return nil, tx.Error
+// SetField sets a custom field of a file, or the author or description.
+func (c *FileController) SetField(fileId uint, key, raw string) (*db.FileDTO, error) {
+	switch key {
+	case "author":
+		return c.SetMeta(fileId, FileMetaData{Author: &raw})
+	case "description":
+		return c.SetMeta(fileId, FileMetaData{Description: &raw})
 	}
 
-	result := &PaginatedResource{
-		Items:      []any{},
-		Page:       options.Page,
-		TotalPages: int(math.Ceil(float64(count) / float64(options.PerPage))),
+	field, err := lookupField(c.Fields, key)
+	if err != nil {
+		return nil, err
 	}
-
-	for _, file := range files {
-		result.Items = append(result.Items, *file.ToDTO())
+	value, err := parseFieldValue(*field, raw)
+	if err != nil {
+		return nil, err
 	}
+	value.FileID = fileId
 
-	return result, nil
+	return c.changeField(fileId, field, &value)
 }
 
-func (c *FileController) extractTags(tagNames []string) ([]uint, error) {
-	var tags []db.Tag
-
-	tx := c.DB.Find(&tags, "tag_name in ?", tagNames)
-	if tx.Error != nil {
-		return nil, tx.Error
+// UnsetField removes a custom field from a file, or clears the author or
+// description.
+func (c *FileController) UnsetField(fileId uint, key string) (*db.FileDTO, error) {
+	empty := ""
+	switch key {
+	case "author":
+		return c.SetMeta(fileId, FileMetaData{Author: &empty})
+	case "description":
+		return c.SetMeta(fileId, FileMetaData{Description: &empty})
 	}
 
-	tagIds := []uint{}
-	for _, tag := range tags {
-		tagIds = append(tagIds, tag.ID)
+	field, err := lookupField(c.Fields, key)
+	if err != nil {
+		return nil, err
 	}
-
-	return c.extractTagIDs(tagIds, 0)
+	return c.changeField(fileId, field, nil)
 }
 
-func (c *FileController) extractTagIDs(ids []uint, depth int) ([]uint, error) {
-	if depth > 6 || len(ids) == 0 {
-		return []uint{}, nil
+func (c *FileController) changeField(fileId uint, field *db.Field, value *db.FileField) (*db.FileDTO, error) {
+	file, err := c.Files.Get(fileId)
+	if err != nil {
+		return nil, err
 	}
 
-	var tags []db.Tag
-
-	tagIds := []uint{}
-	if depth == 0 {
-		tagIds = append(tagIds, ids...)
+	var before *fieldValue
+	previous, err := c.Fields.Value(fileId, field.ID)
+	if err == nil {
+		before = &fieldValue{Value: previous.Value, Number: previous.Number}
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
 	}
 
-	tx := c.DB.Find(&tags, "parent_id in ?", ids)
-	if tx.Error != nil {
-		return nil, tx.Error
+	var after *fieldValue
+	if value != nil {
+		err = c.Fields.SetValue(value)
+		after = &fieldValue{Value: value.Value, Number: value.Number}
+	} else {
+		err = c.Fields.DeleteValue(fileId, field.ID)
 	}
-
-	for _, tag := range tags {
-		tagIds = append(tagIds, tag.ID)
+	if err != nil {
+		return nil, err
 	}
 
-	subTags, err := c.extractTagIDs(tagIds, depth+1)
+	file, err = c.Files.Get(fileId)
 	if err != nil {
 		return nil, err
 	}
-	tagIds = append(tagIds, subTags...)
 
-	return tagIds, nil
+	record(c.Journal, opFileField, fmt.Sprintf("change %s of %s", field.Name, file.Name()), fileFieldOp{FileID: fileId, FieldID: field.ID, Before: before, After: after})
+	c.Events.Publish(events.FileMetaChanged{File: *file.ToDTO()})
+	return file.ToDTO(), nil
 }
 
-func (c *FileController) tagSearch(tagIds []uint, limit, offset int) ([]db.File, error) {
-	if len(tagIds) == 0 {
-		return []db.File{}, nil
+func (c *FileController) List(options ListOptions) (*PaginatedResource[db.FileDTO], error) {
+	options = options.paged()
+	files, err := c.Files.List(options.Page*options.PerPage, options.PerPage)
+	if err != nil {
+		return nil, err
 	}
 
-	var fileTags []struct {
-		FileID uint
-		TagID  uint
-	}
-	tx := c.DB.Table("file_tags").Find(&fileTags, "tag_id IN ?", tagIds)
-	if tx.Error != nil {
-		return nil, tx.Error
+	count, err := c.Files.Count()
+	if err != nil {
+		return nil, err
 	}
 
-	var fileIds []uint
-	for _, fileTag := range fileTags {
-		fileIds = append(fileIds, fileTag.FileID)
+	result := &PaginatedResource[db.FileDTO]{
+		Items:      []db.FileDTO{},
+		Page:       options.Page,
+		TotalPages: pageCount(count, options.PerPage),
 	}
 
-	var files []db.File
-	tx = c.DB.Order("file_path desc").Limit(limit).Offset(offset).Find(&files, "id IN ?", fileIds)
-	if tx.Error != nil {
-		return nil, tx.Error
+	for _, file := range files {
+		result.Items = append(result.Items, *file.ToDTO())
 	}
 
-	return files, nil
+	return result, nil
 }
 
-func (c *FileController) aliasSearch(words []string, limit, offset int) ([]db.File, error) {
-	var aliases []db.Alias
+// ListEach yields the files of a List page, or every file when PerPage is 0.
+func (c *FileController) ListEach(options ListOptions) iter.Seq2[db.FileDTO, error] {
+	return eachPage(options, c.List)
+}
 
-	tx := c.DB.Find(&aliases, "name IN ?", words)
-	if tx.Error != nil {
-		return nil, tx.Error
-	}
+// SearchEach yields the files of a Search page, or every match when PerPage
+// is 0.
+func (c *FileController) SearchEach(options SearchOptions) iter.Seq2[db.FileDTO, error] {
+	return eachPage(options.ListOptions, func(page ListOptions) (*PaginatedResource[db.FileDTO], error) {
+		options.ListOptions = page
+		return c.Search(options)
+	})
+}
+
+// Each yields every indexed file in batches, so callers can walk the whole
+// library in constant memory.
+func (c *FileController) Each(batchSize int) iter.Seq2[db.FileDTO, error] {
+	return func(yield func(db.FileDTO, error) bool) {
+		var lastId uint
+		for {
+			files, err := c.Files.After(lastId, batchSize)
+			if err != nil {
+				yield(db.FileDTO{}, err)
+				return
+			}
 
-	var tagIds []uint
+			for _, file := range files {
+				if !yield(*file.ToDTO(), nil) {
+					return
+				}
+				lastId = file.ID
+			}
 
-	for _, alias := range aliases {
-		tagIds = append(tagIds, alias.TagID)
+			if len(files) < batchSize {
+				return
+			}
+		}
+	}
+}
+
+func (c *FileController) extractTags(tagNames []string) ([]uint, error) {
+	tagIds, err := c.Tags.NamedIDs(tagNames)
+	if err != nil {
+		return nil, err
 	}
 
-	return c.tagSearch(tagIds, limit, offset)
+	return c.Tags.DescendantIDs(tagIds)
 }
 
-// TODO: Fix this to do a proper keyword sql like search
-func (c *FileController) keywordSearch(keywords []string, limit, offset int) ([]db.File, error) {
-	files := []db.File{}
-	tx := c.DB.Limit(limit).Offset(offset).Find(&files, "file_name IN ?", keywords)
+func (c *FileController) aliasSearch(words []string, limit, offset int) ([]db.File, error) {
+	tagIds, err := c.Tags.AliasedIDs(words)
+	if err != nil {
+		return nil, err
+	}
 
-	return files, tx.Error
+	return c.Files.Tagged(tagIds, offset, limit)
 }
 
-func (c *FileController) Search(options SearchOptions) (*PaginatedResource, error) {
-	result := &PaginatedResource{
-		Items:      []any{},
+func (c *FileController) Search(options SearchOptions) (*PaginatedResource[db.FileDTO], error) {
+	searchesRun.With("file").Inc()
+	options.ListOptions = options.ListOptions.paged()
+	if len(options.Where) > 0 || len(options.Sort) > 0 || len(options.Author) > 0 || len(options.Description) > 0 {
+		return c.fieldSearch(options)
+	}
+
+	result := &PaginatedResource[db.FileDTO]{
+		Items:      []db.FileDTO{},
 		Page:       options.Page,
 		TotalPages: 1,
 	}
@@ -412,7 +564,7 @@ func (c *FileController) Search(options SearchOptions) (*PaginatedResource, erro
 	if err != nil {
 		return nil, err
 	}
-	search, err := c.tagSearch(tagIds, options.PerPage, options.PerPage*options.Page)
+	search, err := c.Files.Tagged(tagIds, options.PerPage*options.Page, options.PerPage)
 	if err == nil {
 		files = append(files, search...)
 	}
@@ -420,12 +572,12 @@ func (c *FileController) Search(options SearchOptions) (*PaginatedResource, erro
 	if err == nil {
 		files = append(files, search...)
 	}
-	search, err = c.keywordSearch(strings.Split(options.Term, " "), options.PerPage, options.PerPage*options.Page)
+	search, err = c.Files.Named(strings.Split(options.Term, " "), options.PerPage*options.Page, options.PerPage)
 	if err == nil {
 		files = append(files, search...)
 	}
 
-	result.TotalPages = len(files)/options.PerPage + 1
+	result.TotalPages = pageCount(int64(len(files)), options.PerPage)
 
 	for _, file := range files {
 		result.Items = append(result.Items, *file.ToDTO())
@@ -433,3 +585,56 @@ func (c *FileController) Search(options SearchOptions) (*PaginatedResource, erro
 
 	return result, nil
 }
+
+// fieldSearch filters and orders by custom fields, author and description.
+// Term and tags narrow the files down first, without them every file is a
+// candidate.
+func (c *FileController) fieldSearch(options SearchOptions) (*PaginatedResource[db.FileDTO], error) {
+	query, err := c.fileQuery(options)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(options.Term) > 0 || len(options.Tags) > 0 {
+		candidates := []db.File{}
+
+		tagIds, err := c.extractTags(options.Tags)
+		if err != nil {
+			return nil, err
+		}
+		search, err := c.Files.Tagged(tagIds, 0, -1)
+		if err == nil {
+			candidates = append(candidates, search...)
+		}
+		search, err = c.aliasSearch(strings.Split(options.Term, " "), -1, 0)
+		if err == nil {
+			candidates = append(candidates, search...)
+		}
+		search, err = c.Files.Named(strings.Split(options.Term, " "), 0, -1)
+		if err == nil {
+			candidates = append(candidates, search...)
+		}
+
+		query.FileIDs = []uint{}
+		for _, file := range candidates {
+			if !slices.Contains(query.FileIDs, file.ID) {
+				query.FileIDs = append(query.FileIDs, file.ID)
+			}
+		}
+	}
+
+	files, count, err := c.Files.Query(query, options.PerPage*options.Page, options.PerPage)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PaginatedResource[db.FileDTO]{
+		Items:      []db.FileDTO{},
+		Page:       options.Page,
+		TotalPages: pageCount(count, options.PerPage),
+	}
+	for _, file := range files {
+		result.Items = append(result.Items, *file.ToDTO())
+	}
+	return result, nil
+}
@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+
+	"github.com/CanPacis/tstud-core/db"
+	"github.com/CanPacis/tstud-core/events"
+)
+
+// ctxReader stops reading once ctx is canceled, so hashing a large file can
+// be interrupted.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// fingerprint fills in the stat data and the content hash of file. Files
+// larger than hashLimit bytes are not hashed, 0 hashes every file. Like the
+// mime type, the stat data and hash are left empty when the file cannot be
+// read. Only cancellation is reported as an error.
+func fingerprint(ctx context.Context, file *db.File, hashLimit int64) error {
+	info, err := os.Stat(file.FilePath)
+	if err != nil {
+		return nil
+	}
+
+	modTime := info.ModTime()
+	file.Size = info.Size()
+	file.ModTime = &modTime
+	file.Inode, file.Device = statIdentity(info)
+
+	if hashLimit > 0 && info.Size() > hashLimit {
+		return nil
+	}
+
+	f, err := os.Open(file.FilePath)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, ctxReader{ctx, f}); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return nil
+	}
+	file.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return nil
+}
+
+const rehashBatch = 100
+
+// Rehash fingerprints indexed files again and saves the ones that changed.
+// Unless all is set it only visits files without stat data, which were
+// indexed before fingerprints were recorded. Files that cannot be read keep
+// their old fingerprint. It returns the number of files updated.
+func (c *FileController) Rehash(ctx context.Context, all bool, progress Progress) (int, error) {
+	total, err := c.Files.Count()
+	if err != nil {
+		return 0, err
+	}
+
+	var lastId uint
+	done, updated := 0, 0
+	for {
+		files, err := c.Files.After(lastId, rehashBatch)
+		if err != nil {
+			return updated, err
+		}
+
+		for _, file := range files {
+			if err := ctx.Err(); err != nil {
+				return updated, err
+			}
+			lastId = file.ID
+			done++
+
+			if !all && file.ModTime != nil {
+				continue
+			}
+
+			fresh := db.File{FilePath: file.FilePath}
+			if err := fingerprint(ctx, &fresh, c.HashLimit); err != nil {
+				return updated, err
+			}
+			if fresh.ModTime == nil || sameFingerprint(file, fresh) {
+				continue
+			}
+
+			file.Size, file.ModTime, file.Inode, file.Device, file.SHA256 = fresh.Size, fresh.ModTime, fresh.Inode, fresh.Device, fresh.SHA256
+			if err := c.Files.Save(&file); err != nil {
+				return updated, err
+			}
+			updated++
+			c.Events.Publish(events.FileMetaChanged{File: *file.ToDTO()})
+		}
+
+		if progress != nil {
+			progress(done, int(total))
+		}
+		if len(files) < rehashBatch {
+			return updated, nil
+		}
+	}
+}
+
+func sameFingerprint(a, b db.File) bool {
+	if (a.ModTime == nil) != (b.ModTime == nil) || (a.ModTime != nil && !a.ModTime.Equal(*b.ModTime)) {
+		return false
+	}
+	return a.Size == b.Size && a.Inode == b.Inode && a.Device == b.Device && a.SHA256 == b.SHA256
+}
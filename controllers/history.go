@@ -0,0 +1,693 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/CanPacis/tstud-core/db"
+	"github.com/CanPacis/tstud-core/events"
+	"github.com/CanPacis/tstud-core/store"
+	"gorm.io/gorm"
+)
+
+const (
+	OperationDone   = "done"
+	OperationUndone = "undone"
+)
+
+const (
+	opFileIndex   = "file.index"
+	opFileUnindex = "file.unindex"
+	opFileRename  = "file.rename"
+	opFileTag     = "file.tag"
+	opFileUntag   = "file.untag"
+	opFileMeta    = "file.meta"
+	opFileField   = "file.field"
+	opTagCreate   = "tag.create"
+	opTagDelete   = "tag.delete"
+	opTagAlias    = "tag.alias"
+	opTagUnalias  = "tag.unalias"
+	opTagParent   = "tag.parent"
+	opFieldCreate = "field.create"
+	opFieldDelete = "field.delete"
+)
+
+var (
+	ErrNothingToUndo = errors.New("nothing to undo")
+	ErrNothingToRedo = errors.New("nothing to redo")
+	// ErrHistoryConflict is returned when later changes prevent reversing or
+	// reapplying an operation. Nothing is changed in that case.
+	ErrHistoryConflict = errors.New("history conflict")
+	// ErrHistoryUnavailable is returned by a HistoryController without a
+	// journal, as in libraries kept in memory.
+	ErrHistoryUnavailable = errors.New("history is not available for this library")
+)
+
+func conflict(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrHistoryConflict, fmt.Sprintf(format, args...))
+}
+
+type fileIDsOp struct {
+	FileIDs []uint `json:"file_ids"`
+}
+
+type fileRenameOp struct {
+	FileID  uint   `json:"file_id"`
+	OldPath string `json:"old_path"`
+	NewPath string `json:"new_path"`
+}
+
+type fileTagOp struct {
+	FileID uint `json:"file_id"`
+	TagID  uint `json:"tag_id"`
+}
+
+type fileMeta struct {
+	Author      string `json:"author"`
+	Description string `json:"description"`
+}
+
+type fileMetaOp struct {
+	FileID uint     `json:"file_id"`
+	Before fileMeta `json:"before"`
+	After  fileMeta `json:"after"`
+}
+
+type fieldValue struct {
+	Value  string   `json:"value"`
+	Number *float64 `json:"number"`
+}
+
+// fileFieldOp holds a custom field value before and after the change, nil
+// when the file had no value.
+type fileFieldOp struct {
+	FileID  uint        `json:"file_id"`
+	FieldID uint        `json:"field_id"`
+	Before  *fieldValue `json:"before"`
+	After   *fieldValue `json:"after"`
+}
+
+type fileValue struct {
+	FileID uint `json:"file_id"`
+	fieldValue
+}
+
+// fieldOp holds the definition of a field, and for a deleted field the
+// values it had on files.
+type fieldOp struct {
+	FieldID uint        `json:"field_id"`
+	Name    string      `json:"name"`
+	Type    string      `json:"type"`
+	Choices []string    `json:"choices"`
+	Values  []fileValue `json:"values"`
+}
+
+func newFieldOp(field *db.Field, values []db.FileField) fieldOp {
+	p := fieldOp{FieldID: field.ID, Name: field.Name, Type: field.Type, Choices: field.Choices()}
+	for _, value := range values {
+		p.Values = append(p.Values, fileValue{FileID: value.FileID, fieldValue: fieldValue{Value: value.Value, Number: value.Number}})
+	}
+	return p
+}
+
+func (p fieldOp) field() db.Field {
+	field := db.Field{Name: p.Name, Type: p.Type}
+	field.ID = p.FieldID
+	if len(p.Choices) > 0 {
+		field.Values, _ = json.Marshal(p.Choices)
+	}
+	return field
+}
+
+type tagOp struct {
+	TagID uint `json:"tag_id"`
+}
+
+type aliasOp struct {
+	TagID   uint   `json:"tag_id"`
+	AliasID uint   `json:"alias_id"`
+	Name    string `json:"name"`
+}
+
+type tagParentOp struct {
+	TagID     uint `json:"tag_id"`
+	OldParent *int `json:"old_parent"`
+	NewParent *int `json:"new_parent"`
+}
+
+// Journal keeps the operations that HistoryController reverses and
+// reapplies.
+type Journal interface {
+	Record(kind, description string, payload any)
+}
+
+type dbJournal struct {
+	DB *gorm.DB
+}
+
+// NewJournal records operations in the operations table of dbs.
+func NewJournal(dbs *gorm.DB) Journal {
+	return &dbJournal{DB: dbs}
+}
+
+// Record appends a completed operation to the journal. A new operation
+// discards everything that could have been redone. The journal is best
+// effort, a failure to record never fails the change itself.
+func (j *dbJournal) Record(kind, description string, payload any) {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+
+	j.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Where("state = ?", OperationUndone).Delete(&db.Operation{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&db.Operation{Kind: kind, Description: description, Payload: encoded, State: OperationDone}).Error
+	})
+}
+
+// record writes to journal unless it is nil.
+func record(journal Journal, kind, description string, payload any) {
+	if journal != nil {
+		journal.Record(kind, description, payload)
+	}
+}
+
+type HistoryController struct {
+	// DB holds the journal and the tables it replays against. Without it
+	// every call returns ErrHistoryUnavailable.
+	DB *gorm.DB
+	// Events receives the events of the change an undo or redo made, it may
+	// be nil.
+	Events *events.Bus
+}
+
+func NewHistoryController(db *gorm.DB) *HistoryController {
+	return &HistoryController{DB: db}
+}
+
+// Undo reverses the most recent operation that is not undone yet.
+func (c *HistoryController) Undo() (*db.OperationDTO, error) {
+	if c.DB == nil {
+		return nil, ErrHistoryUnavailable
+	}
+	var op db.Operation
+	tx := c.DB.Order("id desc").Limit(1).Find(&op, "state = ?", OperationDone)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return nil, ErrNothingToUndo
+	}
+
+	return c.apply(op, true)
+}
+
+// Redo reapplies the oldest undone operation.
+func (c *HistoryController) Redo() (*db.OperationDTO, error) {
+	if c.DB == nil {
+		return nil, ErrHistoryUnavailable
+	}
+	var op db.Operation
+	tx := c.DB.Order("id asc").Limit(1).Find(&op, "state = ?", OperationUndone)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return nil, ErrNothingToRedo
+	}
+
+	return c.apply(op, false)
+}
+
+func (c *HistoryController) List(limit int) ([]db.OperationDTO, error) {
+	if c.DB == nil {
+		return nil, ErrHistoryUnavailable
+	}
+	var ops []db.Operation
+	tx := c.DB.Order("id desc").Limit(limit).Find(&ops)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	result := []db.OperationDTO{}
+	for _, op := range ops {
+		result = append(result, *op.ToDTO())
+	}
+	return result, nil
+}
+
+func (c *HistoryController) apply(op db.Operation, undo bool) (*db.OperationDTO, error) {
+	state := OperationDone
+	if undo {
+		state = OperationUndone
+	}
+
+	var published []events.Event
+	err := c.DB.Transaction(func(tx *gorm.DB) error {
+		if err := applyOperation(tx, op, undo); err != nil {
+			return err
+		}
+
+		var err error
+		published, err = operationEvents(tx, op, undo)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&op).Update("state", state).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range published {
+		c.Events.Publish(e)
+	}
+
+	op.State = state
+	return op.ToDTO(), nil
+}
+
+// operationEvents returns the events a controller would have published for
+// the change applyOperation just made.
+func operationEvents(tx *gorm.DB, op db.Operation, undo bool) ([]events.Event, error) {
+	switch op.Kind {
+	case opFileIndex, opFileUnindex:
+		var p fileIDsOp
+		if err := json.Unmarshal(op.Payload, &p); err != nil {
+			return nil, err
+		}
+		if len(p.FileIDs) == 0 {
+			return nil, nil
+		}
+
+		var files []db.File
+		if err := tx.Unscoped().Preload("Tags").Order("id asc").Find(&files, "id IN ?", p.FileIDs).Error; err != nil {
+			return nil, err
+		}
+
+		result := []events.Event{}
+		for _, file := range files {
+			if (op.Kind == opFileIndex) == undo {
+				result = append(result, events.FileUnindexed{File: *file.ToDTO()})
+			} else {
+				result = append(result, events.FileIndexed{File: *file.ToDTO()})
+			}
+		}
+		return result, nil
+
+	case opFileRename:
+		var p fileRenameOp
+		if err := json.Unmarshal(op.Payload, &p); err != nil {
+			return nil, err
+		}
+		from := p.OldPath
+		if undo {
+			from = p.NewPath
+		}
+
+		file, err := store.NewGormFiles(tx).Get(p.FileID)
+		if err != nil {
+			return nil, err
+		}
+		return []events.Event{events.FileRenamed{File: *file.ToDTO(), OldPath: from}}, nil
+
+	case opFileTag, opFileUntag:
+		var p fileTagOp
+		if err := json.Unmarshal(op.Payload, &p); err != nil {
+			return nil, err
+		}
+
+		file, err := store.NewGormFiles(tx).Get(p.FileID)
+		if err != nil {
+			return nil, err
+		}
+		tag, err := store.NewGormTags(tx).Get(p.TagID)
+		if err != nil {
+			return nil, err
+		}
+
+		if (op.Kind == opFileTag) == undo {
+			return []events.Event{events.FileUntagged{File: *file.ToDTO(), Tag: *tag.ToDTO()}}, nil
+		}
+		return []events.Event{events.FileTagged{File: *file.ToDTO(), Tag: *tag.ToDTO()}}, nil
+
+	case opFileMeta, opFileField:
+		var p struct {
+			FileID uint `json:"file_id"`
+		}
+		if err := json.Unmarshal(op.Payload, &p); err != nil {
+			return nil, err
+		}
+
+		file, err := store.NewGormFiles(tx).Get(p.FileID)
+		if err != nil {
+			return nil, err
+		}
+		return []events.Event{events.FileMetaChanged{File: *file.ToDTO()}}, nil
+
+	case opTagCreate, opTagDelete:
+		var p tagOp
+		if err := json.Unmarshal(op.Payload, &p); err != nil {
+			return nil, err
+		}
+
+		var tag db.Tag
+		if err := tx.Unscoped().Preload("Parent").Preload("Aliases").First(&tag, "id = ?", p.TagID).Error; err != nil {
+			return nil, err
+		}
+
+		if (op.Kind == opTagCreate) == undo {
+			return []events.Event{events.TagDeleted{Tag: *tag.ToDTO()}}, nil
+		}
+		return []events.Event{events.TagCreated{Tag: *tag.ToDTO()}}, nil
+
+	case opTagAlias, opTagUnalias:
+		var p aliasOp
+		if err := json.Unmarshal(op.Payload, &p); err != nil {
+			return nil, err
+		}
+
+		tag, err := store.NewGormTags(tx).Get(p.TagID)
+		if err != nil {
+			return nil, err
+		}
+
+		if (op.Kind == opTagAlias) == undo {
+			return []events.Event{events.AliasRemoved{Tag: *tag.ToDTO(), Alias: p.Name}}, nil
+		}
+		return []events.Event{events.AliasAdded{Tag: *tag.ToDTO(), Alias: p.Name}}, nil
+
+	case opTagParent:
+		var p tagParentOp
+		if err := json.Unmarshal(op.Payload, &p); err != nil {
+			return nil, err
+		}
+		from := p.OldParent
+		if undo {
+			from = p.NewParent
+		}
+
+		tag, err := store.NewGormTags(tx).Get(p.TagID)
+		if err != nil {
+			return nil, err
+		}
+		return []events.Event{events.TagReparented{Tag: *tag.ToDTO(), OldParentID: from}}, nil
+
+	case opFieldCreate, opFieldDelete:
+		var p fieldOp
+		if err := json.Unmarshal(op.Payload, &p); err != nil {
+			return nil, err
+		}
+
+		field := p.field()
+		if (op.Kind == opFieldCreate) == undo {
+			return []events.Event{events.FieldDeleted{Field: *field.ToDTO()}}, nil
+		}
+		return []events.Event{events.FieldCreated{Field: *field.ToDTO()}}, nil
+	}
+	return nil, nil
+}
+
+func applyOperation(tx *gorm.DB, op db.Operation, undo bool) error {
+	switch op.Kind {
+	case opFileIndex, opFileUnindex:
+		var p fileIDsOp
+		if err := json.Unmarshal(op.Payload, &p); err != nil {
+			return err
+		}
+		// Undoing an index and redoing an unindex both remove the files.
+		if (op.Kind == opFileIndex) == undo {
+			return softDelete(tx, &db.File{}, "file", p.FileIDs)
+		}
+		return restore(tx, &db.File{}, "file", p.FileIDs)
+
+	case opFileRename:
+		var p fileRenameOp
+		if err := json.Unmarshal(op.Payload, &p); err != nil {
+			return err
+		}
+		from, to := p.NewPath, p.OldPath
+		if !undo {
+			from, to = p.OldPath, p.NewPath
+		}
+
+		var file db.File
+		if err := tx.First(&file, "id = ?", p.FileID).Error; err != nil {
+			return conflict("file %d no longer exists", p.FileID)
+		}
+		if file.FilePath != from {
+			return conflict("file %d was renamed to %s since", p.FileID, file.FilePath)
+		}
+		return tx.Model(&file).Update("file_path", to).Error
+
+	case opFileTag, opFileUntag:
+		var p fileTagOp
+		if err := json.Unmarshal(op.Payload, &p); err != nil {
+			return err
+		}
+
+		var file db.File
+		var tag db.Tag
+		if err := tx.First(&file, "id = ?", p.FileID).Error; err != nil {
+			return conflict("file %d no longer exists", p.FileID)
+		}
+		if err := tx.First(&tag, "id = ?", p.TagID).Error; err != nil {
+			return conflict("tag %d no longer exists", p.TagID)
+		}
+
+		if (op.Kind == opFileTag) == undo {
+			return tx.Model(&file).Association("Tags").Delete(&tag)
+		}
+		return tx.Model(&file).Association("Tags").Append(&tag)
+
+	case opFileMeta:
+		var p fileMetaOp
+		if err := json.Unmarshal(op.Payload, &p); err != nil {
+			return err
+		}
+		from, to := p.After, p.Before
+		if !undo {
+			from, to = p.Before, p.After
+		}
+
+		var file db.File
+		if err := tx.First(&file, "id = ?", p.FileID).Error; err != nil {
+			return conflict("file %d no longer exists", p.FileID)
+		}
+		if file.Author != from.Author || file.Description != from.Description {
+			return conflict("metadata of file %d was changed since", p.FileID)
+		}
+		return tx.Model(&file).Updates(map[string]any{"author": to.Author, "description": to.Description}).Error
+
+	case opFileField:
+		var p fileFieldOp
+		if err := json.Unmarshal(op.Payload, &p); err != nil {
+			return err
+		}
+		from, to := p.After, p.Before
+		if !undo {
+			from, to = p.Before, p.After
+		}
+
+		if err := tx.First(&db.File{}, "id = ?", p.FileID).Error; err != nil {
+			return conflict("file %d no longer exists", p.FileID)
+		}
+		if err := tx.First(&db.Field{}, "id = ?", p.FieldID).Error; err != nil {
+			return conflict("field %d no longer exists", p.FieldID)
+		}
+
+		var current *fieldValue
+		var value db.FileField
+		result := tx.Limit(1).Find(&value, "file_id = ? AND field_id = ?", p.FileID, p.FieldID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			current = &fieldValue{Value: value.Value, Number: value.Number}
+		}
+		if (current == nil) != (from == nil) || (current != nil && current.Value != from.Value) {
+			return conflict("field %d of file %d was changed since", p.FieldID, p.FileID)
+		}
+
+		if to == nil {
+			return tx.Delete(&db.FileField{}, "file_id = ? AND field_id = ?", p.FileID, p.FieldID).Error
+		}
+		return tx.Omit("Field").Save(&db.FileField{FileID: p.FileID, FieldID: p.FieldID, Value: to.Value, Number: to.Number}).Error
+
+	case opTagCreate, opTagDelete:
+		var p tagOp
+		if err := json.Unmarshal(op.Payload, &p); err != nil {
+			return err
+		}
+		if (op.Kind == opTagCreate) != undo {
+			return restore(tx, &db.Tag{}, "tag", []uint{p.TagID})
+		}
+
+		if op.Kind == opTagCreate {
+			// Only a tag nobody uses yet can be taken back silently.
+			var count int64
+			tx.Table("file_tags").Where("tag_id = ?", p.TagID).Count(&count)
+			if count > 0 {
+				return conflict("tag %d is attached to files", p.TagID)
+			}
+			tx.Model(&db.Tag{}).Where("parent_id = ?", p.TagID).Count(&count)
+			if count > 0 {
+				return conflict("tag %d has child tags", p.TagID)
+			}
+		}
+		return softDelete(tx, &db.Tag{}, "tag", []uint{p.TagID})
+
+	case opTagAlias, opTagUnalias:
+		var p aliasOp
+		if err := json.Unmarshal(op.Payload, &p); err != nil {
+			return err
+		}
+		if err := tx.First(&db.Tag{}, "id = ?", p.TagID).Error; err != nil {
+			return conflict("tag %d no longer exists", p.TagID)
+		}
+
+		if (op.Kind == opTagAlias) == undo {
+			return softDelete(tx, &db.Alias{}, "alias", []uint{p.AliasID})
+		}
+		return restore(tx, &db.Alias{}, "alias", []uint{p.AliasID})
+
+	case opTagParent:
+		var p tagParentOp
+		if err := json.Unmarshal(op.Payload, &p); err != nil {
+			return err
+		}
+		from, to := p.NewParent, p.OldParent
+		if !undo {
+			from, to = p.OldParent, p.NewParent
+		}
+
+		var tag db.Tag
+		if err := tx.First(&tag, "id = ?", p.TagID).Error; err != nil {
+			return conflict("tag %d no longer exists", p.TagID)
+		}
+		if !sameParent(tag.ParentID, from) {
+			return conflict("tag %d was moved since", p.TagID)
+		}
+		if to != nil {
+			if err := checkParent(store.NewGormTags(tx), p.TagID, uint(*to)); err != nil {
+				return conflict("tag %d cannot be moved back: %s", p.TagID, err)
+			}
+		}
+		return tx.Model(&tag).Update("parent_id", to).Error
+
+	case opFieldCreate, opFieldDelete:
+		var p fieldOp
+		if err := json.Unmarshal(op.Payload, &p); err != nil {
+			return err
+		}
+		if (op.Kind == opFieldCreate) != undo {
+			return restoreField(tx, p)
+		}
+		return removeField(tx, p)
+
+	default:
+		return fmt.Errorf("unknown operation %q", op.Kind)
+	}
+}
+
+// removeField deletes the field of p, or nothing if its values are not the
+// ones p recorded. A field that was just created has none.
+func removeField(tx *gorm.DB, p fieldOp) error {
+	fields := store.NewGormFields(tx)
+	if err := tx.First(&db.Field{}, "id = ?", p.FieldID).Error; err != nil {
+		return conflict("field %d no longer exists", p.FieldID)
+	}
+
+	values, err := fields.Values(p.FieldID)
+	if err != nil {
+		return err
+	}
+	changed := len(values) != len(p.Values)
+	for i := 0; !changed && i < len(values); i++ {
+		changed = values[i].FileID != p.Values[i].FileID || values[i].Value != p.Values[i].Value
+	}
+	if changed {
+		return conflict("values of field %s were changed since", p.Name)
+	}
+	return fields.Delete(p.FieldID)
+}
+
+// restoreField creates the field of p again with its ID and values.
+func restoreField(tx *gorm.DB, p fieldOp) error {
+	var count int64
+	if err := tx.Model(&db.Field{}).Where("id = ? OR name = ?", p.FieldID, p.Name).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return conflict("field %s was created again since", p.Name)
+	}
+
+	ids := []uint{}
+	values := []db.FileField{}
+	for _, value := range p.Values {
+		ids = append(ids, value.FileID)
+		values = append(values, db.FileField{FileID: value.FileID, FieldID: p.FieldID, Value: value.Value, Number: value.Number})
+	}
+	if err := tx.Unscoped().Model(&db.File{}).Where("id IN ?", ids).Count(&count).Error; err != nil {
+		return err
+	}
+	if int(count) != len(ids) {
+		return conflict("%d of %d files with a value of %s no longer exist", len(ids)-int(count), len(ids), p.Name)
+	}
+
+	field := p.field()
+	if err := tx.Create(&field).Error; err != nil {
+		return err
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return tx.Omit("Field").Create(&values).Error
+}
+
+func sameParent(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// softDelete deletes every row in ids, or none if one of them is already
+// gone.
+func softDelete(tx *gorm.DB, model any, name string, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var count int64
+	if err := tx.Model(model).Where("id IN ?", ids).Count(&count).Error; err != nil {
+		return err
+	}
+	if int(count) != len(ids) {
+		return conflict("%d of %d %s records no longer exist", len(ids)-int(count), len(ids), name)
+	}
+
+	return tx.Where("id IN ?", ids).Delete(model).Error
+}
+
+// restore brings back soft deleted rows, or none if one of them is not
+// deleted anymore.
+func restore(tx *gorm.DB, model any, name string, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var count int64
+	if err := tx.Unscoped().Model(model).Where("id IN ? AND deleted_at IS NOT NULL", ids).Count(&count).Error; err != nil {
+		return err
+	}
+	if int(count) != len(ids) {
+		return conflict("%d of %d %s records cannot be restored", len(ids)-int(count), len(ids), name)
+	}
+
+	return tx.Unscoped().Model(model).Where("id IN ?", ids).Update("deleted_at", nil).Error
+}
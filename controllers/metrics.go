@@ -0,0 +1,8 @@
+package controllers
+
+import "github.com/CanPacis/tstud-core/metrics"
+
+var filesIndexed = metrics.Default.Counter("tstud_files_indexed_total", "Files added to the index.")
+var filesUnindexed = metrics.Default.Counter("tstud_files_unindexed_total", "Files removed from the index.")
+var tagsCreated = metrics.Default.Counter("tstud_tags_created_total", "Tags created.")
+var searchesRun = metrics.Default.Counter("tstud_searches_total", "Searches run, by what was searched.", "kind")
@@ -0,0 +1,90 @@
+package controllers
+
+import "github.com/CanPacis/tstud-core/db"
+
+// FileRepository stores indexed files. Lookups return gorm.ErrRecordNotFound
+// for missing files and writes return gorm.ErrDuplicatedKey for paths that are
+// already indexed, whatever the backend.
+type FileRepository interface {
+	// Create inserts every file or none of them, assigning their IDs.
+	Create(files []db.File) error
+	// Get and GetByPath load the file with its tags and field values.
+	Get(id uint) (*db.File, error)
+	GetByPath(path string) (*db.File, error)
+	// Indexed returns those of paths that belong to an indexed file.
+	Indexed(paths []string) ([]string, error)
+	// Save updates the path and metadata of an existing file.
+	Save(file *db.File) error
+	Delete(id uint) error
+
+	AddTag(fileId, tagId uint) error
+	RemoveTag(fileId, tagId uint) error
+
+	// List pages through files ordered by path, last path first.
+	List(offset, limit int) ([]db.File, error)
+	Count() (int64, error)
+	// After returns up to limit files with an ID above id, with their tags,
+	// in ID order.
+	After(id uint, limit int) ([]db.File, error)
+	// Tagged pages through files carrying any of tagIds, ordered like List.
+	Tagged(tagIds []uint, offset, limit int) ([]db.File, error)
+	// Named pages through files whose name is one of names.
+	Named(names []string, offset, limit int) ([]db.File, error)
+	// Query pages through files matching every filter of query and returns
+	// the number of matching files.
+	Query(query db.FileQuery, offset, limit int) ([]db.File, int64, error)
+}
+
+// TagRepository stores tags and their aliases, with the same error
+// conventions as FileRepository.
+type TagRepository interface {
+	Create(tag *db.Tag) error
+	// Get and GetByName load the tag with its parent and aliases.
+	Get(id uint) (*db.Tag, error)
+	GetByName(name string) (*db.Tag, error)
+	Delete(id uint) error
+	SetParent(id uint, parentId *int) error
+
+	// AddAlias attaches alias to a tag, assigning its ID.
+	AddAlias(tagId uint, alias *db.Alias) error
+	DeleteAlias(id uint) error
+
+	// Children lists the tags directly under parentId, the root tags when it
+	// is nil, ordered by name, last name first.
+	Children(parentId *uint) ([]db.Tag, error)
+	All() ([]db.Tag, error)
+	// Ancestors returns the tags above id, its parent first and the root last.
+	Ancestors(id uint) ([]db.Tag, error)
+	// Descendants returns the tags below id at any depth, ordered like
+	// Children.
+	Descendants(id uint) ([]db.Tag, error)
+	// DescendantIDs returns ids and the IDs of every tag below any of them,
+	// each once.
+	DescendantIDs(ids []uint) ([]uint, error)
+	NamedIDs(names []string) ([]uint, error)
+	// AliasedIDs returns the IDs of tags with an alias named one of names.
+	AliasedIDs(names []string) ([]uint, error)
+
+	// Search and SearchAliases page through tags whose name, or one of whose
+	// aliases, contains term.
+	Search(term string, offset, limit int) ([]db.Tag, error)
+	SearchAliases(term string, offset, limit int) ([]db.Tag, error)
+}
+
+// FieldRepository stores custom field definitions and their values on files,
+// with the same error conventions as FileRepository.
+type FieldRepository interface {
+	Create(field *db.Field) error
+	GetByName(name string) (*db.Field, error)
+	// List returns every field ordered by name.
+	List() ([]db.Field, error)
+	// Delete removes a field together with its values.
+	Delete(id uint) error
+
+	Value(fileId, fieldId uint) (*db.FileField, error)
+	// Values returns every value of a field ordered by file.
+	Values(fieldId uint) ([]db.FileField, error)
+	// SetValue creates or replaces the value of a field on a file.
+	SetValue(value *db.FileField) error
+	DeleteValue(fileId, fieldId uint) error
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package controllers
+
+import "io/fs"
+
+// statIdentity is only implemented for unix, elsewhere files are identified
+// by path and hash alone.
+func statIdentity(info fs.FileInfo) (inode, device uint64) {
+	return 0, 0
+}
@@ -0,0 +1,15 @@
+//go:build unix
+
+package controllers
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+func statIdentity(info fs.FileInfo) (inode, device uint64) {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Ino), uint64(stat.Dev)
+	}
+	return 0, 0
+}
@@ -1,18 +1,31 @@
 package controllers
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/CanPacis/tstud-core/db"
+	"github.com/CanPacis/tstud-core/events"
+	"github.com/CanPacis/tstud-core/store"
 	"gorm.io/gorm"
 )
 
+var (
+	ErrTagSelfParent = errors.New("a tag cannot be its own parent")
+	ErrTagCycle      = errors.New("parent is a descendant of the tag")
+	ErrAliasNotFound = errors.New("alias not found")
+)
+
 type TagController struct {
-	DB *gorm.DB
+	Tags TagRepository
+	// Journal records changes for undo, it may be nil.
+	Journal Journal
+	// Events receives an event after every committed change, it may be nil.
+	Events *events.Bus
 }
 
-func NewTagController(db *gorm.DB) *TagController {
-	return &TagController{DB: db}
+func NewTagController(dbs *gorm.DB) *TagController {
+	return &TagController{Tags: store.NewGormTags(dbs), Journal: NewJournal(dbs)}
 }
 
 func (c *TagController) Create(name string, parent *int) (*db.TagDTO, error) {
@@ -20,51 +33,67 @@ func (c *TagController) Create(name string, parent *int) (*db.TagDTO, error) {
 		TagName:  name,
 		ParentID: parent,
 	}
-	tx := c.DB.Create(&tag)
-	return tag.ToDTO(), tx.Error
+	err := c.Tags.Create(&tag)
+	if err == nil {
+		tagsCreated.With().Inc()
+		record(c.Journal, opTagCreate, fmt.Sprintf("create tag %s", tag.TagName), tagOp{TagID: tag.ID})
+		c.Events.Publish(events.TagCreated{Tag: *tag.ToDTO()})
+	}
+	return tag.ToDTO(), err
 }
 
 func (c *TagController) Delete(id uint) (*db.TagDTO, error) {
-	var tag db.Tag
-	tx := c.DB.First(&tag, "id = ?", id)
-	if tx.Error != nil {
-		return nil, tx.Error
+	tag, err := c.Tags.Get(id)
+	if err != nil {
+		return nil, err
 	}
 
-	tx = c.DB.Delete(&tag)
-	return tag.ToDTO(), tx.Error
+	err = c.Tags.Delete(tag.ID)
+	if err == nil {
+		record(c.Journal, opTagDelete, fmt.Sprintf("delete tag %s", tag.TagName), tagOp{TagID: tag.ID})
+		c.Events.Publish(events.TagDeleted{Tag: *tag.ToDTO()})
+	}
+	return tag.ToDTO(), err
 }
 
 func (c *TagController) DeleteByName(name string) error {
-	var tag db.Tag
-
-	tx := c.DB.First(&tag, "tag_name = ?", name)
-	if tx.Error != nil {
-		return tx.Error
+	tag, err := c.Tags.GetByName(name)
+	if err != nil {
+		return err
 	}
 
-	tx = c.DB.Delete(&tag)
-	return tx.Error
+	err = c.Tags.Delete(tag.ID)
+	if err == nil {
+		record(c.Journal, opTagDelete, fmt.Sprintf("delete tag %s", tag.TagName), tagOp{TagID: tag.ID})
+		c.Events.Publish(events.TagDeleted{Tag: *tag.ToDTO()})
+	}
+	return err
 }
 
 func (c *TagController) Alias(id uint, alias string) error {
-	var tag db.Tag
+	tag, err := c.Tags.Get(id)
+	if err != nil {
+		return err
+	}
 
-	tx := c.DB.First(&tag, "id = ?", id)
-	if tx.Error != nil {
-		return tx.Error
+	created := db.Alias{Name: alias}
+	err = c.Tags.AddAlias(tag.ID, &created)
+	if err != nil {
+		return err
 	}
 
-	return c.DB.Model(&tag).Association("Aliases").Append(&db.Alias{Name: alias})
+	record(c.Journal, opTagAlias, fmt.Sprintf("alias %s as %s", tag.TagName, alias), aliasOp{TagID: tag.ID, AliasID: created.ID, Name: alias})
+
+	c.Events.Publish(events.AliasAdded{Tag: *tag.ToDTO(), Alias: alias})
+	return nil
 }
 
 func (c *TagController) Unlias(id uint, aliasName string) error {
-	var tag db.Tag
 	var alias db.Alias
 
-	tx := c.DB.Preload("Aliases").First(&tag, "id = ?", id)
-	if tx.Error != nil {
-		return tx.Error
+	tag, err := c.Tags.Get(id)
+	if err != nil {
+		return err
 	}
 
 	for _, a := range tag.Aliases {
@@ -74,52 +103,93 @@ func (c *TagController) Unlias(id uint, aliasName string) error {
 	}
 
 	if alias.ID == 0 {
-		return fmt.Errorf("tag %s does not have any alias named %s", tag.TagName, aliasName)
+		return fmt.Errorf("%w: tag %s does not have any alias named %s", ErrAliasNotFound, tag.TagName, aliasName)
 	}
 
-	tx = c.DB.Delete(&alias)
-	return tx.Error
+	err = c.Tags.DeleteAlias(alias.ID)
+	if err == nil {
+		record(c.Journal, opTagUnalias, fmt.Sprintf("remove alias %s from %s", aliasName, tag.TagName), aliasOp{TagID: tag.ID, AliasID: alias.ID, Name: aliasName})
+		c.Events.Publish(events.AliasRemoved{Tag: *tag.ToDTO(), Alias: aliasName})
+	}
+	return err
 }
 
-func (c *TagController) List(parent *int) (*PaginatedResource, error) {
-	var tags []db.Tag
+// checkParent reports whether parentId may become the parent of tagId.
+func checkParent(tags TagRepository, tagId, parentId uint) error {
+	if parentId == tagId {
+		return ErrTagSelfParent
+	}
+
+	if _, err := tags.Get(parentId); err != nil {
+		return err
+	}
+
+	// The tag being above its new parent would make it its own ancestor.
+	ancestors, err := tags.Ancestors(parentId)
+	if err != nil {
+		return err
+	}
+	for _, ancestor := range ancestors {
+		if ancestor.ID == tagId {
+			return ErrTagCycle
+		}
+	}
+	return nil
+}
 
-	var tx *gorm.DB
-
-	if parent == nil {
-		tx = c.DB.
-			Order("tag_name desc").
-			Preload("Parent").
-			Preload("Aliases").
-			Find(&tags, "parent_id IS NULL")
-	} else {
-		if *parent < 0 {
-			tx = c.DB.
-				Order("tag_name desc").
-				Preload("Parent").
-				Preload("Aliases").
-				Find(&tags)
-		} else {
-			tx = c.DB.
-				Order("tag_name desc").
-				Preload("Parent").
-				Preload("Aliases").
-				Find(&tags, "parent_id = ?", *parent)
+// SetParent moves a tag under parentId. A nil parentId detaches the tag to
+// the root.
+func (c *TagController) SetParent(tagId uint, parentId *uint) (*db.TagDTO, error) {
+	tag, err := c.Tags.Get(tagId)
+	if err != nil {
+		return nil, err
+	}
+
+	oldParent := tag.ParentID
+
+	var parent *int
+	if parentId != nil {
+		if err := checkParent(c.Tags, tagId, *parentId); err != nil {
+			return nil, err
 		}
+
+		id := int(*parentId)
+		parent = &id
 	}
 
-	if tx.Error != nil {
-		return nil, tx.Error
+	if err := c.Tags.SetParent(tagId, parent); err != nil {
+		return nil, err
 	}
 
-	var count int64
-	tx = c.DB.Model(&db.Tag{}).Count(&count)
-	if tx.Error != nil {
-		return nil, tx.Error
+	tag, err = c.Tags.Get(tagId)
+	if err != nil {
+		return nil, err
 	}
 
-	result := &PaginatedResource{
-		Items:      []any{},
+	record(c.Journal, opTagParent, fmt.Sprintf("move tag %s", tag.TagName), tagParentOp{TagID: tag.ID, OldParent: oldParent, NewParent: parent})
+	c.Events.Publish(events.TagReparented{Tag: *tag.ToDTO(), OldParentID: oldParent})
+	return tag.ToDTO(), nil
+}
+
+func (c *TagController) List(parent *int) (*PaginatedResource[db.TagDTO], error) {
+	var tags []db.Tag
+	var err error
+
+	switch {
+	case parent == nil:
+		tags, err = c.Tags.Children(nil)
+	case *parent < 0:
+		tags, err = c.Tags.All()
+	default:
+		id := uint(*parent)
+		tags, err = c.Tags.Children(&id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PaginatedResource[db.TagDTO]{
+		Items:      []db.TagDTO{},
 		Page:       0,
 		TotalPages: 1,
 	}
@@ -131,44 +201,73 @@ func (c *TagController) List(parent *int) (*PaginatedResource, error) {
 	return result, nil
 }
 
-func (c *TagController) Search(term string, options ListOptions) (*PaginatedResource, error) {
-	var tags []db.Tag
-	query := c.DB.Preload("Parent").Preload("Aliases").Limit(options.PerPage).Offset(options.PerPage * options.Page)
-	tx := query.Find(&tags, "tag_name LIKE ?", fmt.Sprintf("%%%s%%", term))
-	if tx.Error != nil {
-		return nil, tx.Error
+// Ancestors lists the tags above a tag, its parent first and the root last.
+func (c *TagController) Ancestors(id uint) (*PaginatedResource[db.TagDTO], error) {
+	if _, err := c.Tags.Get(id); err != nil {
+		return nil, err
+	}
+
+	tags, err := c.Tags.Ancestors(id)
+	if err != nil {
+		return nil, err
+	}
+	return tagResource(tags), nil
+}
+
+// Descendants lists every tag below a tag, at any depth.
+func (c *TagController) Descendants(id uint) (*PaginatedResource[db.TagDTO], error) {
+	if _, err := c.Tags.Get(id); err != nil {
+		return nil, err
+	}
+
+	tags, err := c.Tags.Descendants(id)
+	if err != nil {
+		return nil, err
+	}
+	return tagResource(tags), nil
+}
+
+func tagResource(tags []db.Tag) *PaginatedResource[db.TagDTO] {
+	result := &PaginatedResource[db.TagDTO]{
+		Items:      []db.TagDTO{},
+		Page:       0,
+		TotalPages: 1,
 	}
 
-	items := []any{}
 	for _, tag := range tags {
-		items = append(items, *tag.ToDTO())
+		result.Items = append(result.Items, *tag.ToDTO())
 	}
+	return result
+}
+
+func (c *TagController) Search(term string, options ListOptions) (*PaginatedResource[db.TagDTO], error) {
+	searchesRun.With("tag").Inc()
+	options = options.paged()
+	offset := options.PerPage * options.Page
 
-	var aliases []db.Alias
-	tx = c.DB.Find(&aliases, "name LIKE ?", fmt.Sprintf("%%%s%%", term))
-	if tx.Error != nil {
-		return nil, tx.Error
+	tags, err := c.Tags.Search(term, offset, options.PerPage)
+	if err != nil {
+		return nil, err
 	}
 
-	aliasedTagIds := []uint{}
-	for _, alias := range aliases {
-		aliasedTagIds = append(aliasedTagIds, alias.TagID)
+	items := []db.TagDTO{}
+	for _, tag := range tags {
+		items = append(items, *tag.ToDTO())
 	}
 
-	query = c.DB.Preload("Parent").Preload("Aliases").Limit(options.PerPage).Offset(options.PerPage * options.Page)
-	tx = query.Find(&tags, "id IN ?", aliasedTagIds)
-	if tx.Error != nil {
-		return nil, tx.Error
+	tags, err = c.Tags.SearchAliases(term, offset, options.PerPage)
+	if err != nil {
+		return nil, err
 	}
 
 	for _, tag := range tags {
 		items = append(items, *tag.ToDTO())
 	}
 
-	result := &PaginatedResource{
+	result := &PaginatedResource[db.TagDTO]{
 		Items:      items,
 		Page:       options.Page,
-		TotalPages: len(tags)/options.PerPage + 1,
+		TotalPages: pageCount(int64(len(items)), options.PerPage),
 	}
 
 	return result, nil
@@ -1,7 +1,10 @@
 package db
 
 import (
+	"encoding/json"
 	"path/filepath"
+	"slices"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -14,6 +17,15 @@ type File struct {
 	Author      string
 	State       int   `gorm:"check: state IN (0,1);default: 0"`
 	Tags        []Tag `gorm:"many2many:file_tags;"`
+	Fields      []FileField
+
+	// Stat data and content hash at index time. SHA256 is empty when the
+	// file was too large to hash or could not be read.
+	Size    int64
+	ModTime *time.Time
+	Inode   uint64
+	Device  uint64
+	SHA256  string `gorm:"column:sha256;index"`
 }
 
 func (f File) Name() string {
@@ -27,6 +39,14 @@ func (f File) ToDTO() *FileDTO {
 		tags = append(tags, *tag.ToDTO())
 	}
 
+	fields := map[string]any{}
+	for _, field := range f.Fields {
+		// Values of deleted fields are skipped.
+		if field.Field.ID != 0 {
+			fields[field.Field.Name] = field.Typed()
+		}
+	}
+
 	return &FileDTO{
 		ID:          f.ID,
 		FilePath:    f.FilePath,
@@ -35,6 +55,12 @@ func (f File) ToDTO() *FileDTO {
 		Description: f.Description,
 		Author:      f.Author,
 		Tags:        tags,
+		Fields:      fields,
+		Size:        f.Size,
+		ModTime:     f.ModTime,
+		Inode:       f.Inode,
+		Device:      f.Device,
+		SHA256:      f.SHA256,
 	}
 }
 
@@ -88,6 +114,13 @@ type FileDTO struct {
 	Description string   `json:"description"`
 	Author      string   `json:"author"`
 	Tags        []TagDTO `json:"tags"`
+	// Fields maps custom field names to strings, numbers or booleans.
+	Fields  map[string]any `json:"fields"`
+	Size    int64          `json:"size"`
+	ModTime *time.Time     `json:"mod_time"`
+	Inode   uint64         `json:"inode"`
+	Device  uint64         `json:"device"`
+	SHA256  string         `json:"sha256"`
 }
 
 type TagDTO struct {
@@ -102,3 +135,178 @@ type AliasDTO struct {
 	Name  string `json:"name"`
 	TagID uint   `json:"tag_id"`
 }
+
+type Job struct {
+	gorm.Model
+	Kind            string `gorm:"index"`
+	State           string `gorm:"index"`
+	Params          []byte
+	Result          []byte
+	Error           string
+	Done            int
+	Total           int
+	CancelRequested bool
+	StartedAt       *time.Time
+	FinishedAt      *time.Time
+}
+
+func (j Job) ToDTO() *JobDTO {
+	return &JobDTO{
+		ID:         j.ID,
+		Kind:       j.Kind,
+		State:      j.State,
+		Params:     rawJSON(j.Params),
+		Result:     rawJSON(j.Result),
+		Error:      j.Error,
+		Done:       j.Done,
+		Total:      j.Total,
+		CreatedAt:  j.CreatedAt,
+		StartedAt:  j.StartedAt,
+		FinishedAt: j.FinishedAt,
+	}
+}
+
+func rawJSON(b []byte) json.RawMessage {
+	if len(b) == 0 {
+		return nil
+	}
+	return json.RawMessage(b)
+}
+
+type JobDTO struct {
+	ID         uint            `json:"id"`
+	Kind       string          `json:"kind"`
+	State      string          `json:"state"`
+	Params     json.RawMessage `json:"params,omitempty"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Done       int             `json:"done"`
+	Total      int             `json:"total"`
+	CreatedAt  time.Time       `json:"created_at"`
+	StartedAt  *time.Time      `json:"started_at"`
+	FinishedAt *time.Time      `json:"finished_at"`
+}
+
+// Operation is an entry of the undo journal. Payload holds what is needed to
+// reverse and reapply the change.
+type Operation struct {
+	gorm.Model
+	Kind        string
+	Description string
+	Payload     []byte
+	State       string `gorm:"index"`
+}
+
+func (o Operation) ToDTO() *OperationDTO {
+	return &OperationDTO{
+		ID:          o.ID,
+		Kind:        o.Kind,
+		Description: o.Description,
+		State:       o.State,
+		CreatedAt:   o.CreatedAt,
+	}
+}
+
+type OperationDTO struct {
+	ID          uint      `json:"id"`
+	Kind        string    `json:"kind"`
+	Description string    `json:"description"`
+	State       string    `json:"state"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+const (
+	FieldString  = "string"
+	FieldNumber  = "number"
+	FieldDate    = "date"
+	FieldURL     = "url"
+	FieldBoolean = "boolean"
+	FieldEnum    = "enum"
+)
+
+// BuiltinFields are columns of the file itself. Queries take them as string
+// fields without an ID, a file with an empty column has no value.
+var BuiltinFields = []string{"author", "description"}
+
+// Field defines a custom metadata field. Values lists the allowed values of
+// an enum field as a JSON array.
+type Field struct {
+	gorm.Model
+	Name   string `gorm:"unique"`
+	Type   string
+	Values []byte
+}
+
+func (f Field) Choices() []string {
+	choices := []string{}
+	json.Unmarshal(f.Values, &choices)
+	return choices
+}
+
+// Builtin reports whether f stands for one of BuiltinFields.
+func (f Field) Builtin() bool {
+	return f.ID == 0 && slices.Contains(BuiltinFields, f.Name)
+}
+
+// Numeric reports whether values of the field are compared by Number.
+func (f Field) Numeric() bool {
+	return f.Type == FieldNumber || f.Type == FieldDate || f.Type == FieldBoolean
+}
+
+func (f Field) ToDTO() *FieldDTO {
+	return &FieldDTO{
+		ID:     f.ID,
+		Name:   f.Name,
+		Type:   f.Type,
+		Values: f.Choices(),
+	}
+}
+
+// FileField is the value of a field on a file. Value is the canonical text
+// form, Number is set for numeric fields so they sort and compare as numbers.
+type FileField struct {
+	FileID  uint `gorm:"primaryKey"`
+	FieldID uint `gorm:"primaryKey"`
+	Field   Field
+	Value   string
+	Number  *float64
+}
+
+// Typed returns the value as the JSON type matching the field.
+func (f FileField) Typed() any {
+	switch f.Field.Type {
+	case FieldNumber:
+		if f.Number != nil {
+			return *f.Number
+		}
+	case FieldBoolean:
+		return f.Value == "true"
+	}
+	return f.Value
+}
+
+type FieldDTO struct {
+	ID     uint     `json:"id"`
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`
+	Values []string `json:"values"`
+}
+
+// FieldFilter compares a field with Value, which is already in its canonical
+// form. Op is one of =, !=, <, <=, >, >= or ~ for contains.
+type FieldFilter struct {
+	Field Field
+	Op    string
+	Value FileField
+}
+
+// FileQuery selects files by their field values.
+type FileQuery struct {
+	// FileIDs limits the query to these files, nil queries every file.
+	FileIDs []uint
+	Filters []FieldFilter
+	// Sort orders by a field, files without a value come last. Files are
+	// ordered by path otherwise.
+	Sort *Field
+	Desc bool
+}
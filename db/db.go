@@ -1,39 +1,55 @@
 package db
 
 import (
-	"os"
-	"os/user"
-	"path/filepath"
-
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
-func Connect() (*gorm.DB, error) {
-	usr, err := user.Current()
+// Open connects to the database at path and applies pending migrations.
+func Open(path string) (*gorm.DB, error) {
+	db, err := OpenUnmigrated(path)
 	if err != nil {
 		return nil, err
 	}
 
-	path := "tstud.db"
-	if os.Getenv("TSTUD_ENV") == "development" {
-		path = filepath.Join("./", path)
-	} else {
-		path = filepath.Join(usr.HomeDir, path)
+	if _, _, err := Up(db, 0); err != nil {
+		if sqlDB, derr := db.DB(); derr == nil {
+			sqlDB.Close()
+		}
+		return nil, err
 	}
 
-	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{
-		Logger:         logger.Default.LogMode(logger.Silent),
-		TranslateError: true,
-	})
+	return db, nil
+}
+
+// OpenMemory opens a migrated database that only lives as long as the
+// returned connection.
+func OpenMemory() (*gorm.DB, error) {
+	db, err := OpenUnmigrated(":memory:")
 	if err != nil {
 		return nil, err
 	}
 
-	if err := db.AutoMigrate(&File{}, &Tag{}, &Alias{}); err != nil {
+	// Every connection to :memory: is a database of its own.
+	sqlDB, err := db.DB()
+	if err != nil {
 		return nil, err
 	}
+	sqlDB.SetMaxOpenConns(1)
 
+	if _, _, err := Up(db, 0); err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
 	return db, nil
 }
+
+// OpenUnmigrated connects without touching the schema, for tools that
+// manage migrations themselves.
+func OpenUnmigrated(path string) (*gorm.DB, error) {
+	return gorm.Open(sqlite.Open(path), &gorm.Config{
+		Logger:         logger.Default.LogMode(logger.Silent),
+		TranslateError: true,
+	})
+}
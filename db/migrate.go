@@ -0,0 +1,229 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrSchemaTooNew = errors.New("database schema is newer than this build")
+
+// Migration moves the schema one version forward with Up and back with Down.
+// Destructive migrations alter tables that already hold data, the database
+// is backed up before they run.
+type Migration struct {
+	Version     int
+	Name        string
+	Destructive bool
+	Up          func(tx *gorm.DB) error
+	Down        func(tx *gorm.DB) error
+}
+
+type schemaMigration struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// exec returns a migration step that runs statements in order.
+func exec(statements ...string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+func (s MigrationStatus) Applied() bool {
+	return s.AppliedAt != nil
+}
+
+// Latest is the version the schema has after every migration ran.
+func Latest() int {
+	if len(Migrations) == 0 {
+		return 0
+	}
+	return Migrations[len(Migrations)-1].Version
+}
+
+func applied(dbs *gorm.DB) (map[int]schemaMigration, error) {
+	if err := dbs.AutoMigrate(&schemaMigration{}); err != nil {
+		return nil, err
+	}
+
+	var rows []schemaMigration
+	if err := dbs.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	result := map[int]schemaMigration{}
+	for _, row := range rows {
+		result[row.Version] = row
+	}
+	return result, nil
+}
+
+// Version returns the highest applied migration.
+func Version(dbs *gorm.DB) (int, error) {
+	done, err := applied(dbs)
+	if err != nil {
+		return 0, err
+	}
+
+	version := 0
+	for v := range done {
+		version = max(version, v)
+	}
+	return version, nil
+}
+
+// Status lists every known migration and whether it was applied.
+func Status(dbs *gorm.DB) ([]MigrationStatus, error) {
+	done, err := applied(dbs)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []MigrationStatus{}
+	for _, m := range Migrations {
+		status := MigrationStatus{Migration: m}
+		if row, ok := done[m.Version]; ok {
+			status.AppliedAt = &row.AppliedAt
+		}
+		result = append(result, status)
+	}
+	return result, nil
+}
+
+// Up applies pending migrations up to and including target, every pending
+// migration when target is 0. It returns the migrations that ran and the
+// path of the backup taken, if any.
+func Up(dbs *gorm.DB, target int) ([]Migration, string, error) {
+	version, err := Version(dbs)
+	if err != nil {
+		return nil, "", err
+	}
+	if version > Latest() {
+		return nil, "", fmt.Errorf("%w: version %d, this build knows up to %d", ErrSchemaTooNew, version, Latest())
+	}
+	if target == 0 {
+		target = Latest()
+	}
+
+	pending := []Migration{}
+	destructive := false
+	for _, m := range Migrations {
+		if m.Version > version && m.Version <= target {
+			pending = append(pending, m)
+			destructive = destructive || m.Destructive
+		}
+	}
+
+	backup := ""
+	if destructive && version > 0 {
+		if backup, err = Backup(dbs, version); err != nil {
+			return nil, "", err
+		}
+	}
+
+	ran := []Migration{}
+	for _, m := range pending {
+		err := dbs.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&schemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return ran, backup, fmt.Errorf("migration %d %s: %w", m.Version, m.Name, err)
+		}
+		ran = append(ran, m)
+	}
+	return ran, backup, nil
+}
+
+// Down reverts applied migrations above target, newest first. Reverting
+// always drops something, so the database is backed up first.
+func Down(dbs *gorm.DB, target int) ([]Migration, string, error) {
+	done, err := applied(dbs)
+	if err != nil {
+		return nil, "", err
+	}
+	version, err := Version(dbs)
+	if err != nil {
+		return nil, "", err
+	}
+
+	pending := []Migration{}
+	for i := len(Migrations) - 1; i >= 0; i-- {
+		m := Migrations[i]
+		if _, ok := done[m.Version]; ok && m.Version > target {
+			pending = append(pending, m)
+		}
+	}
+	if len(pending) == 0 {
+		return nil, "", nil
+	}
+
+	backup, err := Backup(dbs, version)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ran := []Migration{}
+	for _, m := range pending {
+		err := dbs.Transaction(func(tx *gorm.DB) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&schemaMigration{}, "version = ?", m.Version).Error
+		})
+		if err != nil {
+			return ran, backup, fmt.Errorf("migration %d %s: %w", m.Version, m.Name, err)
+		}
+		ran = append(ran, m)
+	}
+	return ran, backup, nil
+}
+
+// Backup copies the database next to itself, named after the schema version
+// and the time. In-memory databases are not backed up.
+func Backup(dbs *gorm.DB, version int) (string, error) {
+	var databases []struct {
+		Name string
+		File string
+	}
+	if err := dbs.Raw("PRAGMA database_list").Scan(&databases).Error; err != nil {
+		return "", err
+	}
+
+	path := ""
+	for _, d := range databases {
+		if d.Name == "main" {
+			path = d.File
+		}
+	}
+	if len(path) == 0 {
+		return "", nil
+	}
+
+	backup := fmt.Sprintf("%s.v%d-%s.bak", path, version, time.Now().Format("20060102-150405"))
+	if err := dbs.Exec("VACUUM INTO ?", backup).Error; err != nil {
+		return "", fmt.Errorf("could not back up %s: %w", path, err)
+	}
+	return backup, nil
+}
@@ -0,0 +1,142 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func openFile(t *testing.T, path string) *gorm.DB {
+	t.Helper()
+	dbs, err := OpenUnmigrated(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := dbs.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return dbs
+}
+
+func versions(t *testing.T, dbs *gorm.DB) []int {
+	t.Helper()
+	var rows []schemaMigration
+	if err := dbs.Order("version").Find(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	result := []int{}
+	for _, row := range rows {
+		result = append(result, row.Version)
+	}
+	return result
+}
+
+func upTo(version int) []int {
+	result := []int{}
+	for _, m := range Migrations {
+		if m.Version <= version {
+			result = append(result, m.Version)
+		}
+	}
+	return result
+}
+
+func checkBackup(t *testing.T, path, backup string, version int) {
+	t.Helper()
+	if !strings.HasPrefix(backup, path+".v") {
+		t.Fatalf("backup %q is not next to %s", backup, path)
+	}
+	if _, err := os.Stat(backup); err != nil {
+		t.Fatal(err)
+	}
+	if got := versions(t, openFile(t, backup)); !slices.Equal(got, upTo(version)) {
+		t.Errorf("backup has versions %v, expected %v", got, upTo(version))
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tstud.db")
+	dbs := openFile(t, path)
+
+	ran, backup, err := Up(dbs, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ran) != 3 || backup != "" {
+		t.Errorf("up to 3: ran %d migrations, backup %q", len(ran), backup)
+	}
+	if got := versions(t, dbs); !slices.Equal(got, upTo(3)) {
+		t.Errorf("got versions %v, expected %v", got, upTo(3))
+	}
+	if err := dbs.Exec("INSERT INTO files (file_path) VALUES ('/a.txt')").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Migration 4 alters files, so the database at version 3 is kept.
+	ran, backup, err = Up(dbs, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ran) != len(Migrations)-3 {
+		t.Errorf("up: ran %d migrations", len(ran))
+	}
+	checkBackup(t, path, backup, 3)
+	if got := versions(t, dbs); !slices.Equal(got, upTo(Latest())) {
+		t.Errorf("got versions %v, expected %v", got, upTo(Latest()))
+	}
+
+	ran, backup, err = Up(dbs, 0)
+	if err != nil || len(ran) != 0 || backup != "" {
+		t.Errorf("up again: ran %d migrations, backup %q, error %v", len(ran), backup, err)
+	}
+
+	ran, backup, err = Down(dbs, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ran) != len(Migrations)-3 || ran[0].Version != Latest() {
+		t.Errorf("down: ran %v", ran)
+	}
+	checkBackup(t, path, backup, Latest())
+	if got := versions(t, dbs); !slices.Equal(got, upTo(3)) {
+		t.Errorf("got versions %v, expected %v", got, upTo(3))
+	}
+
+	var count int64
+	if err := dbs.Table("files").Count(&count).Error; err != nil || count != 1 {
+		t.Errorf("files after down: %d %v", count, err)
+	}
+	if dbs.Migrator().HasColumn("files", "sha256") || dbs.Migrator().HasTable("fields") {
+		t.Error("down left the reverted schema behind")
+	}
+}
+
+func TestMigrateTooNew(t *testing.T) {
+	dbs := openFile(t, filepath.Join(t.TempDir(), "tstud.db"))
+	if _, _, err := Up(dbs, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbs.Create(&schemaMigration{Version: Latest() + 1}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Up(dbs, 0); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("got %v, expected %v", err, ErrSchemaTooNew)
+	}
+}
+
+func TestBackupMemory(t *testing.T) {
+	dbs, err := OpenMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backup, err := Backup(dbs, Latest()); err != nil || backup != "" {
+		t.Errorf("got %q %v, expected no backup", backup, err)
+	}
+}
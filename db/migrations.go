@@ -0,0 +1,90 @@
+package db
+
+// Migrations is the schema history, in order. Append new migrations, never
+// edit one that was released. The first ones use IF NOT EXISTS so databases
+// created before migrations existed are adopted as they are.
+var Migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create files and tags",
+		Up: exec(
+			"CREATE TABLE IF NOT EXISTS `files` (`id` integer PRIMARY KEY AUTOINCREMENT,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`file_path` text,`mime_type` text,`description` text,`author` text,`state` integer DEFAULT 0,CONSTRAINT `uni_files_file_path` UNIQUE (`file_path`),CONSTRAINT `chk_files_state` CHECK ( state IN (0,1)))",
+			"CREATE INDEX IF NOT EXISTS `idx_files_file_path` ON `files`(`file_path`)",
+			"CREATE INDEX IF NOT EXISTS `idx_files_deleted_at` ON `files`(`deleted_at`)",
+			"CREATE TABLE IF NOT EXISTS `tags` (`id` integer PRIMARY KEY AUTOINCREMENT,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`tag_name` text,`parent_id` integer,CONSTRAINT `fk_tags_parent` FOREIGN KEY (`parent_id`) REFERENCES `tags`(`id`) ON DELETE SET NULL ON UPDATE CASCADE)",
+			"CREATE INDEX IF NOT EXISTS `idx_tags_deleted_at` ON `tags`(`deleted_at`)",
+			"CREATE TABLE IF NOT EXISTS `file_tags` (`file_id` integer,`tag_id` integer,PRIMARY KEY (`file_id`,`tag_id`),CONSTRAINT `fk_file_tags_file` FOREIGN KEY (`file_id`) REFERENCES `files`(`id`),CONSTRAINT `fk_file_tags_tag` FOREIGN KEY (`tag_id`) REFERENCES `tags`(`id`))",
+			"CREATE TABLE IF NOT EXISTS `aliases` (`id` integer PRIMARY KEY AUTOINCREMENT,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`name` text,`tag_id` integer,CONSTRAINT `fk_tags_aliases` FOREIGN KEY (`tag_id`) REFERENCES `tags`(`id`))",
+			"CREATE INDEX IF NOT EXISTS `idx_aliases_deleted_at` ON `aliases`(`deleted_at`)",
+		),
+		Down: exec(
+			"DROP TABLE IF EXISTS `aliases`",
+			"DROP TABLE IF EXISTS `file_tags`",
+			"DROP TABLE IF EXISTS `tags`",
+			"DROP TABLE IF EXISTS `files`",
+		),
+	},
+	{
+		Version: 2,
+		Name:    "create jobs",
+		Up: exec(
+			"CREATE TABLE IF NOT EXISTS `jobs` (`id` integer PRIMARY KEY AUTOINCREMENT,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`kind` text,`state` text,`params` blob,`result` blob,`error` text,`done` integer,`total` integer,`cancel_requested` numeric,`started_at` datetime,`finished_at` datetime)",
+			"CREATE INDEX IF NOT EXISTS `idx_jobs_state` ON `jobs`(`state`)",
+			"CREATE INDEX IF NOT EXISTS `idx_jobs_kind` ON `jobs`(`kind`)",
+			"CREATE INDEX IF NOT EXISTS `idx_jobs_deleted_at` ON `jobs`(`deleted_at`)",
+		),
+		Down: exec("DROP TABLE IF EXISTS `jobs`"),
+	},
+	{
+		Version: 3,
+		Name:    "create operations",
+		Up: exec(
+			"CREATE TABLE IF NOT EXISTS `operations` (`id` integer PRIMARY KEY AUTOINCREMENT,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`kind` text,`description` text,`payload` blob,`state` text)",
+			"CREATE INDEX IF NOT EXISTS `idx_operations_deleted_at` ON `operations`(`deleted_at`)",
+			"CREATE INDEX IF NOT EXISTS `idx_operations_state` ON `operations`(`state`)",
+		),
+		Down: exec("DROP TABLE IF EXISTS `operations`"),
+	},
+	{
+		Version:     4,
+		Name:        "add file fingerprints",
+		Destructive: true,
+		Up: exec(
+			"ALTER TABLE `files` ADD COLUMN `size` integer",
+			"ALTER TABLE `files` ADD COLUMN `mod_time` datetime",
+			"ALTER TABLE `files` ADD COLUMN `inode` integer",
+			"ALTER TABLE `files` ADD COLUMN `device` integer",
+			"ALTER TABLE `files` ADD COLUMN `sha256` text",
+			"CREATE INDEX `idx_files_sha256` ON `files`(`sha256`)",
+		),
+		Down: exec(
+			"DROP INDEX `idx_files_sha256`",
+			"ALTER TABLE `files` DROP COLUMN `sha256`",
+			"ALTER TABLE `files` DROP COLUMN `device`",
+			"ALTER TABLE `files` DROP COLUMN `inode`",
+			"ALTER TABLE `files` DROP COLUMN `mod_time`",
+			"ALTER TABLE `files` DROP COLUMN `size`",
+		),
+	},
+	{
+		Version: 5,
+		Name:    "create custom fields",
+		Up: exec(
+			"CREATE TABLE `fields` (`id` integer PRIMARY KEY AUTOINCREMENT,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`name` text,`type` text,`values` blob,CONSTRAINT `uni_fields_name` UNIQUE (`name`))",
+			"CREATE INDEX `idx_fields_deleted_at` ON `fields`(`deleted_at`)",
+			"CREATE TABLE `file_fields` (`file_id` integer,`field_id` integer,`value` text,`number` real,PRIMARY KEY (`file_id`,`field_id`),CONSTRAINT `fk_files_fields` FOREIGN KEY (`file_id`) REFERENCES `files`(`id`),CONSTRAINT `fk_file_fields_field` FOREIGN KEY (`field_id`) REFERENCES `fields`(`id`))",
+			"CREATE INDEX `idx_file_fields_value` ON `file_fields`(`field_id`,`value`)",
+			"CREATE INDEX `idx_file_fields_number` ON `file_fields`(`field_id`,`number`)",
+		),
+		Down: exec(
+			"DROP TABLE `file_fields`",
+			"DROP TABLE `fields`",
+		),
+	},
+	{
+		Version: 6,
+		Name:    "index tag parents",
+		Up:      exec("CREATE INDEX `idx_tags_parent_id` ON `tags`(`parent_id`,`deleted_at`)"),
+		Down:    exec("DROP INDEX `idx_tags_parent_id`"),
+	},
+}
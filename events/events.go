@@ -0,0 +1,100 @@
+// Package events is an in-process bus for domain events. Controllers publish
+// an event after each committed change, subscribers receive them on their own
+// goroutine so they never slow down writers.
+package events
+
+import (
+	"sync"
+
+	"github.com/CanPacis/tstud-core/metrics"
+)
+
+// DefaultBuffer is the number of events a subscriber may fall behind before
+// new events are dropped for it.
+const DefaultBuffer = 256
+
+var dropped = metrics.Default.Counter("tstud_events_dropped_total", "Events dropped because a subscriber fell behind.", "event")
+
+type Event interface {
+	EventName() string
+}
+
+type Bus struct {
+	mu     sync.RWMutex
+	nextID int
+	subs   map[int]*Subscription
+}
+
+func NewBus() *Bus {
+	return &Bus{subs: map[int]*Subscription{}}
+}
+
+type Subscription struct {
+	bus  *Bus
+	id   int
+	ch   chan Event
+	once sync.Once
+}
+
+// C returns the channel events are delivered on. It is closed by Close.
+func (s *Subscription) C() <-chan Event {
+	return s.ch
+}
+
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.bus.mu.Lock()
+		delete(s.bus.subs, s.id)
+		s.bus.mu.Unlock()
+		close(s.ch)
+	})
+}
+
+// Subscribe returns a subscription that receives every event published from
+// now on. Events are dropped for the subscription while its buffer is full.
+func (b *Bus) Subscribe(buffer int) *Subscription {
+	if buffer <= 0 {
+		buffer = DefaultBuffer
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	s := &Subscription{bus: b, id: b.nextID, ch: make(chan Event, buffer)}
+	b.subs[s.id] = s
+	return s
+}
+
+// Publish delivers e to every subscriber without blocking. Publishing on a
+// nil bus does nothing, so controllers work without one.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, s := range b.subs {
+		select {
+		case s.ch <- e:
+		default:
+			dropped.With(e.EventName()).Inc()
+		}
+	}
+}
+
+// On calls fn for every event of type T on its own goroutine until the
+// returned function is called.
+func On[T Event](b *Bus, fn func(T)) func() {
+	s := b.Subscribe(DefaultBuffer)
+	go func() {
+		for e := range s.C() {
+			if typed, ok := e.(T); ok {
+				fn(typed)
+			}
+		}
+	}()
+	return s.Close
+}
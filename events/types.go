@@ -0,0 +1,75 @@
+package events
+
+import "github.com/CanPacis/tstud-core/db"
+
+type FileIndexed struct {
+	File db.FileDTO `json:"file"`
+}
+
+type FileUnindexed struct {
+	File db.FileDTO `json:"file"`
+}
+
+type FileRenamed struct {
+	File    db.FileDTO `json:"file"`
+	OldPath string     `json:"old_path"`
+}
+
+type FileTagged struct {
+	File db.FileDTO `json:"file"`
+	Tag  db.TagDTO  `json:"tag"`
+}
+
+type FileUntagged struct {
+	File db.FileDTO `json:"file"`
+	Tag  db.TagDTO  `json:"tag"`
+}
+
+type FileMetaChanged struct {
+	File db.FileDTO `json:"file"`
+}
+
+type TagCreated struct {
+	Tag db.TagDTO `json:"tag"`
+}
+
+type TagDeleted struct {
+	Tag db.TagDTO `json:"tag"`
+}
+
+type TagReparented struct {
+	Tag         db.TagDTO `json:"tag"`
+	OldParentID *int      `json:"old_parent_id"`
+}
+
+type AliasAdded struct {
+	Tag   db.TagDTO `json:"tag"`
+	Alias string    `json:"alias"`
+}
+
+type AliasRemoved struct {
+	Tag   db.TagDTO `json:"tag"`
+	Alias string    `json:"alias"`
+}
+
+type FieldCreated struct {
+	Field db.FieldDTO `json:"field"`
+}
+
+type FieldDeleted struct {
+	Field db.FieldDTO `json:"field"`
+}
+
+func (FileIndexed) EventName() string     { return "file.indexed" }
+func (FileUnindexed) EventName() string   { return "file.unindexed" }
+func (FileRenamed) EventName() string     { return "file.renamed" }
+func (FileTagged) EventName() string      { return "file.tagged" }
+func (FileUntagged) EventName() string    { return "file.untagged" }
+func (FileMetaChanged) EventName() string { return "file.meta_changed" }
+func (TagCreated) EventName() string      { return "tag.created" }
+func (TagDeleted) EventName() string      { return "tag.deleted" }
+func (TagReparented) EventName() string   { return "tag.reparented" }
+func (AliasAdded) EventName() string      { return "tag.alias_added" }
+func (AliasRemoved) EventName() string    { return "tag.alias_removed" }
+func (FieldCreated) EventName() string    { return "field.created" }
+func (FieldDeleted) EventName() string    { return "field.deleted" }
@@ -0,0 +1,405 @@
+// Package jobs runs long operations in the background. Jobs are persisted, so
+// a frontend can start one, disconnect and check on it later, and jobs that
+// were cut short by a shutdown start over with the next runner. Runners keep
+// the jobs they run alive with a heartbeat, a running job without one is
+// queued again.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/CanPacis/tstud-core/db"
+	"gorm.io/gorm"
+)
+
+const (
+	StateQueued   = "queued"
+	StateRunning  = "running"
+	StateDone     = "done"
+	StateFailed   = "failed"
+	StateCanceled = "canceled"
+)
+
+var (
+	ErrUnknownKind = errors.New("unknown job kind")
+	ErrFinished    = errors.New("job already finished")
+)
+
+// Func does the work of a job. It should stop when ctx is canceled and report
+// progress as it goes. The returned value is stored as the job's result.
+type Func func(ctx context.Context, params json.RawMessage, progress func(done, total int)) (any, error)
+
+type Runner struct {
+	DB *gorm.DB
+	// PollInterval is how often the runner looks for new jobs and for
+	// cancellations requested by other processes.
+	PollInterval time.Duration
+
+	mu       sync.Mutex
+	kinds    map[string]Func
+	cancels  map[uint]context.CancelFunc
+	wake     chan struct{}
+	stop     context.CancelFunc
+	draining bool
+	wg       sync.WaitGroup
+}
+
+func NewRunner(dbs *gorm.DB) *Runner {
+	return &Runner{
+		DB:           dbs,
+		PollInterval: time.Second,
+		kinds:        map[string]Func{},
+		cancels:      map[uint]context.CancelFunc{},
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+func (r *Runner) Register(kind string, fn Func) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.kinds[kind] = fn
+}
+
+// staleAfter is how long a running job may go without a heartbeat before it
+// is considered abandoned by its runner.
+func (r *Runner) staleAfter() time.Duration {
+	return 5 * r.PollInterval
+}
+
+// requeueStale queues running jobs whose runner went away again.
+func (r *Runner) requeueStale() error {
+	return r.DB.Model(&db.Job{}).
+		Where("state = ? AND updated_at < ?", StateRunning, time.Now().Add(-r.staleAfter())).
+		Updates(map[string]any{"state": StateQueued, "started_at": nil}).Error
+}
+
+// Start runs queued jobs one at a time until Stop is called. Jobs left
+// running by a process that is gone are queued again.
+func (r *Runner) Start() error {
+	if err := r.requeueStale(); err != nil {
+		return err
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	r.mu.Lock()
+	r.stop = stop
+	r.mu.Unlock()
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.loop(ctx)
+	}()
+	return nil
+}
+
+// Stop cancels the running job and waits for it. The job is queued again
+// instead of being marked as canceled.
+func (r *Runner) Stop() {
+	r.mu.Lock()
+	stop := r.stop
+	r.mu.Unlock()
+
+	if stop != nil {
+		stop()
+		r.wg.Wait()
+	}
+}
+
+// Drain lets the runner work through the queue and stops it once no job is
+// left, e.g. when the frontend that started the jobs disconnected. Canceling
+// ctx stops the runner right away like Stop.
+func (r *Runner) Drain(ctx context.Context) {
+	r.mu.Lock()
+	started := r.stop != nil
+	r.draining = true
+	r.mu.Unlock()
+	if !started {
+		return
+	}
+
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		r.Stop()
+	}
+}
+
+func (r *Runner) loop(ctx context.Context) {
+	ticker := time.NewTicker(r.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		r.requeueStale()
+		for {
+			job, err := r.claim()
+			if err != nil || job == nil {
+				break
+			}
+			r.run(ctx, job)
+			if ctx.Err() != nil {
+				return
+			}
+		}
+
+		r.mu.Lock()
+		draining := r.draining
+		r.mu.Unlock()
+		if draining {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// claim marks the oldest queued job as running. The conditional update keeps
+// two runners on the same database from taking the same job.
+func (r *Runner) claim() (*db.Job, error) {
+	for {
+		var job db.Job
+		tx := r.DB.Order("id asc").Limit(1).Find(&job, "state = ?", StateQueued)
+		if tx.Error != nil {
+			return nil, tx.Error
+		}
+		if tx.RowsAffected == 0 {
+			return nil, nil
+		}
+
+		now := time.Now()
+		tx = r.DB.Model(&db.Job{}).
+			Where("id = ? AND state = ?", job.ID, StateQueued).
+			Updates(map[string]any{"state": StateRunning, "started_at": now})
+		if tx.Error != nil {
+			return nil, tx.Error
+		}
+		if tx.RowsAffected == 1 {
+			job.State = StateRunning
+			job.StartedAt = &now
+			return &job, nil
+		}
+	}
+}
+
+func (r *Runner) run(parent context.Context, job *db.Job) {
+	r.mu.Lock()
+	fn, ok := r.kinds[job.Kind]
+	r.mu.Unlock()
+	if !ok {
+		r.finish(job.ID, StateFailed, nil, fmt.Errorf("%w %q", ErrUnknownKind, job.Kind))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	r.mu.Lock()
+	r.cancels[job.ID] = cancel
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.cancels, job.ID)
+		r.mu.Unlock()
+	}()
+
+	// Cancellation may be requested by another process through the database,
+	// the watcher also keeps the heartbeat of the job.
+	go r.watch(ctx, job.ID, cancel)
+
+	progress := func(done, total int) {
+		r.DB.Model(&db.Job{}).Where("id = ?", job.ID).Updates(map[string]any{"done": done, "total": total})
+	}
+
+	result, err := fn(ctx, json.RawMessage(job.Params), progress)
+
+	switch {
+	case parent.Err() != nil:
+		r.DB.Model(&db.Job{}).Where("id = ?", job.ID).Updates(map[string]any{"state": StateQueued, "started_at": nil})
+	case ctx.Err() != nil:
+		r.finish(job.ID, StateCanceled, nil, nil)
+	case err != nil:
+		r.finish(job.ID, StateFailed, nil, err)
+	default:
+		r.finish(job.ID, StateDone, result, nil)
+	}
+}
+
+func (r *Runner) watch(ctx context.Context, id uint, cancel context.CancelFunc) {
+	ticker := time.NewTicker(r.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var job db.Job
+		tx := r.DB.Select("cancel_requested").First(&job, "id = ?", id)
+		if tx.Error == nil && job.CancelRequested {
+			cancel()
+			return
+		}
+
+		r.DB.Model(&db.Job{}).Where("id = ? AND state = ?", id, StateRunning).Update("updated_at", time.Now())
+	}
+}
+
+func (r *Runner) finish(id uint, state string, result any, err error) {
+	updates := map[string]any{"state": state, "finished_at": time.Now()}
+	if err != nil {
+		updates["error"] = err.Error()
+	}
+	if result != nil {
+		encoded, merr := json.Marshal(result)
+		if merr != nil {
+			updates["state"] = StateFailed
+			updates["error"] = merr.Error()
+		} else {
+			updates["result"] = encoded
+		}
+	}
+
+	r.DB.Model(&db.Job{}).Where("id = ?", id).Updates(updates)
+}
+
+// Enqueue persists a new job. Any runner on the same database may pick it up.
+func (r *Runner) Enqueue(kind string, params json.RawMessage) (*db.JobDTO, error) {
+	r.mu.Lock()
+	_, ok := r.kinds[kind]
+	r.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKind, kind)
+	}
+
+	job := db.Job{Kind: kind, State: StateQueued, Params: params}
+	tx := r.DB.Create(&job)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+	return job.ToDTO(), nil
+}
+
+func (r *Runner) Get(id uint) (*db.JobDTO, error) {
+	var job db.Job
+	tx := r.DB.First(&job, "id = ?", id)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return job.ToDTO(), nil
+}
+
+// List returns the most recent jobs first. An empty state lists every job.
+func (r *Runner) List(state string, limit int) ([]db.JobDTO, error) {
+	var jobs []db.Job
+	query := r.DB.Order("id desc").Limit(limit)
+	if len(state) > 0 {
+		query = query.Where("state = ?", state)
+	}
+	tx := query.Find(&jobs)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	result := []db.JobDTO{}
+	for _, job := range jobs {
+		result = append(result, *job.ToDTO())
+	}
+	return result, nil
+}
+
+// Cancel stops a queued or running job. Running jobs are canceled
+// asynchronously, the job's state changes once it has stopped.
+func (r *Runner) Cancel(id uint) (*db.JobDTO, error) {
+	var job db.Job
+	tx := r.DB.First(&job, "id = ?", id)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	switch job.State {
+	case StateQueued:
+		tx = r.DB.Model(&db.Job{}).
+			Where("id = ? AND state = ?", id, StateQueued).
+			Updates(map[string]any{"state": StateCanceled, "finished_at": time.Now()})
+		if tx.Error != nil {
+			return nil, tx.Error
+		}
+		if tx.RowsAffected == 0 {
+			// Claimed in the meantime, cancel it as a running job.
+			return r.Cancel(id)
+		}
+	case StateRunning:
+		tx = r.DB.Model(&db.Job{}).Where("id = ?", id).Update("cancel_requested", true)
+		if tx.Error != nil {
+			return nil, tx.Error
+		}
+
+		r.mu.Lock()
+		cancel, ok := r.cancels[id]
+		r.mu.Unlock()
+		if ok {
+			cancel()
+		}
+	default:
+		return nil, ErrFinished
+	}
+
+	return r.Get(id)
+}
+
+// Wait polls a job until it is finished or ctx is canceled.
+func (r *Runner) Wait(ctx context.Context, id uint, update func(*db.JobDTO)) (*db.JobDTO, error) {
+	ticker := time.NewTicker(r.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		job, err := r.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		if update != nil {
+			update(job)
+		}
+		if Finished(job.State) {
+			return job, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return job, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func Finished(state string) bool {
+	return state == StateDone || state == StateFailed || state == StateCanceled
+}
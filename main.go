@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/CanPacis/tstud-core/cli"
@@ -10,7 +11,10 @@ import (
 
 func main() {
 	if len(os.Args) < 2 {
-		proto.Run()
+		if err := proto.Run(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
 	} else {
 		cli.Run()
 	}
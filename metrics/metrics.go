@@ -0,0 +1,306 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	KindCounter   = "counter"
+	KindGauge     = "gauge"
+	KindHistogram = "histogram"
+)
+
+var DefaultBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+var Default = NewRegistry()
+
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+	order    []string
+}
+
+func NewRegistry() *Registry {
+	return &Registry{families: map[string]*family{}}
+}
+
+type family struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	mu     sync.Mutex
+	labels []string
+	value  float64
+	count  uint64
+	counts []uint64
+}
+
+func (r *Registry) family(name, help, kind string, buckets []float64, labels []string) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if f, ok := r.families[name]; ok {
+		if f.kind != kind {
+			panic(fmt.Sprintf("metrics: %s registered as %s and %s", name, f.kind, kind))
+		}
+		return f
+	}
+
+	f := &family{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  labels,
+		buckets: buckets,
+		series:  map[string]*series{},
+	}
+	r.families[name] = f
+	r.order = append(r.order, name)
+	return f
+}
+
+func (f *family) with(values []string) *series {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labels: values, counts: make([]uint64, len(f.buckets))}
+		f.series[key] = s
+	}
+	return s
+}
+
+type CounterVec struct{ f *family }
+type Counter struct{ s *series }
+
+func (r *Registry) Counter(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{f: r.family(name, help, KindCounter, nil, labels)}
+}
+
+func (c *CounterVec) With(values ...string) *Counter {
+	return &Counter{s: c.f.with(values)}
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		return
+	}
+	c.s.mu.Lock()
+	c.s.value += v
+	c.s.mu.Unlock()
+}
+
+type GaugeVec struct{ f *family }
+type Gauge struct{ s *series }
+
+func (r *Registry) Gauge(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{f: r.family(name, help, KindGauge, nil, labels)}
+}
+
+func (g *GaugeVec) With(values ...string) *Gauge {
+	return &Gauge{s: g.f.with(values)}
+}
+
+func (g *Gauge) Add(v float64) {
+	g.s.mu.Lock()
+	g.s.value += v
+	g.s.mu.Unlock()
+}
+
+func (g *Gauge) Inc() {
+	g.Add(1)
+}
+
+func (g *Gauge) Dec() {
+	g.Add(-1)
+}
+
+func (g *Gauge) Set(v float64) {
+	g.s.mu.Lock()
+	g.s.value = v
+	g.s.mu.Unlock()
+}
+
+type HistogramVec struct{ f *family }
+type Histogram struct {
+	s       *series
+	buckets []float64
+}
+
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	return &HistogramVec{f: r.family(name, help, KindHistogram, buckets, labels)}
+}
+
+func (h *HistogramVec) With(values ...string) *Histogram {
+	return &Histogram{s: h.f.with(values), buckets: h.f.buckets}
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.s.mu.Lock()
+	defer h.s.mu.Unlock()
+
+	h.s.value += v
+	h.s.count++
+	for i, bound := range h.buckets {
+		if v <= bound {
+			h.s.counts[i]++
+		}
+	}
+}
+
+type Bucket struct {
+	UpperBound float64 `json:"le"`
+	Count      uint64  `json:"count"`
+}
+
+type Sample struct {
+	Labels  map[string]string `json:"labels"`
+	Value   float64           `json:"value"`
+	Count   uint64            `json:"count,omitempty"`
+	Buckets []Bucket          `json:"buckets,omitempty"`
+}
+
+type Family struct {
+	Name    string   `json:"name"`
+	Help    string   `json:"help"`
+	Kind    string   `json:"kind"`
+	Samples []Sample `json:"samples"`
+}
+
+// Snapshot returns a copy of every metric, ordered by registration and label
+// values.
+func (r *Registry) Snapshot() []Family {
+	r.mu.Lock()
+	names := slices.Clone(r.order)
+	r.mu.Unlock()
+
+	result := []Family{}
+	for _, name := range names {
+		r.mu.Lock()
+		f := r.families[name]
+		r.mu.Unlock()
+
+		result = append(result, f.snapshot())
+	}
+	return result
+}
+
+func (f *family) snapshot() Family {
+	f.mu.Lock()
+	keys := []string{}
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	all := []*series{}
+	for _, key := range keys {
+		all = append(all, f.series[key])
+	}
+	f.mu.Unlock()
+
+	result := Family{Name: f.name, Help: f.help, Kind: f.kind, Samples: []Sample{}}
+	for _, s := range all {
+		s.mu.Lock()
+		sample := Sample{Labels: map[string]string{}, Value: s.value, Count: s.count}
+		for i, label := range f.labels {
+			sample.Labels[label] = s.labels[i]
+		}
+		for i, bound := range f.buckets {
+			sample.Buckets = append(sample.Buckets, Bucket{UpperBound: bound, Count: s.counts[i]})
+		}
+		s.mu.Unlock()
+		result.Samples = append(result.Samples, sample)
+	}
+	return result
+}
+
+// WritePrometheus writes every metric in the prometheus text exposition
+// format.
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	buf := &strings.Builder{}
+
+	for _, f := range r.Snapshot() {
+		fmt.Fprintf(buf, "# HELP %s %s\n", f.Name, escapeHelp(f.Help))
+		fmt.Fprintf(buf, "# TYPE %s %s\n", f.Name, f.Kind)
+
+		for _, sample := range f.Samples {
+			if f.Kind != KindHistogram {
+				fmt.Fprintf(buf, "%s%s %s\n", f.Name, formatLabels(sample.Labels, "", ""), formatFloat(sample.Value))
+				continue
+			}
+
+			for _, bucket := range sample.Buckets {
+				fmt.Fprintf(buf, "%s_bucket%s %d\n", f.Name, formatLabels(sample.Labels, "le", formatFloat(bucket.UpperBound)), bucket.Count)
+			}
+			fmt.Fprintf(buf, "%s_bucket%s %d\n", f.Name, formatLabels(sample.Labels, "le", "+Inf"), sample.Count)
+			fmt.Fprintf(buf, "%s_sum%s %s\n", f.Name, formatLabels(sample.Labels, "", ""), formatFloat(sample.Value))
+			fmt.Fprintf(buf, "%s_count%s %d\n", f.Name, formatLabels(sample.Labels, "", ""), sample.Count)
+		}
+	}
+
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+func formatLabels(labels map[string]string, extraKey, extraValue string) string {
+	keys := []string{}
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	pairs := []string{}
+	for _, key := range keys {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, key, escapeLabel(labels[key])))
+	}
+	if len(extraKey) > 0 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extraKey, escapeLabel(extraValue)))
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
@@ -0,0 +1,184 @@
+package p2pjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+)
+
+const BrokerRegisterPath = "/_broker/register"
+
+// Broker relays requests between connected peers. A peer registers a name by
+// requesting BrokerRegisterPath with {"name": "..."}; afterwards requests
+// addressed to p2pjson://<name>/... are forwarded to it. Everything else is
+// served by Handler.
+type Broker struct {
+	Handler Handler
+	// Codec used for accepted connections, defaults to the text codec.
+	Codec CodecFactory
+	// Reserved reports names Handler serves itself, peers cannot register
+	// them. It may be nil.
+	Reserved func(name string) bool
+	// Limiter, if set, applies to every request the broker receives,
+	// forwarded ones included.
+	Limiter *Limiter
+
+	mu    sync.RWMutex
+	peers map[string]*Peer
+	names map[*Peer]string
+}
+
+func NewBroker(handler Handler) *Broker {
+	return &Broker{
+		Handler: handler,
+		Codec:   NewTextCodec,
+		peers:   map[string]*Peer{},
+		names:   map[*Peer]string{},
+	}
+}
+
+func (b *Broker) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		go b.ServePeer(NewWithCodec(conn, b.Codec))
+	}
+}
+
+func (b *Broker) ServePeer(p *Peer) {
+	var handler Handler = b
+	if b.Limiter != nil {
+		handler = b.Limiter.Limit(b)
+	}
+
+	p.Listen(handler)
+	b.unregister(p)
+}
+
+func (b *Broker) reserved(name string) bool {
+	return b.Reserved != nil && b.Reserved(name)
+}
+
+func (b *Broker) Peers() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	names := []string{}
+	for name := range b.peers {
+		names = append(names, name)
+	}
+	return names
+}
+
+func (b *Broker) ServeP2PJSON(r *Request) *Response {
+	if r.URL.Path == BrokerRegisterPath {
+		return b.register(r)
+	}
+
+	if b.reserved(r.URL.Host) {
+		return b.Handler.ServeP2PJSON(r)
+	}
+
+	b.mu.RLock()
+	target, ok := b.peers[r.URL.Host]
+	b.mu.RUnlock()
+
+	if !ok {
+		return b.Handler.ServeP2PJSON(r)
+	}
+	return b.forward(r, target)
+}
+
+func (b *Broker) register(r *Request) *Response {
+	var data struct {
+		Name string `json:"name"`
+	}
+	if err := r.DecodeJSON(&data); err != nil {
+		return ErrorResponse(r, StatusBadRequest, err)
+	}
+	if len(data.Name) == 0 {
+		return ErrorResponse(r, StatusUnprocessableEntity, ValidationError(FieldError{Field: "name", Code: "required", Message: "is required"}))
+	}
+	if r.Peer() == nil {
+		return ErrorResponse(r, StatusBadRequest, errors.New("only connected peers can register"))
+	}
+	if b.reserved(data.Name) {
+		return ErrorResponse(r, StatusConflict, fmt.Errorf("peer name %s is reserved", data.Name))
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if owner, ok := b.peers[data.Name]; ok && owner != r.Peer() {
+		return ErrorResponse(r, StatusConflict, fmt.Errorf("peer name %s is already taken", data.Name))
+	}
+	if old, ok := b.names[r.Peer()]; ok {
+		delete(b.peers, old)
+	}
+	b.peers[data.Name] = r.Peer()
+	b.names[r.Peer()] = data.Name
+
+	encoded, _ := json.Marshal(map[string]any{"name": data.Name})
+	return NewResponse(r, StatusOK, bytes.NewBuffer(encoded))
+}
+
+func (b *Broker) unregister(p *Peer) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if name, ok := b.names[p]; ok {
+		delete(b.peers, name)
+		delete(b.names, p)
+	}
+}
+
+func (b *Broker) forward(r *Request, target *Peer) *Response {
+	fwd := NewRequest(r.URL.String(), r.Body)
+	for key, values := range r.Header {
+		fwd.Header[key] = append([]string{}, values...)
+	}
+
+	b.mu.RLock()
+	from, ok := b.names[r.Peer()]
+	b.mu.RUnlock()
+	if ok {
+		fwd.Header.Set("From", from)
+	}
+
+	// Partial content frames are relayed as they arrive, the final frame is
+	// returned so it goes through the same middleware as local responses.
+	p, err := target.send(fwd, true)
+	if err != nil {
+		return ErrorResponse(r, StatusBadGateway, err)
+	}
+	defer target.forget(fwd.Identifier, p)
+
+	for {
+		var resp *Response
+		select {
+		case resp = <-p.ch:
+		case <-target.closed:
+			return ErrorResponse(r, StatusBadGateway, target.closedErr())
+		}
+
+		resp.Identifier = r.Identifier
+		resp.Request = r
+		resp.URL = r.URL
+		if resp.StatusCode != StatusPartialContent {
+			return resp
+		}
+
+		if r.Peer() == nil {
+			continue
+		}
+		if err := r.Peer().Respond(resp); err != nil {
+			return ErrorResponse(r, StatusBadGateway, err)
+		}
+	}
+}
@@ -0,0 +1,368 @@
+package p2pjson
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/textproto"
+	neturl "net/url"
+	"slices"
+	"strings"
+)
+
+// Codec reads and writes frames in a specific wire format. Peers serialize
+// calls to WriteFrame, ReadFrame is only called from Peer.Listen.
+type Codec interface {
+	ReadFrame() (*Frame, error)
+	WriteFrame(*Frame) error
+}
+
+type CodecFactory func(rw io.ReadWriter) Codec
+
+func CodecByName(name string) (CodecFactory, error) {
+	switch name {
+	case "", "text":
+		return NewTextCodec, nil
+	case "lsp":
+		return NewLSPCodec, nil
+	case "ndjson":
+		return NewNDJSONCodec, nil
+	default:
+		return nil, fmt.Errorf("unknown codec %q", name)
+	}
+}
+
+// TextCodec is the native format: a type line followed by a MIME style
+// start line, headers and body.
+type TextCodec struct {
+	fr *frameReader
+	w  io.Writer
+}
+
+func NewTextCodec(rw io.ReadWriter) Codec {
+	return &TextCodec{fr: newFrameReader(rw), w: rw}
+}
+
+func (c *TextCodec) ReadFrame() (*Frame, error) {
+	return c.fr.next()
+}
+
+func (c *TextCodec) WriteFrame(f *Frame) error {
+	buf := bytes.NewBufferString(f.Type + "\r\n")
+
+	var err error
+	switch f.Type {
+	case RequestMessageType:
+		_, err = io.Copy(buf, f.Request)
+	case ResponseMessageType:
+		_, err = io.Copy(buf, f.Response)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = c.w.Write(buf.Bytes())
+	return err
+}
+
+// envelope is the json representation of a frame used by the lsp and ndjson
+// codecs. JSON bodies are embedded as is, anything else is sent base64
+// encoded in data.
+type envelope struct {
+	Type    string            `json:"type"`
+	ID      uint              `json:"id,omitempty"`
+	URL     string            `json:"url,omitempty"`
+	Status  int               `json:"status,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+	Data    []byte            `json:"data,omitempty"`
+}
+
+func encodeHeaders(h textproto.MIMEHeader, skip ...string) map[string]string {
+	headers := map[string]string{}
+	for key, values := range h {
+		if slices.Contains(skip, key) {
+			continue
+		}
+		headers[key] = strings.Join(values, " ")
+	}
+	if len(headers) == 0 {
+		return nil
+	}
+	return headers
+}
+
+func (e *envelope) setBody(header textproto.MIMEHeader, body io.Reader) error {
+	raw, err := readBody(body)
+	if err != nil {
+		return err
+	}
+	if len(raw) == 0 {
+		return nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	if (mediaType == "" || mediaType == ContentTypeJSON) && json.Valid(raw) {
+		e.Body = raw
+	} else {
+		e.Data = raw
+	}
+	return nil
+}
+
+func (e *envelope) header() textproto.MIMEHeader {
+	header := make(textproto.MIMEHeader)
+	for key, value := range e.Headers {
+		header.Set(key, value)
+	}
+	if len(header.Get("Content-Type")) == 0 {
+		if len(e.Data) > 0 {
+			header.Set("Content-Type", ContentTypeOctetStream)
+		} else {
+			header.Set("Content-Type", ContentTypeJSON)
+		}
+	}
+	return header
+}
+
+func (e *envelope) body() io.Reader {
+	if len(e.Data) > 0 {
+		return bytes.NewReader(e.Data)
+	}
+	return bytes.NewReader(e.Body)
+}
+
+func toEnvelope(f *Frame) (*envelope, error) {
+	skip := []string{"Identifier", "Content-Length"}
+
+	switch f.Type {
+	case RequestMessageType:
+		r := f.Request
+		e := &envelope{Type: "request", ID: r.Identifier, URL: r.URL.String(), Headers: encodeHeaders(r.Header, skip...)}
+		return e, e.setBody(r.Header, r.Body)
+	case ResponseMessageType:
+		r := f.Response
+		e := &envelope{Type: "response", ID: r.Identifier, Status: r.StatusCode, Headers: encodeHeaders(r.Header, skip...)}
+		return e, e.setBody(r.Header, r.Body)
+	case ExitMessageType:
+		return &envelope{Type: "exit"}, nil
+	default:
+		return nil, fmt.Errorf("unknown message type %q", f.Type)
+	}
+}
+
+func fromEnvelope(raw []byte) (*Frame, error) {
+	e := &envelope{}
+	if err := json.Unmarshal(raw, e); err != nil {
+		return nil, &FrameError{Err: err, synced: true}
+	}
+
+	switch strings.ToUpper(e.Type) {
+	case RequestMessageType:
+		u, err := neturl.Parse(e.URL)
+		if err != nil {
+			return nil, &FrameError{Type: RequestMessageType, Identifier: e.ID, Err: err, synced: true}
+		}
+		if u.Scheme != P2PJSONScheme {
+			return nil, &FrameError{Type: RequestMessageType, Identifier: e.ID, Err: errors.New("invalid url scheme (should use 'p2pjson')"), synced: true}
+		}
+
+		return &Frame{Type: RequestMessageType, Request: &Request{
+			Identifier: e.ID,
+			URL:        u,
+			Header:     e.header(),
+			Body:       e.body(),
+		}}, nil
+	case ResponseMessageType:
+		return &Frame{Type: ResponseMessageType, Response: &Response{
+			Identifier: e.ID,
+			Header:     e.header(),
+			Body:       e.body(),
+			StatusCode: e.Status,
+			Status:     StatusText(e.Status),
+		}}, nil
+	case ExitMessageType:
+		return &Frame{Type: ExitMessageType}, nil
+	default:
+		return nil, &FrameError{Identifier: e.ID, Err: fmt.Errorf("unknown message type %q", e.Type), synced: true}
+	}
+}
+
+// LSPCodec frames json envelopes with a Content-Length header, the same way
+// the language server protocol does.
+type LSPCodec struct {
+	tp *textproto.Reader
+	br *bufio.Reader
+	w  io.Writer
+
+	// resynced is set when resync stopped right after a Content-Length key,
+	// the rest of that line is its value.
+	resynced bool
+}
+
+var lspMarker = []byte("Content-Length:")
+
+func NewLSPCodec(rw io.ReadWriter) Codec {
+	tp, br := bufferedReader(rw)
+	return &LSPCodec{tp: tp, br: br, w: rw}
+}
+
+func (c *LSPCodec) ReadFrame() (*Frame, error) {
+	f, err := c.readFrame()
+
+	var ferr *FrameError
+	if errors.As(err, &ferr) && !ferr.synced {
+		// Any read error here surfaces again on the next call.
+		c.resync()
+	}
+	return f, err
+}
+
+// resync discards input up to the Content-Length key of the next frame.
+func (c *LSPCodec) resync() error {
+	matched := 0
+	for matched < len(lspMarker) {
+		b, err := c.br.ReadByte()
+		if err != nil {
+			return err
+		}
+
+		switch b {
+		case lspMarker[matched]:
+			matched++
+		case lspMarker[0]:
+			matched = 1
+		default:
+			matched = 0
+		}
+	}
+	c.resynced = true
+	return nil
+}
+
+func (c *LSPCodec) readFrame() (*Frame, error) {
+	var length string
+	if c.resynced {
+		c.resynced = false
+		line, err := c.tp.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		length = strings.TrimSpace(line)
+	}
+
+	header, err := readHeader(c.tp, c.br)
+	if err != nil {
+		return nil, err
+	}
+	if len(length) > 0 {
+		header.Set("Content-Length", length)
+	}
+
+	// Without a valid length the body is still unread.
+	contentLength, err := extractInt(header, "Content-Length")
+	if err != nil {
+		return nil, &FrameError{Err: err}
+	}
+	if contentLength < 0 || contentLength > MaxBodySize {
+		return nil, &FrameError{Err: fmt.Errorf("content-length %d out of range", contentLength)}
+	}
+
+	raw := make([]byte, contentLength)
+	if _, err := io.ReadFull(c.br, raw); err != nil {
+		return nil, err
+	}
+
+	return fromEnvelope(raw)
+}
+
+func (c *LSPCodec) WriteFrame(f *Frame) error {
+	e, err := toEnvelope(f)
+	if err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	buf := bytes.NewBufferString(fmt.Sprintf("Content-Length: %d\r\n\r\n", len(raw)))
+	buf.Write(raw)
+	_, err = c.w.Write(buf.Bytes())
+	return err
+}
+
+// NDJSONCodec writes every frame as a single json envelope on its own line.
+type NDJSONCodec struct {
+	br *bufio.Reader
+	w  io.Writer
+}
+
+func NewNDJSONCodec(rw io.ReadWriter) Codec {
+	_, br := bufferedReader(rw)
+	return &NDJSONCodec{br: br, w: rw}
+}
+
+func (c *NDJSONCodec) ReadFrame() (*Frame, error) {
+	for {
+		line, err := c.readLine()
+		line = bytes.TrimSpace(line)
+		if errors.Is(err, errLineTooLong) {
+			return nil, &FrameError{Err: err, synced: true}
+		}
+		if len(line) > 0 {
+			return fromEnvelope(line)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+var errLineTooLong = errors.New("line too long")
+
+// readLine reads up to the next newline, holding at most MaxBodySize bytes.
+// The rest of a longer line is discarded and errLineTooLong returned.
+func (c *NDJSONCodec) readLine() ([]byte, error) {
+	var line []byte
+	tooLong := false
+	for {
+		chunk, err := c.br.ReadSlice('\n')
+		if !tooLong {
+			if len(line)+len(chunk) > MaxBodySize+1 {
+				tooLong = true
+				line = nil
+			} else {
+				line = append(line, chunk...)
+			}
+		}
+
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if tooLong && (err == nil || errors.Is(err, io.EOF)) {
+			return nil, errLineTooLong
+		}
+		return line, err
+	}
+}
+
+func (c *NDJSONCodec) WriteFrame(f *Frame) error {
+	e, err := toEnvelope(f)
+	if err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.w.Write(append(raw, '\n'))
+	return err
+}
@@ -0,0 +1,110 @@
+package p2pjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type Error struct {
+	Status  int          `json:"status"`
+	Code    string       `json:"code"`
+	Message string       `json:"error"`
+	Fields  []FieldError `json:"fields,omitempty"`
+
+	err error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+func NewError(status int, code string, err error) *Error {
+	if len(code) == 0 {
+		code = StatusCode(status)
+	}
+
+	return &Error{
+		Status:  status,
+		Code:    code,
+		Message: err.Error(),
+		err:     err,
+	}
+}
+
+func ValidationError(fields ...FieldError) *Error {
+	messages := []string{}
+	for _, field := range fields {
+		messages = append(messages, fmt.Sprintf("%s: %s", field.Field, field.Message))
+	}
+
+	return &Error{
+		Status:  StatusUnprocessableEntity,
+		Code:    "validation_failed",
+		Message: strings.Join(messages, ", "),
+		Fields:  fields,
+	}
+}
+
+// StatusCode returns the default machine-readable code for a status, e.g.
+// "not_found" for 404.
+func StatusCode(status int) string {
+	text := strings.ToLower(StatusText(status))
+	text = strings.NewReplacer(" ", "_", "-", "_", "'", "").Replace(text)
+	if len(text) == 0 {
+		return "unknown"
+	}
+	return text
+}
+
+// DecodeError reads a structured error payload from a response body. It
+// returns nil if the response is not an error.
+func DecodeError(resp *Response) (*Error, error) {
+	if resp.StatusCode < 400 {
+		return nil, nil
+	}
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = bytes.NewReader(raw)
+
+	perr := &Error{}
+	if err := json.Unmarshal(raw, perr); err != nil {
+		return nil, err
+	}
+	if perr.Status == 0 {
+		perr.Status = resp.StatusCode
+	}
+	if len(perr.Code) == 0 {
+		perr.Code = StatusCode(perr.Status)
+	}
+	return perr, nil
+}
+
+func ErrorResponse(r *Request, code int, err error) *Response {
+	var perr *Error
+	if !errors.As(err, &perr) {
+		perr = NewError(code, "", err)
+	}
+
+	encoded, _ := json.Marshal(perr)
+
+	resp := NewResponse(r, perr.Status, bytes.NewBuffer(encoded))
+	resp.Header.Set("Content-Type", ContentTypeJSON)
+	return resp
+}
@@ -0,0 +1,135 @@
+package p2pjson
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// stderrTail is how much of a child's stderr is kept for error reports.
+const stderrTail = 4 << 10
+
+// CommandError is returned when a spawned peer exits unsuccessfully. Stderr
+// holds the tail of what the child wrote to its standard error.
+type CommandError struct {
+	Err    error
+	Stderr string
+}
+
+func (e *CommandError) Error() string {
+	if len(e.Stderr) == 0 {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s: %s", e.Err, e.Stderr)
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// tailBuffer forwards writes and remembers the last stderrTail bytes.
+type tailBuffer struct {
+	mu  sync.Mutex
+	w   io.Writer
+	buf []byte
+}
+
+func (t *tailBuffer) Write(b []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.buf = append(t.buf, b...)
+	if len(t.buf) > stderrTail {
+		t.buf = t.buf[len(t.buf)-stderrTail:]
+	}
+	if t.w != nil {
+		t.w.Write(b)
+	}
+	return len(b), nil
+}
+
+func (t *tailBuffer) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return strings.TrimSpace(string(bytes.ToValidUTF8(t.buf, nil)))
+}
+
+// CommandConn is the stdio of a child process as a connection. It is the
+// mirror of StdIOPeer: what the child reads from stdin is written here, what
+// it writes to stdout is read from here.
+type CommandConn struct {
+	io.Reader
+	stdin  io.WriteCloser
+	cmd    *exec.Cmd
+	stderr *tailBuffer
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func (c *CommandConn) Write(b []byte) (int, error) {
+	return c.stdin.Write(b)
+}
+
+// Close closes the child's stdin and waits for it to exit. Output the child
+// writes after that is discarded.
+func (c *CommandConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.stdin.Close()
+		// Wait closes stdout, it must only run once reading it reached EOF.
+		io.Copy(io.Discard, c.Reader)
+		if err := c.cmd.Wait(); err != nil {
+			c.closeErr = &CommandError{Err: err, Stderr: c.stderr.String()}
+		}
+	})
+	return c.closeErr
+}
+
+// Process returns the running child process.
+func (c *CommandConn) Process() *os.Process {
+	return c.cmd.Process
+}
+
+// StartCommand starts name with args and returns its stdio as a connection.
+// The child's stderr is forwarded to stderr, which may be nil to only keep
+// it for error reports.
+func StartCommand(ctx context.Context, stderr io.Writer, name string, args ...string) (*CommandConn, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	tail := &tailBuffer{w: stderr}
+	cmd.Stderr = tail
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	return &CommandConn{Reader: stdout, stdin: stdin, cmd: cmd, stderr: tail}, nil
+}
+
+// DialCommand spawns a peer process and talks to it over its stdio with the
+// text codec. Closing the returned peer sends EXIT and waits for the child.
+func DialCommand(ctx context.Context, name string, args ...string) (*Peer, error) {
+	return DialCommandWithCodec(ctx, NewTextCodec, name, args...)
+}
+
+func DialCommandWithCodec(ctx context.Context, codec CodecFactory, name string, args ...string) (*Peer, error) {
+	conn, err := StartCommand(ctx, os.Stderr, name, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWithCodec(conn, codec), nil
+}
@@ -0,0 +1,248 @@
+package p2pjson
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// MaxBodySize is the largest Content-Length a frame may declare.
+const MaxBodySize = 64 << 20
+
+// FrameError reports a malformed frame. The frame reader has already skipped
+// to the next frame boundary when it is returned.
+type FrameError struct {
+	Type       string
+	Identifier uint
+	Err        error
+
+	// synced is set when the frame was consumed completely and no
+	// resynchronization is needed.
+	synced bool
+}
+
+func (e *FrameError) Error() string {
+	if len(e.Type) == 0 {
+		return fmt.Sprintf("malformed frame: %s", e.Err)
+	}
+	return fmt.Sprintf("malformed %s frame: %s", strings.ToLower(e.Type), e.Err)
+}
+
+func (e *FrameError) Unwrap() error {
+	return e.Err
+}
+
+func malformed(err error) *FrameError {
+	return &FrameError{Err: err}
+}
+
+type Frame struct {
+	Type     string
+	Request  *Request
+	Response *Response
+}
+
+type frameReader struct {
+	br *bufio.Reader
+	tp *textproto.Reader
+
+	// next type line, read ahead while resynchronizing
+	peeked string
+}
+
+func newFrameReader(r io.Reader) *frameReader {
+	tp, br := bufferedReader(r)
+	return &frameReader{br: br, tp: tp}
+}
+
+func isMessageType(line string) bool {
+	switch line {
+	case RequestMessageType, ResponseMessageType, ExitMessageType:
+		return true
+	default:
+		return false
+	}
+}
+
+func (fr *frameReader) typeLine() (string, error) {
+	if len(fr.peeked) > 0 {
+		typ := fr.peeked
+		fr.peeked = ""
+		return typ, nil
+	}
+
+	for {
+		line, err := fr.tp.ReadLine()
+		if err != nil {
+			return "", err
+		}
+		if len(line) > 0 {
+			return line, nil
+		}
+	}
+}
+
+// resync discards input up to the next message type line.
+func (fr *frameReader) resync() error {
+	for {
+		line, err := fr.tp.ReadLine()
+		if err != nil {
+			return err
+		}
+		if isMessageType(line) {
+			fr.peeked = line
+			return nil
+		}
+	}
+}
+
+func (fr *frameReader) next() (*Frame, error) {
+	typ, err := fr.typeLine()
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Frame{Type: typ}
+	switch typ {
+	case ExitMessageType:
+		return f, nil
+	case RequestMessageType:
+		f.Request = &Request{}
+		_, err = f.Request.read(fr.tp, fr.br)
+	case ResponseMessageType:
+		f.Response = &Response{}
+		_, err = f.Response.read(fr.tp, fr.br)
+	default:
+		err = malformed(fmt.Errorf("unknown message type %q", typ))
+	}
+
+	if err == nil {
+		return f, nil
+	}
+
+	var ferr *FrameError
+	if !errors.As(err, &ferr) {
+		return nil, err
+	}
+
+	ferr.Type = typ
+	if !ferr.synced {
+		// Any read error here surfaces again on the next call.
+		fr.resync()
+	}
+	return nil, ferr
+}
+
+// readMessage reads the start line, headers and body of a frame whose type
+// line has already been consumed.
+func readMessage(tp *textproto.Reader, br *bufio.Reader) (string, textproto.MIMEHeader, []byte, int64, error) {
+	start, err := tp.ReadLine()
+	if err != nil {
+		return "", nil, nil, 0, err
+	}
+	n := int64(len(start) + 2)
+
+	header, err := readHeader(tp, br)
+	for key, values := range header {
+		for _, value := range values {
+			n += int64(len(key) + len(value) + 4)
+		}
+	}
+	n += 2
+
+	if err != nil {
+		return "", nil, nil, n, err
+	}
+
+	var identifier uint
+	if id, err := extractInt(header, "Identifier"); err == nil {
+		identifier = uint(id)
+	}
+
+	contentLength, err := extractInt(header, "Content-Length")
+	if err != nil {
+		return "", nil, nil, n, &FrameError{Identifier: identifier, Err: fmt.Errorf("content-length: %w", err)}
+	}
+	if contentLength < 0 || contentLength > MaxBodySize {
+		return "", nil, nil, n, &FrameError{Identifier: identifier, Err: fmt.Errorf("content-length %d out of range", contentLength)}
+	}
+
+	body := make([]byte, contentLength)
+	read, err := io.ReadFull(br, body)
+	n += int64(read)
+	if err != nil {
+		return "", nil, nil, n, err
+	}
+
+	return start, header, body, n, nil
+}
+
+// readHeader reads a MIME header, a malformed one is reported as a
+// FrameError.
+func readHeader(tp *textproto.Reader, br *bufio.Reader) (textproto.MIMEHeader, error) {
+	// textproto fails a long initial line with a leading space with a plain
+	// error instead of a ProtocolError.
+	if b, err := br.Peek(1); err == nil && (b[0] == ' ' || b[0] == '\t') {
+		return nil, malformed(errors.New("malformed header initial line"))
+	}
+
+	header, err := tp.ReadMIMEHeader()
+	if err != nil {
+		var perr textproto.ProtocolError
+		if errors.As(err, &perr) {
+			return header, malformed(err)
+		}
+	}
+	return header, err
+}
+
+func bufferedReader(r io.Reader) (*textproto.Reader, *bufio.Reader) {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return textproto.NewReader(br), br
+}
+
+func readBody(body io.Reader) ([]byte, error) {
+	if body == nil {
+		return []byte{}, nil
+	}
+	return io.ReadAll(body)
+}
+
+func encodeFrame(w *writer, startLine string, header textproto.MIMEHeader, body []byte) []byte {
+	buf := bytes.NewBuffer([]byte{})
+	w.writeString(buf, startLine+"\r\n")
+
+	for key, value := range header {
+		w.writeString(buf, fmt.Sprintf("%s: %s\r\n", key, strings.Join(value, " ")))
+	}
+
+	w.writeString(buf, "\r\n")
+	w.write(buf, body)
+	return buf.Bytes()
+}
+
+func parseStatusLine(line string) (int, string, error) {
+	split := strings.SplitN(line, " ", 3)
+	if len(split) < 2 {
+		return 0, "", errors.New("malformed status line")
+	}
+
+	code, err := strconv.Atoi(split[1])
+	if err != nil {
+		return 0, "", fmt.Errorf("malformed status code: %w", err)
+	}
+
+	status := ""
+	if len(split) == 3 {
+		status = split[2]
+	}
+	return code, status, nil
+}
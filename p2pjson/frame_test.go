@@ -0,0 +1,164 @@
+package p2pjson
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type codecCase struct {
+	name string
+	new  CodecFactory
+	// sep starts the sentinel on a fresh line
+	sep string
+}
+
+var codecCases = []codecCase{
+	{"text", NewTextCodec, "\r\n"},
+	{"lsp", NewLSPCodec, ""},
+	{"ndjson", NewNDJSONCodec, "\n"},
+}
+
+const sentinelURL = "p2pjson:///sentinel"
+
+// readWriter reads from a fixed input and discards writes.
+type readWriter struct {
+	io.Reader
+}
+
+func (readWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func sentinel(t testing.TB, c codecCase) []byte {
+	buf := bytes.NewBuffer([]byte{})
+	err := c.new(buf).WriteFrame(&Frame{
+		Type:    RequestMessageType,
+		Request: NewRequest(sentinelURL, strings.NewReader(`{}`)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append([]byte(c.sep), buf.Bytes()...)
+}
+
+func isSentinel(f *Frame) bool {
+	return f != nil && f.Request != nil && f.Request.URL.String() == sentinelURL
+}
+
+func lspFrame(header, body string) string {
+	return header + "\r\n\r\n" + body
+}
+
+var oversized = strconv.Itoa(MaxBodySize + 1)
+
+var seeds = map[string][]struct {
+	input  string
+	synced bool
+}{
+	"text": {
+		{"REQUEST\r\np2pjson:///a P2PJSON/0.1\r\nIdentif", false},
+		{"REQUEST\r\np2pjson:///a P2PJSON/0.1\r\nIdentifier: 1\r\n\r\n{}", false},
+		{"REQUEST\r\np2pjson:///a P2PJSON/0.1\r\nIdentifier: 1\r\nContent-Length: abc\r\n\r\n{}", false},
+		{"REQUEST\r\np2pjson:///a P2PJSON/0.1\r\nIdentifier: 1\r\nContent-Length: -1\r\n\r\n{}", false},
+		{"REQUEST\r\np2pjson:///a P2PJSON/0.1\r\nIdentifier: 1\r\nContent-Length: " + oversized + "\r\n\r\n{}", false},
+		{"REQUEST\r\np2pjson:///a P2PJSON/0.1\r\nbad header\r\n\r\n", false},
+		{"FOO\r\n", false},
+		{"REQUEST\r\np2pjson:///a P2PJSON/0.1\r\n " + strings.Repeat("0", 100) + "\r\n\r\n", false},
+		{"REQUEST\r\nhttp://a P2PJSON/0.1\r\nIdentifier: 1\r\nContent-Length: 2\r\n\r\n{}", true},
+		{"REQUEST\r\np2pjson:///a\r\nIdentifier: 1\r\nContent-Length: 2\r\n\r\n{}", true},
+		{"RESPONSE\r\nP2PJSON/0.1 200 OK\r\nContent-Length: 2\r\n\r\n{}", true},
+	},
+	"lsp": {
+		{lspFrame("Content-Type: application/json", `{"type":"exit"}`), false},
+		{lspFrame("Content-Length: abc", `{"type":"exit"}`), false},
+		{lspFrame("Content-Length: -1", `{"type":"exit"}`), false},
+		{lspFrame("Content-Length: "+oversized, `{"type":"exit"}`), false},
+		{lspFrame("Content-Len", ""), false},
+		{" " + strings.Repeat("0", 100), false},
+		{lspFrame("Content-Length: 3", "{]}"), true},
+		{lspFrame("Content-Length: 15", `{"type":"nope"}`), true},
+		{lspFrame("Content-Length: 30", `{"type":"request","url":"a:b"}`), true},
+	},
+	"ndjson": {
+		{`{"type":"request","url":"p2pjson:///a"`, true},
+		{`{"type":"nope"}`, true},
+		{`{"type":"request","url":"http://a"}`, true},
+		{strings.Repeat("x", MaxBodySize+1), true},
+	},
+}
+
+func TestReadFrameSync(t *testing.T) {
+	for _, c := range codecCases {
+		t.Run(c.name, func(t *testing.T) {
+			for _, seed := range seeds[c.name] {
+				input := append([]byte(seed.input), sentinel(t, c)...)
+				codec := c.new(readWriter{bytes.NewReader(input)})
+
+				_, err := codec.ReadFrame()
+				var ferr *FrameError
+				if !errors.As(err, &ferr) {
+					t.Fatalf("%.40q: expected a frame error, got %v", seed.input, err)
+				}
+				if ferr.synced != seed.synced {
+					t.Errorf("%.40q: synced is %v, expected %v", seed.input, ferr.synced, seed.synced)
+				}
+
+				f, err := codec.ReadFrame()
+				if err != nil || !isSentinel(f) {
+					t.Errorf("%.40q: expected the next frame, got %v", seed.input, err)
+				}
+			}
+		})
+	}
+}
+
+func fuzzReadFrame(f *testing.F, c codecCase) {
+	for _, seed := range seeds[c.name] {
+		if len(seed.input) <= 1<<10 {
+			f.Add([]byte(seed.input))
+		}
+	}
+	f.Add(sentinel(f, c))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		input := append(data, sentinel(t, c)...)
+		codec := c.new(readWriter{bytes.NewReader(input)})
+
+		// Every frame error consumes input, the reader must hit the end well
+		// before reading once per byte.
+		for range len(input) + 2 {
+			f, err := codec.ReadFrame()
+			if isSentinel(f) {
+				return
+			}
+
+			var ferr *FrameError
+			if err == nil || errors.As(err, &ferr) {
+				continue
+			}
+			// The garbage may legitimately swallow the sentinel, e.g. with a
+			// Content-Length reaching past it.
+			if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Fatalf("unexpected error %v", err)
+			}
+			return
+		}
+		t.Fatal("reader did not make progress")
+	})
+}
+
+func FuzzReadFrameText(f *testing.F) {
+	fuzzReadFrame(f, codecCases[0])
+}
+
+func FuzzReadFrameLSP(f *testing.F) {
+	fuzzReadFrame(f, codecCases[1])
+}
+
+func FuzzReadFrameNDJSON(f *testing.F) {
+	fuzzReadFrame(f, codecCases[2])
+}
@@ -0,0 +1,149 @@
+package p2pjson
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+type LimitOptions struct {
+	// Total weight of requests that may be handled at once.
+	MaxInFlight int
+	// Total weight a single peer may have in flight at once.
+	MaxPerPeer int
+	// Number of requests that may wait for a slot before the limiter starts
+	// rejecting them with StatusServiceUnavailable.
+	MaxQueue int
+	// Number of requests a single peer may have waiting before it is
+	// rejected with StatusTooManyRequests.
+	MaxPeerQueue int
+	// Value of the Retry-After header on rejected requests.
+	RetryAfter time.Duration
+	// Route weights keyed by path. Routes without a weight count as 1.
+	Weights map[string]int
+}
+
+type Limiter struct {
+	opts LimitOptions
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	inFlight int
+	queued   int
+	peers    map[*Peer]*peerLoad
+}
+
+type peerLoad struct {
+	inFlight int
+	queued   int
+}
+
+func NewLimiter(opts LimitOptions) *Limiter {
+	if opts.MaxInFlight <= 0 {
+		opts.MaxInFlight = math.MaxInt
+	}
+	if opts.MaxPerPeer <= 0 {
+		opts.MaxPerPeer = opts.MaxInFlight
+	}
+	if opts.MaxPeerQueue <= 0 {
+		opts.MaxPeerQueue = opts.MaxQueue
+	}
+	if opts.Weights == nil {
+		opts.Weights = map[string]int{}
+	}
+
+	l := &Limiter{
+		opts:  opts,
+		peers: map[*Peer]*peerLoad{},
+	}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+func (l *Limiter) Weight(path string) int {
+	w, ok := l.opts.Weights[path]
+	if !ok || w < 1 {
+		w = 1
+	}
+	return min(w, l.opts.MaxInFlight, l.opts.MaxPerPeer)
+}
+
+func (l *Limiter) fits(load *peerLoad, w int) bool {
+	return l.inFlight+w <= l.opts.MaxInFlight && load.inFlight+w <= l.opts.MaxPerPeer
+}
+
+func (l *Limiter) acquire(p *Peer, w int) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	load, ok := l.peers[p]
+	if !ok {
+		load = &peerLoad{}
+		l.peers[p] = load
+	}
+
+	if !l.fits(load, w) {
+		if load.queued >= l.opts.MaxPeerQueue {
+			l.release(p, load)
+			return StatusTooManyRequests
+		}
+		if l.queued >= l.opts.MaxQueue {
+			l.release(p, load)
+			return StatusServiceUnavailable
+		}
+
+		l.queued++
+		load.queued++
+		for !l.fits(load, w) {
+			l.cond.Wait()
+		}
+		l.queued--
+		load.queued--
+	}
+
+	l.inFlight += w
+	load.inFlight += w
+	return 0
+}
+
+func (l *Limiter) done(p *Peer, w int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inFlight -= w
+	if load, ok := l.peers[p]; ok {
+		load.inFlight -= w
+		l.release(p, load)
+	}
+	l.cond.Broadcast()
+}
+
+func (l *Limiter) release(p *Peer, load *peerLoad) {
+	if load.inFlight == 0 && load.queued == 0 {
+		delete(l.peers, p)
+	}
+}
+
+func (l *Limiter) Limit(next Handler) Handler {
+	return HandlerFunc(func(r *Request) *Response {
+		w := l.Weight(r.URL.Path)
+
+		if status := l.acquire(r.Peer(), w); status != 0 {
+			var err error
+			if status == StatusTooManyRequests {
+				err = errors.New("too many requests from peer")
+			} else {
+				err = errors.New("server is busy")
+			}
+
+			resp := ErrorResponse(r, status, err)
+			resp.Header.Set("Retry-After", fmt.Sprintf("%d", int(math.Ceil(l.opts.RetryAfter.Seconds()))))
+			return resp
+		}
+		defer l.done(r.Peer(), w)
+
+		return next.ServeP2PJSON(r)
+	})
+}
@@ -0,0 +1,184 @@
+package p2pjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+)
+
+const ContentTypeJSON = "application/json"
+const ContentTypeMultipart = "multipart/mixed"
+const ContentTypeOctetStream = "application/octet-stream"
+
+var ErrNotMultipart = errors.New("body is not multipart/mixed")
+
+type Part struct {
+	Name        string
+	ContentType string
+	Body        io.Reader
+}
+
+func JSONPart(name string, v any) (Part, error) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return Part{}, err
+	}
+
+	return Part{Name: name, ContentType: ContentTypeJSON, Body: bytes.NewReader(encoded)}, nil
+}
+
+func BinaryPart(name, contentType string, body io.Reader) Part {
+	if len(contentType) == 0 {
+		contentType = ContentTypeOctetStream
+	}
+
+	return Part{Name: name, ContentType: contentType, Body: body}
+}
+
+func encodeMultipart(header textproto.MIMEHeader, parts []Part) (io.Reader, error) {
+	buf := bytes.NewBuffer([]byte{})
+	mw := multipart.NewWriter(buf)
+
+	for _, part := range parts {
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Type", part.ContentType)
+		if len(part.Name) > 0 {
+			h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"name": part.Name}))
+		}
+
+		w, err := mw.CreatePart(h)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(w, part.Body); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	header.Set("Content-Type", mime.FormatMediaType(ContentTypeMultipart, map[string]string{"boundary": mw.Boundary()}))
+	return buf, nil
+}
+
+func multipartReader(header textproto.MIMEHeader, body io.Reader) (*multipart.Reader, error) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil || mediaType != ContentTypeMultipart {
+		return nil, ErrNotMultipart
+	}
+
+	boundary, ok := params["boundary"]
+	if !ok {
+		return nil, fmt.Errorf("%w: missing boundary", ErrNotMultipart)
+	}
+
+	return multipart.NewReader(body, boundary), nil
+}
+
+// decodeJSON decodes a plain JSON body, or the first JSON part of a
+// multipart body.
+func decodeJSON(header textproto.MIMEHeader, body io.Reader, v any) error {
+	mr, err := multipartReader(header, body)
+	if errors.Is(err, ErrNotMultipart) {
+		return json.NewDecoder(body).Decode(v)
+	}
+	if err != nil {
+		return err
+	}
+
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return errors.New("multipart body has no json part")
+			}
+			return err
+		}
+
+		mediaType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		if mediaType == ContentTypeJSON {
+			return json.NewDecoder(part).Decode(v)
+		}
+	}
+}
+
+func PartName(part *multipart.Part) string {
+	_, params, err := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+	if err != nil {
+		return ""
+	}
+	return params["name"]
+}
+
+func (r *Request) SetJSONBody(v any) error {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	r.Header.Set("Content-Type", ContentTypeJSON)
+	r.Body = bytes.NewReader(encoded)
+	return nil
+}
+
+func (r *Request) SetMultipartBody(parts ...Part) error {
+	body, err := encodeMultipart(r.Header, parts)
+	if err != nil {
+		return err
+	}
+
+	r.Body = body
+	return nil
+}
+
+func (r *Request) MultipartReader() (*multipart.Reader, error) {
+	return multipartReader(r.Header, r.Body)
+}
+
+func (r *Request) DecodeJSON(v any) error {
+	return decodeJSON(r.Header, r.Body, v)
+}
+
+func (r *Response) SetJSONBody(v any) error {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	r.Header.Set("Content-Type", ContentTypeJSON)
+	r.Body = bytes.NewReader(encoded)
+	return nil
+}
+
+func (r *Response) SetMultipartBody(parts ...Part) error {
+	body, err := encodeMultipart(r.Header, parts)
+	if err != nil {
+		return err
+	}
+
+	r.Body = body
+	return nil
+}
+
+func (r *Response) MultipartReader() (*multipart.Reader, error) {
+	return multipartReader(r.Header, r.Body)
+}
+
+func (r *Response) DecodeJSON(v any) error {
+	return decodeJSON(r.Header, r.Body, v)
+}
+
+func NewMultipartResponse(r *Request, code int, parts ...Part) (*Response, error) {
+	resp := NewResponse(r, code, nil)
+	if err := resp.SetMultipartBody(parts...); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
@@ -2,6 +2,7 @@ package p2pjson
 
 import (
 	"errors"
+	"fmt"
 )
 
 type Handler interface {
@@ -10,6 +11,10 @@ type Handler interface {
 
 type HandlerFunc func(r *Request) *Response
 
+func (fn HandlerFunc) ServeP2PJSON(r *Request) *Response {
+	return fn(r)
+}
+
 type Mux struct {
 	handlers map[string]HandlerFunc
 }
@@ -18,10 +23,16 @@ func (m *Mux) HandleFunc(path string, fn HandlerFunc) {
 	m.handlers[path] = fn
 }
 
-func (m *Mux) ServeP2PJSON(r *Request) *Response {
+func (m *Mux) ServeP2PJSON(r *Request) (resp *Response) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			resp = ErrorResponse(r, StatusInternalServerError, NewError(StatusInternalServerError, "panic", fmt.Errorf("panic: %v", rec)))
+		}
+	}()
+
 	fn, ok := m.handlers[r.URL.Path]
 	if !ok {
-		return ErrorResponse(nil, StatusNotFound, errors.New("not found"))
+		return ErrorResponse(r, StatusNotFound, errors.New("not found"))
 	}
 
 	return fn(r)
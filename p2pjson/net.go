@@ -0,0 +1,54 @@
+package p2pjson
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// splitAddr splits addresses of the form unix:<path> or tcp:<host:port>.
+// Addresses without a network are treated as tcp.
+func splitAddr(addr string) (string, string, error) {
+	network, address, ok := strings.Cut(addr, ":")
+	if !ok {
+		return "", "", fmt.Errorf("malformed address %q", addr)
+	}
+
+	switch network {
+	case "unix", "tcp", "tcp4", "tcp6":
+		return network, address, nil
+	default:
+		return "tcp", addr, nil
+	}
+}
+
+func Listen(addr string) (net.Listener, error) {
+	network, address, err := splitAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return net.Listen(network, address)
+}
+
+func DialConn(addr string) (net.Conn, error) {
+	network, address, err := splitAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return net.Dial(network, address)
+}
+
+func Dial(addr string) (*Peer, error) {
+	return DialWithCodec(addr, NewTextCodec)
+}
+
+func DialWithCodec(addr string, codec CodecFactory) (*Peer, error) {
+	conn, err := DialConn(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWithCodec(conn, codec), nil
+}
@@ -1,15 +1,12 @@
 package p2pjson
 
 import (
-	"bufio"
-	"bytes"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"net/textproto"
 	"os"
 	"sync"
+	"sync/atomic"
 )
 
 const Version = "P2PJSON/0.1"
@@ -19,128 +16,211 @@ const ResponseMessageType = "RESPONSE"
 const ExitMessageType = "EXIT"
 
 type Peer struct {
-	rwc io.ReadWriteCloser
-	mu  sync.Mutex
+	rwc   io.ReadWriteCloser
+	codec Codec
+	mu    sync.Mutex
 
-	sent map[uint]chan *Response
+	sentMu sync.Mutex
+	sent   map[uint]*pending
+
+	closed    chan struct{}
+	closeOnce sync.Once
+	closeErr  error
 }
 
-func (c *Peer) Request(r *Request) (*Response, error) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if _, err := c.rwc.Write([]byte(fmt.Sprintf("%s\r\n", RequestMessageType))); err != nil {
+var ErrPeerClosed = errors.New("peer connection closed")
+
+type pending struct {
+	ch     chan *Response
+	done   chan struct{}
+	stream bool
+}
+
+func (c *Peer) send(r *Request, stream bool) (*pending, error) {
+	p := &pending{
+		ch:     make(chan *Response, 16),
+		done:   make(chan struct{}),
+		stream: stream,
+	}
+	c.sentMu.Lock()
+	c.sent[r.Identifier] = p
+	c.sentMu.Unlock()
+
+	if err := c.write(&Frame{Type: RequestMessageType, Request: r}); err != nil {
+		c.forget(r.Identifier, p)
 		return nil, err
 	}
+	return p, nil
+}
+
+func (c *Peer) forget(id uint, p *pending) {
+	c.sentMu.Lock()
+	if c.sent[id] == p {
+		delete(c.sent, id)
+	}
+	c.sentMu.Unlock()
+	close(p.done)
+}
 
-	_, err := io.Copy(c.rwc, r)
+// Request sends r and waits for its final response. Partial content frames
+// of streaming routes are discarded, use Stream to receive them.
+func (c *Peer) Request(r *Request) (*Response, error) {
+	p, err := c.send(r, false)
 	if err != nil {
 		return nil, err
 	}
 
-	ch := make(chan *Response)
-	c.sent[r.Identifier] = ch
+	select {
+	case resp := <-p.ch:
+		return resp, nil
+	case <-c.closed:
+		return nil, c.closedErr()
+	}
+}
 
-	resp := <-ch
-	return resp, nil
+// Done is closed once the peer stops listening.
+func (c *Peer) Done() <-chan struct{} {
+	return c.closed
+}
+
+// closedErr reports why the connection went away, including the error from
+// closing it, e.g. a spawned peer's exit status.
+func (c *Peer) closedErr() error {
+	if c.closeErr != nil {
+		return fmt.Errorf("%w: %w", ErrPeerClosed, c.closeErr)
+	}
+	return ErrPeerClosed
+}
+
+func (c *Peer) shutdown() error {
+	c.closeOnce.Do(func() {
+		c.closeErr = c.rwc.Close()
+		close(c.closed)
+	})
+	return c.closeErr
+}
+
+// Close sends an EXIT message to the other side and closes the connection.
+func (c *Peer) Close() error {
+	err := c.write(&Frame{Type: ExitMessageType})
+	return errors.Join(err, c.shutdown())
 }
 
 func (c *Peer) Respond(r *Response) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if _, err := c.rwc.Write([]byte(fmt.Sprintf("%s\r\n", ResponseMessageType))); err != nil {
-		return err
+	return c.write(&Frame{Type: ResponseMessageType, Response: r})
+}
+
+func (c *Peer) dispatch(resp *Response) {
+	partial := resp.StatusCode == StatusPartialContent
+
+	c.sentMu.Lock()
+	p, ok := c.sent[resp.Identifier]
+	if ok && !partial {
+		delete(c.sent, resp.Identifier)
+	}
+	c.sentMu.Unlock()
+
+	if !ok || (partial && !p.stream) {
+		return
 	}
 
-	_, err := io.Copy(c.rwc, r)
-	return err
+	select {
+	case p.ch <- resp:
+	case <-p.done:
+	}
+}
+
+func (c *Peer) write(f *Frame) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.codec.WriteFrame(f)
 }
 
 func (c *Peer) Listen(handler Handler) {
-	r := textproto.NewReader(bufio.NewReader(c.rwc))
+	var wg sync.WaitGroup
+	defer c.shutdown()
+	defer wg.Wait()
 
 	for {
-		typ, err := r.ReadLine()
+		f, err := c.codec.ReadFrame()
 		if err != nil {
-			c.Respond(ErrorResponse(nil, StatusInternalServerError, err))
-			continue
-		}
-
-		switch typ {
-		case RequestMessageType:
-			req := &Request{}
-			_, err = req.ReadFrom(c.rwc)
-			if err != nil {
-				c.Respond(ErrorResponse(nil, StatusInternalServerError, err))
-				continue
+			var ferr *FrameError
+			if !errors.As(err, &ferr) {
+				return
 			}
 
-			if resp := handler.ServeP2PJSON(req); resp != nil {
+			// Answering a broken response could bounce errors between peers
+			// forever, so only requests and unknown frames get a reply.
+			if ferr.Type != ResponseMessageType {
+				resp := ErrorResponse(nil, StatusBadRequest, ferr)
+				resp.Identifier = ferr.Identifier
 				c.Respond(resp)
 			}
-		case ResponseMessageType:
-			resp := &Response{}
-			_, err = resp.ReadFrom(c.rwc)
-			if err != nil {
-				c.Respond(ErrorResponse(nil, StatusInternalServerError, err))
-				continue
-			}
+			continue
+		}
 
-			reqCh, ok := c.sent[resp.Identifier]
-			if ok {
-				reqCh <- resp
-				delete(c.sent, resp.Identifier)
-			}
+		switch f.Type {
+		case RequestMessageType:
+			req := f.Request
+			req.peer = c
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if resp := handler.ServeP2PJSON(req); resp != nil {
+					c.Respond(resp)
+				}
+			}()
+		case ResponseMessageType:
+			c.dispatch(f.Response)
 		case ExitMessageType:
-			c.rwc.Close()
 			return
-		default:
-			c.Respond(ErrorResponse(nil, StatusBadRequest, errors.New("unknown message type")))
-			continue
 		}
 	}
 }
 
 func New(rwc io.ReadWriteCloser) *Peer {
+	return NewWithCodec(rwc, NewTextCodec)
+}
+
+func NewWithCodec(rwc io.ReadWriteCloser, codec CodecFactory) *Peer {
 	return &Peer{
-		rwc:  rwc,
-		mu:   sync.Mutex{},
-		sent: map[uint]chan *Response{},
+		rwc:    rwc,
+		codec:  codec(rwc),
+		sent:   map[uint]*pending{},
+		closed: make(chan struct{}),
 	}
 }
 
 type StdIOPeer struct {
-	closed bool
+	in  io.Reader
+	out io.Writer
+	// closed is read by the handler goroutines of Listen while Close may
+	// run at the same time.
+	closed atomic.Bool
 }
 
 func (p *StdIOPeer) Read(b []byte) (int, error) {
-	if p.closed {
+	if p.closed.Load() {
 		return 0, os.ErrClosed
 	}
-	return os.Stdin.Read(b)
+	return p.in.Read(b)
 }
 
 func (p *StdIOPeer) Write(b []byte) (int, error) {
-	if p.closed {
+	if p.closed.Load() {
 		return 0, os.ErrClosed
 	}
-	return os.Stdout.Write(b)
+	return p.out.Write(b)
 }
 
 func (p *StdIOPeer) Close() error {
-	if p.closed {
+	if !p.closed.CompareAndSwap(false, true) {
 		return os.ErrClosed
 	}
-	p.closed = true
 	return nil
 }
 
 func NewStdIOPeer() *StdIOPeer {
-	return &StdIOPeer{}
-}
-
-func ErrorResponse(r *Request, code int, err error) *Response {
-	data := map[string]any{"error": err.Error()}
-	encoded, _ := json.Marshal(data)
-
-	return NewResponse(r, code, bytes.NewBuffer(encoded))
+	return &StdIOPeer{in: os.Stdin, out: os.Stdout}
 }
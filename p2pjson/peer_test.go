@@ -0,0 +1,61 @@
+package p2pjson
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStdIOPeerCloseDuringRequests(t *testing.T) {
+	pr, pw := io.Pipe()
+	stdio := &StdIOPeer{in: pr, out: io.Discard}
+	peer := New(stdio)
+
+	go func() {
+		codec := NewTextCodec(struct {
+			io.Reader
+			io.Writer
+		}{strings.NewReader(""), pw})
+		for range 50 {
+			codec.WriteFrame(&Frame{Type: RequestMessageType, Request: NewRequest("p2pjson:///echo", strings.NewReader(`{}`))})
+		}
+		pw.Close()
+	}()
+
+	// started is done once a few handlers run, the peer is closed while
+	// the rest are still responding.
+	var started sync.WaitGroup
+	started.Add(10)
+	var mu sync.Mutex
+	count := 0
+
+	done := make(chan struct{})
+	go func() {
+		peer.Listen(HandlerFunc(func(r *Request) *Response {
+			mu.Lock()
+			count++
+			if count <= 10 {
+				started.Done()
+			}
+			mu.Unlock()
+
+			time.Sleep(time.Millisecond)
+			return NewResponse(r, StatusOK, strings.NewReader(`{}`))
+		}))
+		close(done)
+	}()
+
+	started.Wait()
+	peer.Close()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("listen did not return after close")
+	}
+	if err := stdio.Close(); err == nil {
+		t.Error("closing twice should fail")
+	}
+}
@@ -20,76 +20,76 @@ type Request struct {
 	Header     textproto.MIMEHeader
 	Body       io.Reader
 
-	ctx context.Context
+	ctx  context.Context
+	peer *Peer
 
-	w writer
+	w       writer
+	encoded *bytes.Reader
 }
 
 func (r *Request) Read(b []byte) (int, error) {
-	buf := bytes.NewBuffer([]byte{})
-	r.w.writeString(buf, fmt.Sprintf("%s %s\r\n", r.URL.String(), Version))
-
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		return r.w.n, err
-	}
-
-	r.Header.Set("Identifier", fmt.Sprintf("%d", r.Identifier))
-	r.Header.Set("Content-Length", fmt.Sprintf("%d", len(body)))
-
-	for key, value := range r.Header {
-		header := fmt.Sprintf("%s: %s\r\n", key, strings.Join(value, " "))
-		r.w.writeString(buf, header)
+	if r.encoded == nil {
+		body, err := readBody(r.Body)
+		if err != nil {
+			return 0, err
+		}
+
+		r.Header.Set("Identifier", fmt.Sprintf("%d", r.Identifier))
+		r.Header.Set("Content-Length", fmt.Sprintf("%d", len(body)))
+		if len(r.Header.Get("Content-Type")) == 0 {
+			r.Header.Set("Content-Type", ContentTypeJSON)
+		}
+
+		encoded := encodeFrame(&r.w, fmt.Sprintf("%s %s", r.URL.String(), Version), r.Header, body)
+		if r.w.err != nil {
+			return 0, r.w.err
+		}
+		r.encoded = bytes.NewReader(encoded)
 	}
 
-	r.w.writeString(buf, "\r\n")
-	r.w.write(buf, body)
-
-	if r.w.err != nil {
-		return r.w.n, r.w.err
-	}
-	r.w.n = copy(b, buf.Bytes())
-	return r.w.n, io.EOF
+	return r.encoded.Read(b)
 }
 
+// ReadFrom reads a request frame without its type line. Pass the same
+// *bufio.Reader for consecutive frames, any other reader gets buffered and
+// bytes past the frame are lost.
 func (req *Request) ReadFrom(ir io.Reader) (int64, error) {
-	buf := bytes.NewBuffer([]byte{})
-	r := textproto.NewReader(bufio.NewReader(io.TeeReader(ir, buf)))
+	return req.read(bufferedReader(ir))
+}
+
+func (req *Request) read(tp *textproto.Reader, br *bufio.Reader) (int64, error) {
+	start, header, body, n, err := readMessage(tp, br)
+	if err != nil {
+		return n, err
+	}
+	req.Header = header
+	req.Body = bytes.NewReader(body)
 
-	p2p, err := r.ReadLine()
+	identifier, err := extractInt(header, "Identifier")
 	if err != nil {
-		return int64(buf.Len()), err
+		return n, &FrameError{Err: err, synced: true}
 	}
-	split := strings.Split(p2p, " ")
+	req.Identifier = uint(identifier)
+
+	split := strings.Split(start, " ")
 	if len(split) < 2 {
-		return int64(buf.Len()), errors.New("malformed request")
+		return n, &FrameError{Identifier: req.Identifier, Err: errors.New("malformed request line"), synced: true}
 	}
 	req.URL, err = neturl.Parse(split[0])
 	if err != nil {
-		return int64(buf.Len()), err
+		return n, &FrameError{Identifier: req.Identifier, Err: err, synced: true}
 	}
 	if req.URL.Scheme != P2PJSONScheme {
-		return int64(buf.Len()), errors.New("malformed request, invalid url host (should use 'p2pjson')")
-	}
-
-	req.Header, err = r.ReadMIMEHeader()
-	if err != nil {
-		return int64(buf.Len()), err
+		return n, &FrameError{Identifier: req.Identifier, Err: errors.New("invalid url scheme (should use 'p2pjson')"), synced: true}
 	}
 
-	identifier, err := extractInt(req.Header, "Identifier")
-	if err != nil {
-		return int64(buf.Len()), err
-	}
-	req.Identifier = uint(identifier)
-
-	contentLength, err := extractInt(req.Header, "Content-Length")
-	if err != nil {
-		return int64(buf.Len()), err
-	}
+	return n, nil
+}
 
-	req.Body = io.LimitReader(ir, int64(contentLength))
-	return int64(buf.Len()), nil
+// Peer returns the peer the request was received from, or nil if the request
+// was created locally.
+func (req *Request) Peer() *Peer {
+	return req.peer
 }
 
 type reqCtxKeyType string
@@ -3,14 +3,11 @@ package p2pjson
 import (
 	"bufio"
 	"bytes"
-	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/textproto"
 	neturl "net/url"
-	"strconv"
-	"strings"
 )
 
 type Response struct {
@@ -22,72 +19,60 @@ type Response struct {
 	StatusCode int
 	Status     string
 
-	w writer
+	w       writer
+	encoded *bytes.Reader
 }
 
 func (r *Response) Read(b []byte) (int, error) {
-	buf := bytes.NewBuffer([]byte{})
-	r.w.writeString(buf, fmt.Sprintf("%s %d %s\r\n", Version, r.StatusCode, r.Status))
-
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		return r.w.n, err
+	if r.encoded == nil {
+		body, err := readBody(r.Body)
+		if err != nil {
+			return 0, err
+		}
+
+		r.Header.Set("Identifier", fmt.Sprintf("%d", r.Identifier))
+		r.Header.Set("Content-Length", fmt.Sprintf("%d", len(body)))
+		if len(r.Header.Get("Content-Type")) == 0 {
+			r.Header.Set("Content-Type", ContentTypeJSON)
+		}
+
+		encoded := encodeFrame(&r.w, fmt.Sprintf("%s %d %s", Version, r.StatusCode, r.Status), r.Header, body)
+		if r.w.err != nil {
+			return 0, r.w.err
+		}
+		r.encoded = bytes.NewReader(encoded)
 	}
 
-	r.Header.Set("Identifier", fmt.Sprintf("%d", r.Identifier))
-	r.Header.Set("Content-Length", fmt.Sprintf("%d", len(body)))
-
-	for key, value := range r.Header {
-		header := fmt.Sprintf("%s: %s\r\n", key, strings.Join(value, " "))
-		r.w.writeString(buf, header)
-	}
-
-	r.w.writeString(buf, "\r\n")
-	r.w.write(buf, body)
-
-	if r.w.err != nil {
-		return r.w.n, r.w.err
-	}
-	r.w.n = copy(b, buf.Bytes())
-	return r.w.n, io.EOF
+	return r.encoded.Read(b)
 }
 
+// ReadFrom reads a response frame without its type line. Pass the same
+// *bufio.Reader for consecutive frames, any other reader gets buffered and
+// bytes past the frame are lost.
 func (resp *Response) ReadFrom(ir io.Reader) (int64, error) {
-	buf := bytes.NewBuffer([]byte{})
-	r := textproto.NewReader(bufio.NewReader(io.TeeReader(ir, buf)))
-
-	p2p, err := r.ReadLine()
-	if err != nil {
-		return int64(buf.Len()), err
-	}
-	split := strings.Split(p2p, " ")
-	if len(split) < 3 {
-		return int64(buf.Len()), errors.New("malformed request")
-	}
-	resp.StatusCode, err = strconv.Atoi(split[1])
-	if err != nil {
-		return int64(buf.Len()), err
-	}
-	resp.Status = split[2]
+	return resp.read(bufferedReader(ir))
+}
 
-	resp.Header, err = r.ReadMIMEHeader()
+func (resp *Response) read(tp *textproto.Reader, br *bufio.Reader) (int64, error) {
+	start, header, body, n, err := readMessage(tp, br)
 	if err != nil {
-		return int64(buf.Len()), err
+		return n, err
 	}
+	resp.Header = header
+	resp.Body = bytes.NewReader(body)
 
-	identifier, err := extractInt(resp.Header, "Identifier")
+	identifier, err := extractInt(header, "Identifier")
 	if err != nil {
-		return int64(buf.Len()), err
+		return n, &FrameError{Err: err, synced: true}
 	}
 	resp.Identifier = uint(identifier)
 
-	contentLength, err := extractInt(resp.Header, "Content-Length")
+	resp.StatusCode, resp.Status, err = parseStatusLine(start)
 	if err != nil {
-		return int64(buf.Len()), err
+		return n, &FrameError{Identifier: resp.Identifier, Err: err, synced: true}
 	}
 
-	resp.Body = io.LimitReader(ir, int64(contentLength))
-	return int64(buf.Len()), nil
+	return n, nil
 }
 
 func NewResponse(r *Request, code int, body io.Reader) *Response {
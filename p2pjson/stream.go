@@ -0,0 +1,111 @@
+package p2pjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+)
+
+// StreamFunc yields the items of a streaming route. Each item is sent to the
+// peer as a StatusPartialContent frame, followed by a terminal StatusOK frame
+// once the sequence is exhausted.
+type StreamFunc func(r *Request) iter.Seq2[any, error]
+
+func Stream(fn StreamFunc) HandlerFunc {
+	return func(r *Request) *Response {
+		return StreamResponse(r, fn(r))
+	}
+}
+
+// StreamResponse sends every item of seq to the peer r came from and returns
+// the terminal frame. The items are sent before it returns, so middleware
+// around the handler, like limits, recovery and metrics, covers the whole
+// stream. An error from seq ends the stream with an error response.
+func StreamResponse(r *Request, seq iter.Seq2[any, error]) *Response {
+	peer := r.Peer()
+	if peer == nil {
+		return ErrorResponse(r, StatusInternalServerError, errors.New("cannot stream a response without a peer"))
+	}
+
+	count := 0
+	for item, err := range seq {
+		if err != nil {
+			return ErrorResponse(r, StatusInternalServerError, err)
+		}
+
+		encoded, err := json.Marshal(item)
+		if err != nil {
+			return ErrorResponse(r, StatusInternalServerError, err)
+		}
+
+		frame := NewResponse(r, StatusPartialContent, bytes.NewReader(encoded))
+		frame.Header.Set("Sequence", fmt.Sprintf("%d", count))
+		if err := peer.Respond(frame); err != nil {
+			return ErrorResponse(r, StatusInternalServerError, err)
+		}
+		count++
+	}
+
+	encoded, _ := json.Marshal(map[string]any{"count": count})
+	return NewResponse(r, StatusOK, bytes.NewReader(encoded))
+}
+
+// Stream sends r and yields every frame of its response. The sequence ends
+// after the terminal frame; error responses are yielded as errors.
+func (c *Peer) Stream(r *Request) iter.Seq2[*Response, error] {
+	return func(yield func(*Response, error) bool) {
+		p, err := c.send(r, true)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer c.forget(r.Identifier, p)
+
+		for {
+			var resp *Response
+			select {
+			case resp = <-p.ch:
+			case <-c.closed:
+				yield(nil, c.closedErr())
+				return
+			}
+
+			if resp.StatusCode == StatusPartialContent {
+				if !yield(resp, nil) {
+					return
+				}
+				continue
+			}
+
+			perr, err := DecodeError(resp)
+			if err != nil {
+				yield(nil, err)
+			} else if perr != nil {
+				yield(nil, perr)
+			}
+			return
+		}
+	}
+}
+
+func StreamJSON[T any](c *Peer, r *Request) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for resp, err := range c.Stream(r) {
+			var item T
+			if err != nil {
+				yield(item, err)
+				return
+			}
+
+			if err := resp.DecodeJSON(&item); err != nil {
+				yield(item, err)
+				return
+			}
+			if !yield(item, nil) {
+				return
+			}
+		}
+	}
+}
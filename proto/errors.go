@@ -0,0 +1,73 @@
+package proto
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+
+	"github.com/CanPacis/tstud-core/controllers"
+	"github.com/CanPacis/tstud-core/jobs"
+	"github.com/CanPacis/tstud-core/p2pjson"
+	"github.com/CanPacis/tstud-core/tstud"
+	"gorm.io/gorm"
+)
+
+// ToError maps controller and storage errors to a protocol error with the
+// matching status code. Unknown errors become internal server errors.
+func ToError(err error) *p2pjson.Error {
+	var perr *p2pjson.Error
+	if errors.As(err, &perr) {
+		return perr
+	}
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return p2pjson.NewError(p2pjson.StatusNotFound, "not_found", err)
+	case errors.Is(err, tstud.ErrUnknownLibrary):
+		return p2pjson.NewError(p2pjson.StatusNotFound, "unknown_library", err)
+	case errors.Is(err, controllers.ErrAliasNotFound):
+		return p2pjson.NewError(p2pjson.StatusNotFound, "alias_not_found", err)
+	case errors.Is(err, fs.ErrNotExist):
+		return p2pjson.NewError(p2pjson.StatusNotFound, "path_not_found", err)
+	case errors.Is(err, controllers.ErrTagSelfParent), errors.Is(err, controllers.ErrTagCycle):
+		return p2pjson.NewError(p2pjson.StatusUnprocessableEntity, "tag_cycle", err)
+	case errors.Is(err, controllers.ErrUnknownField):
+		return p2pjson.NewError(p2pjson.StatusUnprocessableEntity, "unknown_field", err)
+	case errors.Is(err, controllers.ErrInvalidField):
+		return p2pjson.NewError(p2pjson.StatusUnprocessableEntity, "invalid_field", err)
+	case errors.Is(err, controllers.ErrInvalidFieldValue):
+		return p2pjson.NewError(p2pjson.StatusUnprocessableEntity, "invalid_field_value", err)
+	case errors.Is(err, controllers.ErrInvalidFilter):
+		return p2pjson.NewError(p2pjson.StatusUnprocessableEntity, "invalid_filter", err)
+	case errors.Is(err, controllers.ErrNothingToUndo):
+		return p2pjson.NewError(p2pjson.StatusConflict, "nothing_to_undo", err)
+	case errors.Is(err, controllers.ErrNothingToRedo):
+		return p2pjson.NewError(p2pjson.StatusConflict, "nothing_to_redo", err)
+	case errors.Is(err, controllers.ErrHistoryConflict):
+		return p2pjson.NewError(p2pjson.StatusConflict, "history_conflict", err)
+	case errors.Is(err, controllers.ErrHistoryUnavailable):
+		return p2pjson.NewError(p2pjson.StatusNotImplemented, "history_unavailable", err)
+	case errors.Is(err, jobs.ErrUnknownKind):
+		return p2pjson.NewError(p2pjson.StatusUnprocessableEntity, "unknown_job_kind", err)
+	case errors.Is(err, jobs.ErrFinished):
+		return p2pjson.NewError(p2pjson.StatusConflict, "job_finished", err)
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return p2pjson.NewError(p2pjson.StatusConflict, "duplicate", err)
+	case errors.Is(err, gorm.ErrForeignKeyViolated):
+		return p2pjson.NewError(p2pjson.StatusConflict, "foreign_key_violated", err)
+	case errors.Is(err, gorm.ErrCheckConstraintViolated):
+		return p2pjson.NewError(p2pjson.StatusUnprocessableEntity, "constraint_violated", err)
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		return p2pjson.NewError(p2pjson.StatusBadRequest, "malformed_body", err)
+	default:
+		return p2pjson.NewError(p2pjson.StatusInternalServerError, "internal", err)
+	}
+}
+
+func ErrorResponse(r *p2pjson.Request, err error) *p2pjson.Response {
+	perr := ToError(err)
+	return p2pjson.ErrorResponse(r, perr.Status, perr)
+}
@@ -0,0 +1,28 @@
+package proto
+
+import (
+	"testing"
+
+	"github.com/CanPacis/tstud-core/controllers"
+	"github.com/CanPacis/tstud-core/p2pjson"
+	"github.com/CanPacis/tstud-core/tstud"
+)
+
+func TestUnknownLibrary(t *testing.T) {
+	_, configErr := (&tstud.Config{Libraries: map[string]string{}}).Path("nope")
+	_, hostErr := NewRegistry(&Library{Name: DefaultLibrary}).Resolve("nope")
+
+	for _, err := range []error{configErr, hostErr} {
+		perr := ToError(err)
+		if perr.Status != p2pjson.StatusNotFound || perr.Code != "unknown_library" {
+			t.Errorf("%v: got %d %s, expected 404 unknown_library", err, perr.Status, perr.Code)
+		}
+	}
+}
+
+func TestHistoryUnavailable(t *testing.T) {
+	perr := ToError(controllers.ErrHistoryUnavailable)
+	if perr.Status != p2pjson.StatusNotImplemented || perr.Code != "history_unavailable" {
+		t.Errorf("got %d %s, expected 501 history_unavailable", perr.Status, perr.Code)
+	}
+}
@@ -0,0 +1,29 @@
+package proto
+
+import (
+	"context"
+
+	"github.com/CanPacis/tstud-core/db"
+)
+
+type CreateFieldRequest struct {
+	Name   string   `json:"name" validate:"required,max=64"`
+	Type   string   `json:"type" validate:"required,oneof=string number date url boolean enum"`
+	Values []string `json:"values" validate:"max=256"`
+}
+
+func CreateField(ctx context.Context, data CreateFieldRequest) (*db.FieldDTO, error) {
+	return LibraryFromContext(ctx).Field.Create(data.Name, data.Type, data.Values)
+}
+
+type DeleteFieldRequest struct {
+	Name string `json:"name" validate:"required"`
+}
+
+func DeleteField(ctx context.Context, data DeleteFieldRequest) (*db.FieldDTO, error) {
+	return LibraryFromContext(ctx).Field.Delete(data.Name)
+}
+
+func ListField(ctx context.Context, data EmptyRequest) ([]db.FieldDTO, error) {
+	return LibraryFromContext(ctx).Field.List()
+}
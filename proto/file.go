@@ -0,0 +1,185 @@
+package proto
+
+import (
+	"context"
+	"errors"
+	"iter"
+
+	"github.com/CanPacis/tstud-core/controllers"
+	"github.com/CanPacis/tstud-core/db"
+	"github.com/CanPacis/tstud-core/p2pjson"
+	"gorm.io/gorm"
+)
+
+func ExportFiles(ctx context.Context, data EmptyRequest) iter.Seq2[db.FileDTO, error] {
+	return LibraryFromContext(ctx).File.Each(100)
+}
+
+type IndexFileRequest struct {
+	Path      string   `json:"path" validate:"required"`
+	Dir       bool     `json:"dir"`
+	Recursive bool     `json:"recursive"`
+	Exclude   []string `json:"exclude"`
+}
+
+func IndexFile(ctx context.Context, data IndexFileRequest) (*controllers.PaginatedResource[db.FileDTO], error) {
+	result, err := LibraryFromContext(ctx).File.Index(data.Path, data.Recursive, data.Exclude)
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return nil, p2pjson.NewError(p2pjson.StatusConflict, "duplicate", errors.New("resource already indexed"))
+	}
+	return result, err
+}
+
+type UnindexFileRequest struct {
+	Path      string   `json:"path" validate:"required"`
+	Dir       bool     `json:"dir"`
+	Recursive bool     `json:"recursive"`
+	Exclude   []string `json:"exclude"`
+}
+
+func UnindexFile(ctx context.Context, data UnindexFileRequest) (*controllers.PaginatedResource[db.FileDTO], error) {
+	return LibraryFromContext(ctx).File.Unindex(data.Path, data.Recursive, data.Exclude)
+}
+
+type RenameFileRequest struct {
+	OldPath string `json:"oldpath" validate:"required"`
+	NewPath string `json:"newpath" validate:"required"`
+}
+
+func RenameFile(ctx context.Context, data RenameFileRequest) (*db.FileDTO, error) {
+	return LibraryFromContext(ctx).File.Rename(data.OldPath, data.NewPath)
+}
+
+type TagFileRequest struct {
+	FileID uint `json:"file_id" validate:"required"`
+	TagID  uint `json:"tag_id" validate:"required"`
+}
+
+type TagFileResponse struct {
+	File *db.FileDTO `json:"file"`
+	Tag  *db.TagDTO  `json:"tag"`
+}
+
+func TagFile(ctx context.Context, data TagFileRequest) (TagFileResponse, error) {
+	file, tag, err := LibraryFromContext(ctx).File.Tag(data.FileID, data.TagID)
+	return TagFileResponse{File: file, Tag: tag}, err
+}
+
+type UntagFileRequest struct {
+	FileID uint `json:"file_id" validate:"required"`
+	TagID  uint `json:"tag_id" validate:"required"`
+}
+
+func UntagFile(ctx context.Context, data UntagFileRequest) (TagFileResponse, error) {
+	file, tag, err := LibraryFromContext(ctx).File.Untag(data.FileID, data.TagID)
+	return TagFileResponse{File: file, Tag: tag}, err
+}
+
+type SetAuthorRequest struct {
+	FileID uint   `json:"file_id" validate:"required"`
+	Author string `json:"author" validate:"required,max=256"`
+}
+
+type SetDescriptionRequest struct {
+	FileID      uint   `json:"file_id" validate:"required"`
+	Description string `json:"description" validate:"required,max=4096"`
+}
+
+type UnsetMetaRequest struct {
+	FileID uint `json:"file_id" validate:"required"`
+}
+
+func SetAuthor(ctx context.Context, data SetAuthorRequest) (*db.FileDTO, error) {
+	return LibraryFromContext(ctx).File.SetMeta(data.FileID, controllers.FileMetaData{Author: &data.Author})
+}
+
+func UnsetAuthor(ctx context.Context, data UnsetMetaRequest) (*db.FileDTO, error) {
+	empty := ""
+	return LibraryFromContext(ctx).File.SetMeta(data.FileID, controllers.FileMetaData{Author: &empty})
+}
+
+func SetDescription(ctx context.Context, data SetDescriptionRequest) (*db.FileDTO, error) {
+	return LibraryFromContext(ctx).File.SetMeta(data.FileID, controllers.FileMetaData{Description: &data.Description})
+}
+
+func UnsetDescription(ctx context.Context, data UnsetMetaRequest) (*db.FileDTO, error) {
+	empty := ""
+	return LibraryFromContext(ctx).File.SetMeta(data.FileID, controllers.FileMetaData{Description: &empty})
+}
+
+type SetFieldRequest struct {
+	FileID uint   `json:"file_id" validate:"required"`
+	Key    string `json:"key" validate:"required"`
+	Value  string `json:"value" validate:"max=4096"`
+}
+
+type UnsetFieldRequest struct {
+	FileID uint   `json:"file_id" validate:"required"`
+	Key    string `json:"key" validate:"required"`
+}
+
+func SetField(ctx context.Context, data SetFieldRequest) (*db.FileDTO, error) {
+	return LibraryFromContext(ctx).File.SetField(data.FileID, data.Key, data.Value)
+}
+
+func UnsetField(ctx context.Context, data UnsetFieldRequest) (*db.FileDTO, error) {
+	return LibraryFromContext(ctx).File.UnsetField(data.FileID, data.Key)
+}
+
+type ListFileRequest struct {
+	Page    int `json:"page" validate:"min=0"`
+	PerPage int `json:"per_page" validate:"min=0,max=100"`
+}
+
+// ListFile streams one page of files, or every file when per_page is 0.
+func ListFile(ctx context.Context, data ListFileRequest) iter.Seq2[db.FileDTO, error] {
+	return LibraryFromContext(ctx).File.ListEach(controllers.ListOptions{
+		Page:    data.Page,
+		PerPage: data.PerPage,
+	})
+}
+
+type SearchFileRequest struct {
+	Page        int      `json:"page" validate:"min=0"`
+	PerPage     int      `json:"per_page" validate:"min=0,max=100"`
+	Term        string   `json:"term"`
+	Tags        []string `json:"tags"`
+	Author      string   `json:"author"`
+	Description string   `json:"description"`
+	// Where filters by custom fields, author and description, like "rating>=4".
+	Where []string `json:"where"`
+	Sort  string   `json:"sort"`
+	Desc  bool     `json:"desc"`
+}
+
+// SearchFile streams one page of matches, or every match when per_page is 0.
+func SearchFile(ctx context.Context, data SearchFileRequest) iter.Seq2[db.FileDTO, error] {
+	return LibraryFromContext(ctx).File.SearchEach(controllers.SearchOptions{
+		Term:        data.Term,
+		Tags:        data.Tags,
+		Author:      data.Author,
+		Description: data.Description,
+		Where:       data.Where,
+		Sort:        data.Sort,
+		Desc:        data.Desc,
+		ListOptions: controllers.ListOptions{
+			Page:    data.Page,
+			PerPage: data.PerPage,
+		},
+	})
+}
+
+type FileDetailsRequest struct {
+	FileID uint   `json:"file_id"`
+	Path   string `json:"path"`
+}
+
+func FileDetails(ctx context.Context, data FileDetailsRequest) (*db.FileDTO, error) {
+	if data.FileID != 0 {
+		return LibraryFromContext(ctx).File.FindByID(data.FileID)
+	}
+	if len(data.Path) == 0 {
+		return nil, p2pjson.ValidationError(p2pjson.FieldError{Field: "file_id", Code: "required", Message: "file_id or path is required"})
+	}
+	return LibraryFromContext(ctx).File.FindByPath(data.Path)
+}
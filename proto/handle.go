@@ -0,0 +1,105 @@
+package proto
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"iter"
+	"reflect"
+
+	"github.com/CanPacis/tstud-core/p2pjson"
+)
+
+type libraryCtxKey struct{}
+
+// LibraryFromContext returns the library a typed handler was called for.
+func LibraryFromContext(ctx context.Context) *Library {
+	return ctx.Value(libraryCtxKey{}).(*Library)
+}
+
+// Handle builds a route from a typed handler. The json body is decoded into
+// Req and checked with Validate before fn is called, failures are sent as
+// StatusUnprocessableEntity. A successful result is sent with status. The
+// request and response types are recorded on the route for client
+// generation.
+func Handle[Req, Resp any](path string, status int, fn func(context.Context, Req) (Resp, error)) Route {
+	handler := func(r *p2pjson.Request) *p2pjson.Response {
+		var data Req
+		if raw := r.Get("body").([]byte); len(raw) > 0 {
+			if err := json.Unmarshal(raw, &data); err != nil {
+				return ErrorResponse(r, err)
+			}
+		}
+
+		if errs := Validate(data); len(errs) > 0 {
+			return ErrorResponse(r, p2pjson.ValidationError(errs...))
+		}
+
+		ctx := context.WithValue(r.Context(), libraryCtxKey{}, LibraryFrom(r))
+		result, err := fn(ctx, data)
+		if err != nil {
+			return ErrorResponse(r, err)
+		}
+
+		encoded, err := json.Marshal(result)
+		if err != nil {
+			return ErrorResponse(r, err)
+		}
+
+		return p2pjson.NewResponse(r, status, bytes.NewBuffer(encoded))
+	}
+
+	// Handlers return pointers to avoid copies, the body itself is never
+	// null.
+	response := reflect.TypeFor[Resp]()
+	if response.Kind() == reflect.Pointer {
+		response = response.Elem()
+	}
+
+	return Route{
+		Path:     path,
+		Handler:  JsonMiddleWare(handler),
+		Request:  reflect.TypeFor[Req](),
+		Response: response,
+	}
+}
+
+// HandleStream builds a streaming route from a typed handler. The request is
+// decoded and validated like in Handle, then every item fn yields is sent as
+// a partial content frame. Item is recorded as the route's response type.
+func HandleStream[Req, Item any](path string, fn func(context.Context, Req) iter.Seq2[Item, error]) Route {
+	handler := func(r *p2pjson.Request) *p2pjson.Response {
+		var data Req
+		if raw := r.Get("body").([]byte); len(raw) > 0 {
+			if err := json.Unmarshal(raw, &data); err != nil {
+				return ErrorResponse(r, err)
+			}
+		}
+
+		if errs := Validate(data); len(errs) > 0 {
+			return ErrorResponse(r, p2pjson.ValidationError(errs...))
+		}
+
+		ctx := context.WithValue(r.Context(), libraryCtxKey{}, LibraryFrom(r))
+		items := func(yield func(any, error) bool) {
+			for item, err := range fn(ctx, data) {
+				if err != nil {
+					yield(nil, ToError(err))
+					return
+				}
+				if !yield(item, nil) {
+					return
+				}
+			}
+		}
+		return p2pjson.StreamResponse(r, items)
+	}
+
+	return Route{
+		Path:     path,
+		Handler:  JsonMiddleWare(handler),
+		Request:  reflect.TypeFor[Req](),
+		Response: reflect.TypeFor[Item](),
+		Stream:   true,
+	}
+}
@@ -0,0 +1,92 @@
+package proto
+
+import (
+	"context"
+	"encoding/json"
+	"iter"
+	"strings"
+	"testing"
+
+	"github.com/CanPacis/tstud-core/p2pjson"
+)
+
+type echoRequest struct {
+	Name  string `json:"name" validate:"required,max=5"`
+	Count int    `json:"count" validate:"min=0"`
+}
+
+func echo(ctx context.Context, data echoRequest) (*echoRequest, error) {
+	return &data, nil
+}
+
+func echoEach(ctx context.Context, data echoRequest) iter.Seq2[echoRequest, error] {
+	return func(yield func(echoRequest, error) bool) {
+		yield(data, nil)
+	}
+}
+
+func serve(route Route, body string) *p2pjson.Response {
+	handler := WithLibrary(&Library{Name: DefaultLibrary}, route.Handler)
+	return handler(p2pjson.NewRequest("p2pjson://"+route.Path, strings.NewReader(body)))
+}
+
+func decodeError(t *testing.T, resp *p2pjson.Response) p2pjson.Error {
+	t.Helper()
+	var perr p2pjson.Error
+	if err := json.NewDecoder(resp.Body).Decode(&perr); err != nil {
+		t.Fatal(err)
+	}
+	return perr
+}
+
+func TestHandle(t *testing.T) {
+	resp := serve(Handle("/echo", p2pjson.StatusCreated, echo), `{"name":"abc","count":2}`)
+	if resp.StatusCode != p2pjson.StatusCreated {
+		t.Fatalf("got status %d, expected 201", resp.StatusCode)
+	}
+	var result echoRequest
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || result.Name != "abc" || result.Count != 2 {
+		t.Errorf("got %+v %v", result, err)
+	}
+}
+
+func TestHandleErrors(t *testing.T) {
+	routes := []Route{
+		Handle("/echo", p2pjson.StatusOK, echo),
+		HandleStream("/echo/each", echoEach),
+	}
+	cases := []struct {
+		body   string
+		status int
+		code   string
+		fields []string
+	}{
+		{`{"count":1}`, p2pjson.StatusUnprocessableEntity, "validation_failed", []string{"name"}},
+		{``, p2pjson.StatusUnprocessableEntity, "validation_failed", []string{"name"}},
+		{`{"name":"toolong","count":-1}`, p2pjson.StatusUnprocessableEntity, "validation_failed", []string{"name", "count"}},
+		{`{"name":`, p2pjson.StatusBadRequest, "malformed_body", nil},
+		{`{"name":1}`, p2pjson.StatusBadRequest, "malformed_body", nil},
+	}
+
+	for _, route := range routes {
+		for _, c := range cases {
+			resp := serve(route, c.body)
+			if resp.StatusCode != c.status {
+				t.Errorf("%s %q: got status %d, expected %d", route.Path, c.body, resp.StatusCode, c.status)
+				continue
+			}
+
+			perr := decodeError(t, resp)
+			if perr.Code != c.code {
+				t.Errorf("%s %q: got code %q, expected %q", route.Path, c.body, perr.Code, c.code)
+			}
+			fields := []string{}
+			for _, field := range perr.Fields {
+				fields = append(fields, field.Field)
+			}
+			if strings.Join(fields, ",") != strings.Join(c.fields, ",") {
+				t.Errorf("%s %q: got fields %v, expected %v", route.Path, c.body, fields, c.fields)
+			}
+		}
+	}
+}
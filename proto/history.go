@@ -0,0 +1,27 @@
+package proto
+
+import (
+	"context"
+
+	"github.com/CanPacis/tstud-core/db"
+)
+
+func Undo(ctx context.Context, data EmptyRequest) (*db.OperationDTO, error) {
+	return LibraryFromContext(ctx).History.Undo()
+}
+
+func Redo(ctx context.Context, data EmptyRequest) (*db.OperationDTO, error) {
+	return LibraryFromContext(ctx).History.Redo()
+}
+
+type ListHistoryRequest struct {
+	Limit int `json:"limit" validate:"min=0,max=100"`
+}
+
+func ListHistory(ctx context.Context, data ListHistoryRequest) ([]db.OperationDTO, error) {
+	if data.Limit == 0 {
+		data.Limit = 20
+	}
+
+	return LibraryFromContext(ctx).History.List(data.Limit)
+}
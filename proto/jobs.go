@@ -0,0 +1,42 @@
+package proto
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/CanPacis/tstud-core/db"
+)
+
+type StartJobRequest struct {
+	Kind   string          `json:"kind" validate:"required"`
+	Params json.RawMessage `json:"params"`
+}
+
+func StartJob(ctx context.Context, data StartJobRequest) (*db.JobDTO, error) {
+	return LibraryFromContext(ctx).Jobs.Enqueue(data.Kind, data.Params)
+}
+
+type JobRequest struct {
+	ID uint `json:"id" validate:"required"`
+}
+
+func JobStatus(ctx context.Context, data JobRequest) (*db.JobDTO, error) {
+	return LibraryFromContext(ctx).Jobs.Get(data.ID)
+}
+
+func CancelJob(ctx context.Context, data JobRequest) (*db.JobDTO, error) {
+	return LibraryFromContext(ctx).Jobs.Cancel(data.ID)
+}
+
+type ListJobRequest struct {
+	State string `json:"state" validate:"oneof=queued running done failed canceled"`
+	Limit int    `json:"limit" validate:"min=0,max=100"`
+}
+
+func ListJob(ctx context.Context, data ListJobRequest) ([]db.JobDTO, error) {
+	if data.Limit == 0 {
+		data.Limit = 20
+	}
+
+	return LibraryFromContext(ctx).Jobs.List(data.State, data.Limit)
+}
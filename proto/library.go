@@ -0,0 +1,108 @@
+package proto
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/CanPacis/tstud-core/p2pjson"
+	"github.com/CanPacis/tstud-core/tstud"
+)
+
+const DefaultLibrary = "default"
+
+// DefaultHosts address the default library, "tstud" is what the generated
+// clients send.
+var DefaultHosts = []string{"", "tstud", DefaultLibrary}
+
+// Library is an opened tstud library served under a url host.
+type Library struct {
+	Name string
+	*tstud.Library
+}
+
+type Registry struct {
+	mu        sync.RWMutex
+	def       *Library
+	libraries map[string]*Library
+}
+
+func NewRegistry(def *Library) *Registry {
+	return &Registry{
+		def:       def,
+		libraries: map[string]*Library{},
+	}
+}
+
+func (r *Registry) Register(lib *Library) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.libraries[lib.Name] = lib
+}
+
+func (r *Registry) Get(name string) (*Library, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	lib, ok := r.libraries[name]
+	return lib, ok
+}
+
+// Resolve returns the library a url host addresses.
+func (r *Registry) Resolve(host string) (*Library, error) {
+	if slices.Contains(DefaultHosts, host) {
+		return r.def, nil
+	}
+	if lib, ok := r.Get(host); ok {
+		return lib, nil
+	}
+	return nil, fmt.Errorf("%w %q", tstud.ErrUnknownLibrary, host)
+}
+
+// Serves reports whether host addresses one of the libraries.
+func (r *Registry) Serves(host string) bool {
+	_, err := r.Resolve(host)
+	return err == nil
+}
+
+func (r *Registry) Default() *Library {
+	return r.def
+}
+
+func (r *Registry) Libraries() []*Library {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	libs := []*Library{}
+	for _, lib := range r.libraries {
+		libs = append(libs, lib)
+	}
+	slices.SortFunc(libs, func(a, b *Library) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return libs
+}
+
+func WithLibrary(lib *Library, next p2pjson.HandlerFunc) p2pjson.HandlerFunc {
+	return func(r *p2pjson.Request) *p2pjson.Response {
+		r.Set("library", lib)
+		return next(r)
+	}
+}
+
+// WithRegistry resolves the library from the url host of every request, so
+// libraries registered later are reachable too.
+func WithRegistry(registry *Registry, next p2pjson.HandlerFunc) p2pjson.HandlerFunc {
+	return func(r *p2pjson.Request) *p2pjson.Response {
+		lib, err := registry.Resolve(r.URL.Host)
+		if err != nil {
+			return ErrorResponse(r, err)
+		}
+		r.Set("library", lib)
+		return next(r)
+	}
+}
+
+func LibraryFrom(r *p2pjson.Request) *Library {
+	return r.Get("library").(*Library)
+}
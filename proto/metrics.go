@@ -0,0 +1,48 @@
+package proto
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/CanPacis/tstud-core/metrics"
+	"github.com/CanPacis/tstud-core/p2pjson"
+)
+
+var requestsTotal = metrics.Default.Counter("tstud_requests_total", "Requests handled, by route and status code.", "route", "status")
+var requestDuration = metrics.Default.Histogram("tstud_request_duration_seconds", "Time spent handling requests.", nil, "route")
+var requestsInFlight = metrics.Default.Gauge("tstud_requests_in_flight", "Requests currently being handled.", "route")
+
+func Instrument(route string, next p2pjson.HandlerFunc) p2pjson.HandlerFunc {
+	return func(r *p2pjson.Request) *p2pjson.Response {
+		inFlight := requestsInFlight.With(route)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		// A handler that panics is counted as a 500, the mux recovers it and
+		// answers with one further up.
+		start := time.Now()
+		status := p2pjson.StatusInternalServerError
+		defer func() {
+			requestDuration.With(route).Observe(time.Since(start).Seconds())
+			requestsTotal.With(route, fmt.Sprintf("%d", status)).Inc()
+		}()
+
+		resp := next(r)
+		status = 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		return resp
+	}
+}
+
+func Metrics(r *p2pjson.Request) *p2pjson.Response {
+	encoded, err := json.Marshal(metrics.Default.Snapshot())
+	if err != nil {
+		return ErrorResponse(r, err)
+	}
+
+	return p2pjson.NewResponse(r, p2pjson.StatusOK, bytes.NewBuffer(encoded))
+}
@@ -0,0 +1,51 @@
+package proto
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/CanPacis/tstud-core/metrics"
+	"github.com/CanPacis/tstud-core/p2pjson"
+)
+
+// sample returns the value of the sample of family name with labels.
+func sample(name string, labels map[string]string) (metrics.Sample, bool) {
+	for _, family := range metrics.Default.Snapshot() {
+		if family.Name != name {
+			continue
+		}
+	samples:
+		for _, s := range family.Samples {
+			for key, value := range labels {
+				if s.Labels[key] != value {
+					continue samples
+				}
+			}
+			return s, true
+		}
+	}
+	return metrics.Sample{}, false
+}
+
+func TestInstrumentPanic(t *testing.T) {
+	route := "/_test/panic"
+	mux := p2pjson.NewMux()
+	mux.HandleFunc(route, Instrument(route, func(r *p2pjson.Request) *p2pjson.Response {
+		panic("boom")
+	}))
+
+	resp := mux.ServeP2PJSON(p2pjson.NewRequest("p2pjson://"+route, strings.NewReader(`{}`)))
+	if resp.StatusCode != p2pjson.StatusInternalServerError {
+		t.Fatalf("got status %d, expected 500", resp.StatusCode)
+	}
+
+	if s, ok := sample("tstud_requests_total", map[string]string{"route": route, "status": "500"}); !ok || s.Value != 1 {
+		t.Errorf("requests total: got %v %v, expected 1", s.Value, ok)
+	}
+	if s, ok := sample("tstud_request_duration_seconds", map[string]string{"route": route}); !ok || s.Count != 1 {
+		t.Errorf("request duration: got %d observations %v, expected 1", s.Count, ok)
+	}
+	if s, ok := sample("tstud_requests_in_flight", map[string]string{"route": route}); !ok || s.Value != 0 {
+		t.Errorf("requests in flight: got %v %v, expected 0", s.Value, ok)
+	}
+}
@@ -1,25 +1,22 @@
 package proto
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"io"
+	"mime"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
 
-	"github.com/CanPacis/tstud-core/controllers"
-	"github.com/CanPacis/tstud-core/db"
+	"github.com/CanPacis/tstud-core/metrics"
 	"github.com/CanPacis/tstud-core/p2pjson"
+	"github.com/CanPacis/tstud-core/tstud"
 )
 
-var FileController *controllers.FileController
-var TagController *controllers.TagController
-
-func init() {
-	dbs, err := db.Connect()
-	if err != nil {
-		panic(err)
-	}
-	FileController = controllers.NewFileController(dbs)
-	TagController = controllers.NewTagController(dbs)
-}
-
 /*
 /file/index { path: string; dir: boolean; recursive: boolean; exclude: string[]; }
 /file/unindex { path: string; dir: boolean; recursive: boolean; exclude: string[]; }
@@ -30,37 +27,182 @@ func init() {
 /file/meta/unset/author { file_id:number; }
 /file/meta/set/description { file_id:number; description: string; }
 /file/meta/unset/description { file_id:number; }
-/file/list { page: number; per_page: number; }
-/file/search { page: number; per_page: number; term: string; tags: string[] }
-/file/details { file_id: number; }
+/file/meta/set { file_id: number; key: string; value: string; }
+/file/meta/unset { file_id: number; key: string; }
+/file/list { page: number; per_page: number; } streams the page, every file when per_page is 0
+/file/search { page: number; per_page: number; term: string; tags: string[]; author: string; description: string; where: string[]; sort: string; desc: boolean; } streams like /file/list
+/file/details { file_id: number; path: string; }
+/file/export {} streams every file as a partial content frame
 
 /tag/create { name: string; parent_id: number; }
 /tag/delete { tag_id: number; }
 /tag/alias { tag_id: number; alias_name: string; }
 /tag/unalias { tag_id: number; alias_id: number; }
-/tag/parent { tag_id: number; parent_tag_id: number; }
+/tag/parent { tag_id: number; parent_tag_id: number | null; }
 /tag/list { page: number; per_page: number; parent_id: number; all: boolean; }
+/tag/ancestors { tag_id: number; }
+/tag/descendants { tag_id: number; }
 /tag/search { page: number; per_page: number; term: string }
+
+/field/create { name: string; type: string; values: string[]; }
+/field/delete { name: string; }
+/field/list {}
+
+/jobs/start { kind: string; params: any; } kinds are index and unindex with { path: string; recursive: boolean; exclude: string[]; } and rehash with { all: boolean; }
+/jobs/status { id: number; }
+/jobs/cancel { id: number; }
+/jobs/list { state: string; limit: number; }
+
+/history/undo {}
+/history/redo {}
+/history/list { limit: number; }
+
+/_meta/metrics {}
 */
 
-func Run() {
+type Route struct {
+	Path     string
+	Handler  p2pjson.HandlerFunc
+	Request  reflect.Type
+	Response reflect.Type
+	// Stream routes reply with one partial content frame per Response item.
+	Stream bool
+}
+
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+type EmptyRequest struct{}
+
+var Routes = []Route{
+	Handle("/file/index", p2pjson.StatusCreated, IndexFile),
+	Handle("/file/unindex", p2pjson.StatusOK, UnindexFile),
+	Handle("/file/rename", p2pjson.StatusOK, RenameFile),
+	Handle("/file/tag", p2pjson.StatusOK, TagFile),
+	Handle("/file/untag", p2pjson.StatusOK, UntagFile),
+	Handle("/file/meta/set/author", p2pjson.StatusOK, SetAuthor),
+	Handle("/file/meta/unset/author", p2pjson.StatusOK, UnsetAuthor),
+	Handle("/file/meta/set/description", p2pjson.StatusOK, SetDescription),
+	Handle("/file/meta/unset/description", p2pjson.StatusOK, UnsetDescription),
+	Handle("/file/meta/set", p2pjson.StatusOK, SetField),
+	Handle("/file/meta/unset", p2pjson.StatusOK, UnsetField),
+	HandleStream("/file/list", ListFile),
+	HandleStream("/file/search", SearchFile),
+	Handle("/file/details", p2pjson.StatusOK, FileDetails),
+	HandleStream("/file/export", ExportFiles),
+
+	Handle("/tag/create", p2pjson.StatusCreated, CreateTag),
+	Handle("/tag/delete", p2pjson.StatusOK, DeleteTag),
+	Handle("/tag/alias", p2pjson.StatusOK, AliasTag),
+	Handle("/tag/unalias", p2pjson.StatusOK, UnaliasTag),
+	Handle("/tag/parent", p2pjson.StatusOK, ParentTag),
+	Handle("/tag/list", p2pjson.StatusOK, ListTag),
+	Handle("/tag/ancestors", p2pjson.StatusOK, TagAncestors),
+	Handle("/tag/descendants", p2pjson.StatusOK, TagDescendants),
+	Handle("/tag/search", p2pjson.StatusOK, SearchTag),
+
+	Handle("/field/create", p2pjson.StatusCreated, CreateField),
+	Handle("/field/delete", p2pjson.StatusOK, DeleteField),
+	Handle("/field/list", p2pjson.StatusOK, ListField),
+
+	Handle("/jobs/start", p2pjson.StatusAccepted, StartJob),
+	Handle("/jobs/status", p2pjson.StatusOK, JobStatus),
+	Handle("/jobs/cancel", p2pjson.StatusOK, CancelJob),
+	Handle("/jobs/list", p2pjson.StatusOK, ListJob),
+
+	Handle("/history/undo", p2pjson.StatusOK, Undo),
+	Handle("/history/redo", p2pjson.StatusOK, Redo),
+	Handle("/history/list", p2pjson.StatusOK, ListHistory),
+
+	{"/_meta/metrics", Metrics, reflect.TypeFor[EmptyRequest](), reflect.TypeFor[[]metrics.Family](), false},
+}
+
+func NewMux(lib *Library) *p2pjson.Mux {
+	mux := p2pjson.NewMux()
+	for _, route := range Routes {
+		mux.HandleFunc(route.Path, Instrument(route.Path, WithLibrary(lib, route.Handler)))
+	}
+	return mux
+}
+
+// NewHandler routes requests to the library named by the url host, e.g.
+// p2pjson://work/file/list. Requests for hosts that are neither one of
+// DefaultHosts nor registered fail with unknown_library.
+func NewHandler(registry *Registry) *p2pjson.Mux {
 	mux := p2pjson.NewMux()
-	peer := p2pjson.New(p2pjson.NewStdIOPeer())
+	for _, route := range Routes {
+		mux.HandleFunc(route.Path, Instrument(route.Path, WithRegistry(registry, route.Handler)))
+	}
+	return mux
+}
+
+// Run serves the default library over stdio. Background jobs outlive the
+// frontend, Run returns once they are done or on an interrupt.
+func Run() error {
+	lib, err := tstud.Open(tstud.Options{})
+	if err != nil {
+		return err
+	}
+	defer lib.Close()
 
-	mux.HandleFunc("/tag/create", JsonMiddleWare(CreateTag))
-	mux.HandleFunc("/tag/delete", JsonMiddleWare(DeleteTag))
-	mux.HandleFunc("/tag/alias", JsonMiddleWare(AliasTag))
-	mux.HandleFunc("/tag/unalias", JsonMiddleWare(UnaliasTag))
-	mux.HandleFunc("/tag/parent", JsonMiddleWare(ParentTag))
-	mux.HandleFunc("/tag/list", JsonMiddleWare(ListTag))
-	mux.HandleFunc("/tag/search", JsonMiddleWare(SearchTag))
+	if err := lib.Jobs.Start(); err != nil {
+		return err
+	}
+
+	registry := NewRegistry(&Library{Name: DefaultLibrary, Library: lib})
+	Serve(registry, p2pjson.New(p2pjson.NewStdIOPeer()))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	lib.Jobs.Drain(ctx)
+	return nil
+}
+
+func Serve(registry *Registry, peer *p2pjson.Peer) {
+	peer.Listen(NewServer(registry))
+}
+
+// NewServer wraps the library routes with the core's load limits.
+func NewServer(registry *Registry) p2pjson.Handler {
+	return NewLimiter().Limit(NewHandler(registry))
+}
 
-	peer.Listen(mux)
+// NewLimiter returns a limiter with the core's load limits and route weights.
+func NewLimiter() *p2pjson.Limiter {
+	return p2pjson.NewLimiter(p2pjson.LimitOptions{
+		MaxInFlight:  16,
+		MaxPerPeer:   8,
+		MaxQueue:     64,
+		MaxPeerQueue: 32,
+		RetryAfter:   time.Second,
+		Weights: map[string]int{
+			"/file/index":   8,
+			"/file/unindex": 4,
+			"/file/list":    2,
+			"/file/search":  2,
+			"/file/export":  4,
+			"/tag/search":   2,
+		},
+	})
 }
 
 func JsonMiddleWare(next p2pjson.HandlerFunc) p2pjson.HandlerFunc {
 	return func(r *p2pjson.Request) *p2pjson.Response {
-		raw, err := io.ReadAll(r.Body)
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+		var raw []byte
+		var err error
+		switch mediaType {
+		case "", p2pjson.ContentTypeJSON:
+			raw, err = io.ReadAll(r.Body)
+		case p2pjson.ContentTypeMultipart:
+			var part json.RawMessage
+			err = r.DecodeJSON(&part)
+			raw = part
+		default:
+			return p2pjson.ErrorResponse(r, p2pjson.StatusUnsupportedMediaType, fmt.Errorf("unsupported content type %s", mediaType))
+		}
 		if err != nil {
 			return p2pjson.ErrorResponse(r, p2pjson.StatusBadRequest, err)
 		}
@@ -1,118 +1,85 @@
 package proto
 
 import (
-	"bytes"
-	"encoding/json"
-	"errors"
+	"context"
 
 	"github.com/CanPacis/tstud-core/controllers"
-	"github.com/CanPacis/tstud-core/p2pjson"
+	"github.com/CanPacis/tstud-core/db"
 )
 
-func CreateTag(r *p2pjson.Request) *p2pjson.Response {
-	var data struct {
-		Name     string `json:"name"`
-		ParentID int    `json:"parent_id"`
-	}
-	err := json.Unmarshal(r.Get("body").([]byte), &data)
-	if err != nil {
-		return p2pjson.ErrorResponse(r, p2pjson.StatusBadRequest, err)
-	}
+type CreateTagRequest struct {
+	Name     string `json:"name" validate:"required,max=128"`
+	ParentID int    `json:"parent_id" validate:"min=0"`
+}
 
+func CreateTag(ctx context.Context, data CreateTagRequest) (*db.TagDTO, error) {
 	var parentId *int
 
 	if data.ParentID != 0 {
 		parentId = &data.ParentID
 	}
-	tag, err := TagController.Create(data.Name, parentId)
-	if err != nil {
-		return p2pjson.ErrorResponse(r, p2pjson.StatusInternalServerError, err)
-	}
-
-	encoded, err := json.Marshal(tag)
-	if err != nil {
-		return p2pjson.ErrorResponse(r, p2pjson.StatusInternalServerError, err)
-	}
+	return LibraryFromContext(ctx).Tag.Create(data.Name, parentId)
+}
 
-	return p2pjson.NewResponse(r, p2pjson.StatusCreated, bytes.NewBuffer(encoded))
+type DeleteTagRequest struct {
+	ID uint `json:"id" validate:"required"`
 }
 
-func DeleteTag(r *p2pjson.Request) *p2pjson.Response {
-	var data struct {
-		ID uint `json:"id"`
-	}
-	err := json.Unmarshal(r.Get("body").([]byte), &data)
-	if err != nil {
-		return p2pjson.ErrorResponse(r, p2pjson.StatusBadRequest, err)
-	}
+func DeleteTag(ctx context.Context, data DeleteTagRequest) (*db.TagDTO, error) {
+	return LibraryFromContext(ctx).Tag.Delete(data.ID)
+}
 
-	tag, err := TagController.Delete(data.ID)
-	if err != nil {
-		return p2pjson.ErrorResponse(r, p2pjson.StatusInternalServerError, err)
-	}
+type AliasTagRequest struct {
+	ID   uint   `json:"id" validate:"required"`
+	Name string `json:"string" validate:"required,max=128"`
+}
 
-	encoded, err := json.Marshal(tag)
+func AliasTag(ctx context.Context, data AliasTagRequest) (MessageResponse, error) {
+	err := LibraryFromContext(ctx).Tag.Alias(data.ID, data.Name)
 	if err != nil {
-		return p2pjson.ErrorResponse(r, p2pjson.StatusInternalServerError, err)
+		return MessageResponse{}, err
 	}
 
-	return p2pjson.NewResponse(r, p2pjson.StatusOK, bytes.NewBuffer(encoded))
+	return MessageResponse{Message: "done"}, nil
 }
 
-func AliasTag(r *p2pjson.Request) *p2pjson.Response {
-	var data struct {
-		ID   uint   `json:"id"`
-		Name string `json:"string"`
-	}
-	err := json.Unmarshal(r.Get("body").([]byte), &data)
-	if err != nil {
-		return p2pjson.ErrorResponse(r, p2pjson.StatusBadRequest, err)
-	}
+type UnaliasTagRequest struct {
+	ID   uint   `json:"id" validate:"required"`
+	Name string `json:"string" validate:"required"`
+}
 
-	err = TagController.Alias(data.ID, data.Name)
+func UnaliasTag(ctx context.Context, data UnaliasTagRequest) (MessageResponse, error) {
+	err := LibraryFromContext(ctx).Tag.Unlias(data.ID, data.Name)
 	if err != nil {
-		return p2pjson.ErrorResponse(r, p2pjson.StatusInternalServerError, err)
+		return MessageResponse{}, err
 	}
 
-	encoded, _ := json.Marshal(map[string]any{"message": "done"})
-	return p2pjson.NewResponse(r, p2pjson.StatusOK, bytes.NewBuffer(encoded))
+	return MessageResponse{Message: "done"}, nil
 }
 
-func UnaliasTag(r *p2pjson.Request) *p2pjson.Response {
-	var data struct {
-		ID   uint   `json:"id"`
-		Name string `json:"string"`
-	}
-	err := json.Unmarshal(r.Get("body").([]byte), &data)
-	if err != nil {
-		return p2pjson.ErrorResponse(r, p2pjson.StatusBadRequest, err)
-	}
+type ParentTagRequest struct {
+	TagID       uint  `json:"tag_id" validate:"required"`
+	ParentTagID *uint `json:"parent_tag_id"`
+}
 
-	err = TagController.Unlias(data.ID, data.Name)
-	if err != nil {
-		return p2pjson.ErrorResponse(r, p2pjson.StatusInternalServerError, err)
+func ParentTag(ctx context.Context, data ParentTagRequest) (*db.TagDTO, error) {
+	// Both null and 0 detach the tag to the root.
+	parentId := data.ParentTagID
+	if parentId != nil && *parentId == 0 {
+		parentId = nil
 	}
 
-	encoded, _ := json.Marshal(map[string]any{"message": "done"})
-	return p2pjson.NewResponse(r, p2pjson.StatusOK, bytes.NewBuffer(encoded))
+	return LibraryFromContext(ctx).Tag.SetParent(data.TagID, parentId)
 }
 
-func ParentTag(r *p2pjson.Request) *p2pjson.Response {
-	return p2pjson.ErrorResponse(r, p2pjson.StatusNotImplemented, errors.New("tag/parent not implemented"))
+type ListTagRequest struct {
+	Page     int  `json:"page" validate:"min=0"`
+	PerPage  int  `json:"per_page" validate:"min=0,max=100"`
+	ParentID int  `json:"parent_id" validate:"min=0"`
+	All      bool `json:"all"`
 }
 
-func ListTag(r *p2pjson.Request) *p2pjson.Response {
-	var data struct {
-		Page     int  `json:"page"`
-		PerPage  int  `json:"per_page"`
-		ParentID int  `json:"parent_id"`
-		All      bool `json:"all"`
-	}
-	err := json.Unmarshal(r.Get("body").([]byte), &data)
-	if err != nil {
-		return p2pjson.ErrorResponse(r, p2pjson.StatusBadRequest, err)
-	}
-
+func ListTag(ctx context.Context, data ListTagRequest) (*controllers.PaginatedResource[db.TagDTO], error) {
 	var parentId *int
 
 	if data.ParentID != 0 {
@@ -123,42 +90,34 @@ func ListTag(r *p2pjson.Request) *p2pjson.Response {
 		parentId = &all
 	}
 
-	result, err := TagController.List(parentId)
-	if err != nil {
-		return p2pjson.ErrorResponse(r, p2pjson.StatusInternalServerError, err)
-	}
+	return LibraryFromContext(ctx).Tag.List(parentId)
+}
 
-	encoded, err := json.Marshal(result)
-	if err != nil {
-		return p2pjson.ErrorResponse(r, p2pjson.StatusInternalServerError, err)
-	}
+type TagTreeRequest struct {
+	TagID uint `json:"tag_id" validate:"required"`
+}
 
-	return p2pjson.NewResponse(r, p2pjson.StatusOK, bytes.NewBuffer(encoded))
+func TagAncestors(ctx context.Context, data TagTreeRequest) (*controllers.PaginatedResource[db.TagDTO], error) {
+	return LibraryFromContext(ctx).Tag.Ancestors(data.TagID)
 }
 
-func SearchTag(r *p2pjson.Request) *p2pjson.Response {
-	var data struct {
-		Page    int    `json:"page"`
-		PerPage int    `json:"per_page"`
-		Term    string `json:"term"`
-	}
-	err := json.Unmarshal(r.Get("body").([]byte), &data)
-	if err != nil {
-		return p2pjson.ErrorResponse(r, p2pjson.StatusBadRequest, err)
+func TagDescendants(ctx context.Context, data TagTreeRequest) (*controllers.PaginatedResource[db.TagDTO], error) {
+	return LibraryFromContext(ctx).Tag.Descendants(data.TagID)
+}
+
+type SearchTagRequest struct {
+	Page    int    `json:"page" validate:"min=0"`
+	PerPage int    `json:"per_page" validate:"min=0,max=100"`
+	Term    string `json:"term"`
+}
+
+func SearchTag(ctx context.Context, data SearchTagRequest) (*controllers.PaginatedResource[db.TagDTO], error) {
+	if data.PerPage == 0 {
+		data.PerPage = 10
 	}
 
-	result, err := TagController.Search(data.Term, controllers.ListOptions{
+	return LibraryFromContext(ctx).Tag.Search(data.Term, controllers.ListOptions{
 		Page:    data.Page,
 		PerPage: data.PerPage,
 	})
-	if err != nil {
-		return p2pjson.ErrorResponse(r, p2pjson.StatusInternalServerError, err)
-	}
-
-	encoded, err := json.Marshal(result)
-	if err != nil {
-		return p2pjson.ErrorResponse(r, p2pjson.StatusInternalServerError, err)
-	}
-
-	return p2pjson.NewResponse(r, p2pjson.StatusOK, bytes.NewBuffer(encoded))
 }
@@ -0,0 +1,156 @@
+package proto
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/CanPacis/tstud-core/p2pjson"
+)
+
+// Validate checks the validate struct tags of v and returns a field error for
+// every rule that fails. Supported rules are required, min=<n>, max=<n> and
+// oneof=<a b c>. min and max bound the value of numbers and the length of
+// strings, slices and maps. oneof accepts zero values, combine it with
+// required otherwise. Fields are reported by their json name.
+//
+//	type Request struct {
+//		Name  string `json:"name" validate:"required,max=64"`
+//		Order string `json:"order" validate:"oneof=asc desc"`
+//	}
+func Validate(v any) []p2pjson.FieldError {
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+
+	return validateStruct(value, "")
+}
+
+func validateStruct(value reflect.Value, prefix string) []p2pjson.FieldError {
+	errs := []p2pjson.FieldError{}
+	t := value.Type()
+
+	for i := range t.NumField() {
+		field := t.Field(i)
+		fv := value.Field(i)
+		// Like encoding/json, fields of unexported embedded structs count.
+		if !field.IsExported() && !(field.Anonymous && fv.Kind() == reflect.Struct) {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if len(name) == 0 {
+			name = field.Name
+		}
+
+		if field.Anonymous && fv.Kind() == reflect.Struct {
+			errs = append(errs, validateStruct(fv, prefix)...)
+			continue
+		}
+
+		name = prefix + name
+		rules := field.Tag.Get("validate")
+		if len(rules) > 0 {
+			errs = append(errs, validateField(fv, name, rules)...)
+		}
+
+		for fv.Kind() == reflect.Pointer && !fv.IsNil() {
+			fv = fv.Elem()
+		}
+		if fv.Kind() == reflect.Struct {
+			errs = append(errs, validateStruct(fv, name+".")...)
+		}
+	}
+
+	return errs
+}
+
+func validateField(value reflect.Value, name, rules string) []p2pjson.FieldError {
+	errs := []p2pjson.FieldError{}
+
+	for _, rule := range strings.Split(rules, ",") {
+		rule, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+
+		if rule == "required" {
+			if value.IsZero() {
+				errs = append(errs, p2pjson.FieldError{Field: name, Code: "required", Message: "is required"})
+			}
+			continue
+		}
+
+		// The remaining rules only apply to values that are present.
+		v := value
+		for v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				break
+			}
+			v = v.Elem()
+		}
+		if v.Kind() == reflect.Pointer {
+			continue
+		}
+
+		switch rule {
+		case "min", "max":
+			bound, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				panic(fmt.Sprintf("proto: invalid %s rule on %s: %s", rule, name, arg))
+			}
+
+			n, unit := measure(v)
+			if rule == "min" && n < bound {
+				errs = append(errs, p2pjson.FieldError{Field: name, Code: "min", Message: boundMessage("at least", arg, unit)})
+			}
+			if rule == "max" && n > bound {
+				errs = append(errs, p2pjson.FieldError{Field: name, Code: "max", Message: boundMessage("at most", arg, unit)})
+			}
+		case "oneof":
+			options := strings.Fields(arg)
+			if !v.IsZero() && !slices.Contains(options, fmt.Sprint(v.Interface())) {
+				errs = append(errs, p2pjson.FieldError{Field: name, Code: "oneof", Message: fmt.Sprintf("must be one of %s", strings.Join(options, ", "))})
+			}
+		default:
+			panic(fmt.Sprintf("proto: unknown validation rule %q on %s", rule, name))
+		}
+	}
+
+	return errs
+}
+
+// measure returns the number min and max compare against, and the unit of a
+// length or an empty string for plain numbers.
+func measure(v reflect.Value) (float64, string) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(len([]rune(v.String()))), "characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), "items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), ""
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), ""
+	default:
+		return 0, ""
+	}
+}
+
+func boundMessage(relation, arg, unit string) string {
+	if len(unit) > 0 {
+		return fmt.Sprintf("must have %s %s %s", relation, arg, unit)
+	}
+	return fmt.Sprintf("must be %s %s", relation, arg)
+}
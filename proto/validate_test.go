@@ -0,0 +1,56 @@
+package proto
+
+import (
+	"strings"
+	"testing"
+)
+
+type validatePage struct {
+	Page int `json:"page" validate:"min=0"`
+}
+
+type validateInner struct {
+	ID uint `json:"id" validate:"required"`
+}
+
+type validateRequest struct {
+	validatePage
+	Name   string         `json:"name" validate:"required,max=3"`
+	Order  string         `json:"order" validate:"oneof=asc desc"`
+	Tags   []string       `json:"tags" validate:"max=2"`
+	Parent *int           `json:"parent" validate:"min=1"`
+	Inner  *validateInner `json:"inner"`
+	Skip   string         `json:"-" validate:"required"`
+}
+
+func TestValidate(t *testing.T) {
+	zero, one := 0, 1
+	cases := []struct {
+		request validateRequest
+		fields  string
+	}{
+		{validateRequest{Name: "abc", Skip: "x"}, ""},
+		{validateRequest{Name: "abc", Order: "desc", Parent: &one, Inner: &validateInner{ID: 1}, Skip: "x"}, ""},
+		{validateRequest{Skip: "x"}, "name:required"},
+		{validateRequest{Name: "abcd", Skip: "x"}, "name:max"},
+		{validateRequest{Name: "abc", Order: "up", Skip: "x"}, "order:oneof"},
+		{validateRequest{Name: "abc", Tags: []string{"a", "b", "c"}, Skip: "x"}, "tags:max"},
+		{validateRequest{Name: "abc", Parent: &zero, Skip: "x"}, "parent:min"},
+		{validateRequest{Name: "abc", Inner: &validateInner{}, Skip: "x"}, "inner.id:required"},
+		{validateRequest{validatePage: validatePage{Page: -1}, Name: "abc", Skip: "x"}, "page:min"},
+	}
+
+	for _, c := range cases {
+		got := []string{}
+		for _, err := range Validate(c.request) {
+			got = append(got, err.Field+":"+err.Code)
+		}
+		if strings.Join(got, ",") != c.fields {
+			t.Errorf("%+v: got %v, expected %q", c.request, got, c.fields)
+		}
+	}
+
+	if errs := Validate(&validateRequest{}); len(errs) != 1 {
+		t.Errorf("pointer: got %v", errs)
+	}
+}
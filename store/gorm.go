@@ -0,0 +1,505 @@
+// Package store implements the controller repositories, on top of gorm for
+// persistent libraries and in memory for tests and throwaway libraries.
+package store
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/CanPacis/tstud-core/db"
+	"gorm.io/gorm"
+)
+
+type GormFiles struct {
+	DB *gorm.DB
+}
+
+func NewGormFiles(dbs *gorm.DB) *GormFiles {
+	return &GormFiles{DB: dbs}
+}
+
+// Create revives the soft deleted row of a path indexed before, with the new
+// metadata and without its old tags and field values. The row keeps its ID so
+// history entries about it stay valid.
+func (r *GormFiles) Create(files []db.File) error {
+	if len(files) == 0 {
+		return nil
+	}
+
+	paths := []string{}
+	for _, file := range files {
+		paths = append(paths, file.FilePath)
+	}
+
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var deleted []db.File
+		err := tx.Unscoped().Where("file_path IN ? AND deleted_at IS NOT NULL", paths).Find(&deleted).Error
+		if err != nil {
+			return err
+		}
+		deletedIDs := map[string]uint{}
+		for _, file := range deleted {
+			deletedIDs[file.FilePath] = file.ID
+		}
+
+		fresh := []*db.File{}
+		for i := range files {
+			file := &files[i]
+			id, ok := deletedIDs[file.FilePath]
+			if !ok {
+				fresh = append(fresh, file)
+				continue
+			}
+
+			file.ID = id
+			file.CreatedAt = time.Now()
+			if err := tx.Unscoped().Omit("Tags", "Fields").Save(file).Error; err != nil {
+				return err
+			}
+			if err := tx.Exec("DELETE FROM file_tags WHERE file_id = ?", id).Error; err != nil {
+				return err
+			}
+			if err := tx.Delete(&db.FileField{}, "file_id = ?", id).Error; err != nil {
+				return err
+			}
+		}
+
+		if len(fresh) == 0 {
+			return nil
+		}
+		return tx.Create(fresh).Error
+	})
+}
+
+func (r *GormFiles) Get(id uint) (*db.File, error) {
+	var file db.File
+	tx := r.DB.Preload("Tags").Preload("Fields.Field").First(&file, "id = ?", id)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &file, nil
+}
+
+func (r *GormFiles) GetByPath(path string) (*db.File, error) {
+	var file db.File
+	tx := r.DB.Preload("Tags").Preload("Fields.Field").First(&file, "file_path = ?", path)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &file, nil
+}
+
+func (r *GormFiles) Indexed(paths []string) ([]string, error) {
+	result := []string{}
+	if len(paths) == 0 {
+		return result, nil
+	}
+	tx := r.DB.Model(&db.File{}).Where("file_path IN ?", paths).Pluck("file_path", &result)
+	return result, tx.Error
+}
+
+func (r *GormFiles) Save(file *db.File) error {
+	return r.DB.Omit("Tags", "Fields").Save(file).Error
+}
+
+func (r *GormFiles) Delete(id uint) error {
+	tx := r.DB.Delete(&db.File{}, "id = ?", id)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *GormFiles) AddTag(fileId, tagId uint) error {
+	return r.DB.Model(&db.File{Model: gorm.Model{ID: fileId}}).Association("Tags").Append(&db.Tag{Model: gorm.Model{ID: tagId}})
+}
+
+func (r *GormFiles) RemoveTag(fileId, tagId uint) error {
+	return r.DB.Model(&db.File{Model: gorm.Model{ID: fileId}}).Association("Tags").Delete(&db.Tag{Model: gorm.Model{ID: tagId}})
+}
+
+func (r *GormFiles) List(offset, limit int) ([]db.File, error) {
+	var files []db.File
+	tx := r.DB.Order("file_path desc").Limit(limit).Offset(offset).Find(&files)
+	return files, tx.Error
+}
+
+func (r *GormFiles) Count() (int64, error) {
+	var count int64
+	tx := r.DB.Model(&db.File{}).Count(&count)
+	return count, tx.Error
+}
+
+func (r *GormFiles) After(id uint, limit int) ([]db.File, error) {
+	var files []db.File
+	tx := r.DB.Preload("Tags").Preload("Fields.Field").Order("id asc").Limit(limit).Find(&files, "id > ?", id)
+	return files, tx.Error
+}
+
+func (r *GormFiles) Tagged(tagIds []uint, offset, limit int) ([]db.File, error) {
+	if len(tagIds) == 0 {
+		return []db.File{}, nil
+	}
+
+	var fileTags []struct {
+		FileID uint
+		TagID  uint
+	}
+	tx := r.DB.Table("file_tags").Find(&fileTags, "tag_id IN ?", tagIds)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	var fileIds []uint
+	for _, fileTag := range fileTags {
+		fileIds = append(fileIds, fileTag.FileID)
+	}
+
+	var files []db.File
+	tx = r.DB.Order("file_path desc").Limit(limit).Offset(offset).Find(&files, "id IN ?", fileIds)
+	return files, tx.Error
+}
+
+// Named matches the last element of the path exactly, like File.Name.
+func (r *GormFiles) Named(names []string, offset, limit int) ([]db.File, error) {
+	files := []db.File{}
+
+	clauses := []string{}
+	args := []any{}
+	for _, name := range names {
+		if len(name) == 0 || strings.Contains(name, "/") {
+			continue
+		}
+		clauses = append(clauses, "file_path = ? OR substr(file_path, -length(?) - 1) = ?")
+		args = append(args, name, name, "/"+name)
+	}
+	if len(clauses) == 0 {
+		return files, nil
+	}
+
+	tx := r.DB.Order("id asc").Limit(limit).Offset(offset).Where(strings.Join(clauses, " OR "), args...).Find(&files)
+	return files, tx.Error
+}
+
+var filterOps = map[string]string{
+	"=":  "=",
+	"!=": "!=",
+	"<":  "<",
+	"<=": "<=",
+	">":  ">",
+	">=": ">=",
+	"~":  "LIKE",
+}
+
+func (r *GormFiles) Query(query db.FileQuery, offset, limit int) ([]db.File, int64, error) {
+	q := r.DB.Model(&db.File{})
+	if query.FileIDs != nil {
+		q = q.Where("files.id IN ?", query.FileIDs)
+	}
+
+	for i, filter := range query.Filters {
+		op, ok := filterOps[filter.Op]
+		if !ok {
+			return nil, 0, fmt.Errorf("unknown filter operator %q", filter.Op)
+		}
+
+		var value any = filter.Value.Value
+		var column string
+		if filter.Field.Builtin() {
+			column = "files." + filter.Field.Name
+			q = q.Where(fmt.Sprintf("%s <> ''", column))
+		} else {
+			alias := fmt.Sprintf("filter%d", i)
+			q = q.Joins(fmt.Sprintf("JOIN file_fields %[1]s ON %[1]s.file_id = files.id AND %[1]s.field_id = ?", alias), filter.Field.ID)
+			column = alias + ".value"
+			if filter.Op != "~" && filter.Field.Numeric() && filter.Value.Number != nil {
+				value = *filter.Value.Number
+				column = alias + ".number"
+			}
+		}
+
+		if filter.Op == "~" {
+			value = fmt.Sprintf("%%%s%%", filter.Value.Value)
+		}
+		q = q.Where(fmt.Sprintf("%s %s ?", column, op), value)
+	}
+
+	// Counting must not leak into the query below.
+	q = q.Session(&gorm.Session{})
+
+	var count int64
+	if err := q.Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if query.Sort != nil {
+		direction := "asc"
+		if query.Desc {
+			direction = "desc"
+		}
+
+		if query.Sort.Builtin() {
+			column := "files." + query.Sort.Name
+			q = q.Order(fmt.Sprintf("coalesce(%s, '') = ''", column)).
+				Order(fmt.Sprintf("%s %s", column, direction))
+		} else {
+			column := "sorted.value"
+			if query.Sort.Numeric() {
+				column = "sorted.number"
+			}
+
+			q = q.Joins("LEFT JOIN file_fields sorted ON sorted.file_id = files.id AND sorted.field_id = ?", query.Sort.ID).
+				Order("sorted.field_id IS NULL").
+				Order(fmt.Sprintf("%s %s", column, direction))
+		}
+	}
+
+	var files []db.File
+	tx := q.Preload("Fields.Field").Order("files.file_path desc").Limit(limit).Offset(offset).Find(&files)
+	return files, count, tx.Error
+}
+
+type GormTags struct {
+	DB *gorm.DB
+}
+
+func NewGormTags(dbs *gorm.DB) *GormTags {
+	return &GormTags{DB: dbs}
+}
+
+func (r *GormTags) Create(tag *db.Tag) error {
+	return r.DB.Create(tag).Error
+}
+
+func (r *GormTags) Get(id uint) (*db.Tag, error) {
+	var tag db.Tag
+	tx := r.DB.Preload("Parent").Preload("Aliases").First(&tag, "id = ?", id)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &tag, nil
+}
+
+func (r *GormTags) GetByName(name string) (*db.Tag, error) {
+	var tag db.Tag
+	tx := r.DB.Preload("Parent").Preload("Aliases").First(&tag, "tag_name = ?", name)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &tag, nil
+}
+
+func (r *GormTags) Delete(id uint) error {
+	tx := r.DB.Delete(&db.Tag{}, "id = ?", id)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *GormTags) SetParent(id uint, parentId *int) error {
+	return r.DB.Model(&db.Tag{}).Where("id = ?", id).Update("parent_id", parentId).Error
+}
+
+func (r *GormTags) AddAlias(tagId uint, alias *db.Alias) error {
+	return r.DB.Model(&db.Tag{Model: gorm.Model{ID: tagId}}).Association("Aliases").Append(alias)
+}
+
+func (r *GormTags) DeleteAlias(id uint) error {
+	return r.DB.Delete(&db.Alias{}, "id = ?", id).Error
+}
+
+func (r *GormTags) Children(parentId *uint) ([]db.Tag, error) {
+	var tags []db.Tag
+	query := r.DB.Order("tag_name desc").Preload("Parent").Preload("Aliases")
+	if parentId == nil {
+		query = query.Where("parent_id IS NULL")
+	} else {
+		query = query.Where("parent_id = ?", *parentId)
+	}
+	tx := query.Find(&tags)
+	return tags, tx.Error
+}
+
+func (r *GormTags) All() ([]db.Tag, error) {
+	var tags []db.Tag
+	tx := r.DB.Order("tag_name desc").Preload("Parent").Preload("Aliases").Find(&tags)
+	return tags, tx.Error
+}
+
+// subtreeQuery selects the tags in ? and every tag below them. UNION drops
+// rows it has already seen, so the walk ends even if parents form a cycle.
+const subtreeQuery = `WITH RECURSIVE subtree(id) AS (
+	SELECT id FROM tags WHERE id IN ? AND deleted_at IS NULL
+	UNION
+	SELECT tags.id FROM tags JOIN subtree ON tags.parent_id = subtree.id WHERE tags.deleted_at IS NULL
+) SELECT id FROM subtree ORDER BY id`
+
+// pathQuery selects the tag ? and every tag above it.
+const pathQuery = `WITH RECURSIVE path(id) AS (
+	SELECT id FROM tags WHERE id = ? AND deleted_at IS NULL
+	UNION
+	SELECT tags.parent_id FROM tags JOIN path ON tags.id = path.id WHERE tags.parent_id IS NOT NULL AND tags.deleted_at IS NULL
+) SELECT id FROM path`
+
+func (r *GormTags) Ancestors(id uint) ([]db.Tag, error) {
+	ids := []uint{}
+	if err := r.DB.Raw(pathQuery, id).Scan(&ids).Error; err != nil {
+		return nil, err
+	}
+
+	var tags []db.Tag
+	tx := r.DB.Preload("Parent").Preload("Aliases").Find(&tags, "id IN ?", ids)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	byId := map[uint]db.Tag{}
+	for _, tag := range tags {
+		byId[tag.ID] = tag
+	}
+
+	// The query leaves the order to sqlite, follow the parents instead.
+	result := []db.Tag{}
+	seen := map[uint]bool{id: true}
+	for tag, ok := byId[id]; ok && tag.ParentID != nil; {
+		parentId := uint(*tag.ParentID)
+		if seen[parentId] {
+			break
+		}
+		seen[parentId] = true
+
+		tag, ok = byId[parentId]
+		if ok {
+			result = append(result, tag)
+		}
+	}
+	return result, nil
+}
+
+func (r *GormTags) Descendants(id uint) ([]db.Tag, error) {
+	ids, err := r.DescendantIDs([]uint{id})
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []db.Tag
+	tx := r.DB.Order("tag_name desc").Preload("Parent").Preload("Aliases").Find(&tags, "id IN ? AND id != ?", ids, id)
+	return tags, tx.Error
+}
+
+func (r *GormTags) DescendantIDs(ids []uint) ([]uint, error) {
+	result := []uint{}
+	if len(ids) == 0 {
+		return result, nil
+	}
+	tx := r.DB.Raw(subtreeQuery, ids).Scan(&result)
+	return result, tx.Error
+}
+
+func (r *GormTags) NamedIDs(names []string) ([]uint, error) {
+	result := []uint{}
+	tx := r.DB.Model(&db.Tag{}).Where("tag_name IN ?", names).Pluck("id", &result)
+	return result, tx.Error
+}
+
+func (r *GormTags) AliasedIDs(names []string) ([]uint, error) {
+	result := []uint{}
+	tx := r.DB.Model(&db.Alias{}).Where("name IN ?", names).Pluck("tag_id", &result)
+	return result, tx.Error
+}
+
+func (r *GormTags) Search(term string, offset, limit int) ([]db.Tag, error) {
+	var tags []db.Tag
+	query := r.DB.Preload("Parent").Preload("Aliases").Limit(limit).Offset(offset)
+	tx := query.Find(&tags, "tag_name LIKE ?", fmt.Sprintf("%%%s%%", term))
+	return tags, tx.Error
+}
+
+func (r *GormTags) SearchAliases(term string, offset, limit int) ([]db.Tag, error) {
+	ids := []uint{}
+	tx := r.DB.Model(&db.Alias{}).Where("name LIKE ?", fmt.Sprintf("%%%s%%", term)).Pluck("tag_id", &ids)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	var tags []db.Tag
+	query := r.DB.Preload("Parent").Preload("Aliases").Limit(limit).Offset(offset)
+	tx = query.Find(&tags, "id IN ?", ids)
+	return tags, tx.Error
+}
+
+type GormFields struct {
+	DB *gorm.DB
+}
+
+func NewGormFields(dbs *gorm.DB) *GormFields {
+	return &GormFields{DB: dbs}
+}
+
+func (r *GormFields) Create(field *db.Field) error {
+	return r.DB.Create(field).Error
+}
+
+func (r *GormFields) GetByName(name string) (*db.Field, error) {
+	var field db.Field
+	tx := r.DB.First(&field, "name = ?", name)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &field, nil
+}
+
+func (r *GormFields) List() ([]db.Field, error) {
+	var fields []db.Field
+	tx := r.DB.Order("name asc").Find(&fields)
+	return fields, tx.Error
+}
+
+// Delete removes the field for good, so its name can be used again.
+func (r *GormFields) Delete(id uint) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&db.FileField{}, "field_id = ?", id).Error; err != nil {
+			return err
+		}
+
+		result := tx.Unscoped().Delete(&db.Field{}, "id = ?", id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+func (r *GormFields) Value(fileId, fieldId uint) (*db.FileField, error) {
+	var value db.FileField
+	tx := r.DB.Preload("Field").First(&value, "file_id = ? AND field_id = ?", fileId, fieldId)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &value, nil
+}
+
+func (r *GormFields) Values(fieldId uint) ([]db.FileField, error) {
+	var values []db.FileField
+	tx := r.DB.Order("file_id asc").Find(&values, "field_id = ?", fieldId)
+	return values, tx.Error
+}
+
+func (r *GormFields) SetValue(value *db.FileField) error {
+	return r.DB.Omit("Field").Save(value).Error
+}
+
+func (r *GormFields) DeleteValue(fileId, fieldId uint) error {
+	return r.DB.Delete(&db.FileField{}, "file_id = ? AND field_id = ?", fileId, fieldId).Error
+}
@@ -0,0 +1,763 @@
+package store
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CanPacis/tstud-core/db"
+	"gorm.io/gorm"
+)
+
+// Memory keeps files and tags in maps. It follows the gorm backend closely
+// enough for the controllers, except that deletes are permanent.
+type Memory struct {
+	Files  *MemoryFiles
+	Tags   *MemoryTags
+	Fields *MemoryFields
+
+	mu       sync.RWMutex
+	files    map[uint]db.File
+	tags     map[uint]db.Tag
+	aliases  map[uint]db.Alias
+	fileTags map[uint]map[uint]bool
+	fields   map[uint]db.Field
+	values   map[uint]map[uint]db.FileField
+	// Like sqlite every table counts its own IDs.
+	lastFile, lastTag, lastAlias, lastField uint
+}
+
+func NewMemory() *Memory {
+	m := &Memory{
+		files:    map[uint]db.File{},
+		tags:     map[uint]db.Tag{},
+		aliases:  map[uint]db.Alias{},
+		fileTags: map[uint]map[uint]bool{},
+		fields:   map[uint]db.Field{},
+		values:   map[uint]map[uint]db.FileField{},
+	}
+	m.Files = &MemoryFiles{m}
+	m.Tags = &MemoryTags{m}
+	m.Fields = &MemoryFields{m}
+	return m
+}
+
+func page[T any](items []T, offset, limit int) []T {
+	if offset >= len(items) {
+		return []T{}
+	}
+	items = items[offset:]
+	if limit >= 0 && limit < len(items) {
+		items = items[:limit]
+	}
+	return items
+}
+
+func contains(s, term string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(term))
+}
+
+// withTags returns a copy of a stored file with its tags and field values
+// loaded.
+func (m *Memory) withTags(file db.File) db.File {
+	file.Fields = []db.FileField{}
+	for _, value := range m.values[file.ID] {
+		value.Field = m.fields[value.FieldID]
+		file.Fields = append(file.Fields, value)
+	}
+	slices.SortFunc(file.Fields, func(a, b db.FileField) int { return cmp.Compare(a.FieldID, b.FieldID) })
+
+	file.Tags = []db.Tag{}
+	for id := range m.fileTags[file.ID] {
+		if tag, ok := m.tags[id]; ok {
+			file.Tags = append(file.Tags, tag)
+		}
+	}
+	slices.SortFunc(file.Tags, func(a, b db.Tag) int { return cmp.Compare(a.ID, b.ID) })
+	return file
+}
+
+// withRelations returns a copy of a stored tag with its parent and aliases.
+func (m *Memory) withRelations(tag db.Tag) db.Tag {
+	tag.Parent = nil
+	if tag.ParentID != nil {
+		if parent, ok := m.tags[uint(*tag.ParentID)]; ok {
+			tag.Parent = &parent
+		}
+	}
+
+	tag.Aliases = []db.Alias{}
+	for _, alias := range m.aliases {
+		if alias.TagID == tag.ID {
+			tag.Aliases = append(tag.Aliases, alias)
+		}
+	}
+	slices.SortFunc(tag.Aliases, func(a, b db.Alias) int { return cmp.Compare(a.ID, b.ID) })
+	return tag
+}
+
+func (m *Memory) sortedFiles(keep func(db.File) bool, compare func(a, b db.File) int) []db.File {
+	files := []db.File{}
+	for _, file := range m.files {
+		if keep(file) {
+			files = append(files, file)
+		}
+	}
+	slices.SortFunc(files, compare)
+	return files
+}
+
+func (m *Memory) sortedTags(keep func(db.Tag) bool, compare func(a, b db.Tag) int) []db.Tag {
+	tags := []db.Tag{}
+	for _, tag := range m.tags {
+		if keep(tag) {
+			tags = append(tags, m.withRelations(tag))
+		}
+	}
+	slices.SortFunc(tags, compare)
+	return tags
+}
+
+func byPathDesc(a, b db.File) int {
+	return cmp.Compare(b.FilePath, a.FilePath)
+}
+
+func byFileID(a, b db.File) int {
+	return cmp.Compare(a.ID, b.ID)
+}
+
+func byNameDesc(a, b db.Tag) int {
+	return cmp.Compare(b.TagName, a.TagName)
+}
+
+func byTagID(a, b db.Tag) int {
+	return cmp.Compare(a.ID, b.ID)
+}
+
+type MemoryFiles struct {
+	m *Memory
+}
+
+func (r *MemoryFiles) pathTaken(path string, except uint) bool {
+	for _, file := range r.m.files {
+		if file.FilePath == path && file.ID != except {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *MemoryFiles) Create(files []db.File) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	seen := map[string]bool{}
+	for _, file := range files {
+		if seen[file.FilePath] || r.pathTaken(file.FilePath, 0) {
+			return gorm.ErrDuplicatedKey
+		}
+		seen[file.FilePath] = true
+	}
+
+	now := time.Now()
+	for i := range files {
+		r.m.lastFile++
+		files[i].ID = r.m.lastFile
+		files[i].CreatedAt = now
+		files[i].UpdatedAt = now
+		stored := files[i]
+		stored.Tags = nil
+		stored.Fields = nil
+		r.m.files[stored.ID] = stored
+	}
+	return nil
+}
+
+func (r *MemoryFiles) Get(id uint) (*db.File, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	file, ok := r.m.files[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	file = r.m.withTags(file)
+	return &file, nil
+}
+
+func (r *MemoryFiles) GetByPath(path string) (*db.File, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	for _, file := range r.m.files {
+		if file.FilePath == path {
+			file = r.m.withTags(file)
+			return &file, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *MemoryFiles) Indexed(paths []string) ([]string, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	result := []string{}
+	for _, file := range r.m.files {
+		if slices.Contains(paths, file.FilePath) {
+			result = append(result, file.FilePath)
+		}
+	}
+	return result, nil
+}
+
+func (r *MemoryFiles) Save(file *db.File) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	if _, ok := r.m.files[file.ID]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	if r.pathTaken(file.FilePath, file.ID) {
+		return gorm.ErrDuplicatedKey
+	}
+
+	file.UpdatedAt = time.Now()
+	stored := *file
+	stored.Tags = nil
+	stored.Fields = nil
+	r.m.files[file.ID] = stored
+	return nil
+}
+
+func (r *MemoryFiles) Delete(id uint) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	if _, ok := r.m.files[id]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	delete(r.m.files, id)
+	delete(r.m.fileTags, id)
+	delete(r.m.values, id)
+	return nil
+}
+
+func (r *MemoryFiles) AddTag(fileId, tagId uint) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	if _, ok := r.m.files[fileId]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	if _, ok := r.m.tags[tagId]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	if r.m.fileTags[fileId] == nil {
+		r.m.fileTags[fileId] = map[uint]bool{}
+	}
+	r.m.fileTags[fileId][tagId] = true
+	return nil
+}
+
+func (r *MemoryFiles) RemoveTag(fileId, tagId uint) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	delete(r.m.fileTags[fileId], tagId)
+	return nil
+}
+
+func (r *MemoryFiles) List(offset, limit int) ([]db.File, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	files := r.m.sortedFiles(func(db.File) bool { return true }, byPathDesc)
+	return page(files, offset, limit), nil
+}
+
+func (r *MemoryFiles) Count() (int64, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	return int64(len(r.m.files)), nil
+}
+
+func (r *MemoryFiles) After(id uint, limit int) ([]db.File, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	files := r.m.sortedFiles(func(file db.File) bool { return file.ID > id }, byFileID)
+	files = page(files, 0, limit)
+	for i := range files {
+		files[i] = r.m.withTags(files[i])
+	}
+	return files, nil
+}
+
+func (r *MemoryFiles) Tagged(tagIds []uint, offset, limit int) ([]db.File, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	files := r.m.sortedFiles(func(file db.File) bool {
+		for _, id := range tagIds {
+			if r.m.fileTags[file.ID][id] {
+				return true
+			}
+		}
+		return false
+	}, byPathDesc)
+	return page(files, offset, limit), nil
+}
+
+func (r *MemoryFiles) Named(names []string, offset, limit int) ([]db.File, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	files := r.m.sortedFiles(func(file db.File) bool { return slices.Contains(names, file.Name()) }, byFileID)
+	return page(files, offset, limit), nil
+}
+
+// compareValues orders two values of field, numerically when it is numeric.
+func compareValues(field db.Field, a, b db.FileField) int {
+	if field.Numeric() && a.Number != nil && b.Number != nil {
+		return cmp.Compare(*a.Number, *b.Number)
+	}
+	return cmp.Compare(a.Value, b.Value)
+}
+
+// fieldValue returns the value of field on a stored file, built-in fields
+// are read from the file itself.
+func (m *Memory) fieldValue(file db.File, field db.Field) (db.FileField, bool) {
+	if !field.Builtin() {
+		value, ok := m.values[file.ID][field.ID]
+		return value, ok
+	}
+
+	value := file.Author
+	if field.Name == "description" {
+		value = file.Description
+	}
+	return db.FileField{FileID: file.ID, Field: field, Value: value}, len(value) > 0
+}
+
+func matches(filter db.FieldFilter, value db.FileField) bool {
+	if filter.Op == "~" {
+		return contains(value.Value, filter.Value.Value)
+	}
+
+	c := compareValues(filter.Field, value, filter.Value)
+	switch filter.Op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+func (r *MemoryFiles) Query(query db.FileQuery, offset, limit int) ([]db.File, int64, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	keep := func(file db.File) bool {
+		if query.FileIDs != nil && !slices.Contains(query.FileIDs, file.ID) {
+			return false
+		}
+		for _, filter := range query.Filters {
+			value, ok := r.m.fieldValue(file, filter.Field)
+			if !ok || !matches(filter, value) {
+				return false
+			}
+		}
+		return true
+	}
+
+	compare := byPathDesc
+	if query.Sort != nil {
+		field := *query.Sort
+		compare = func(a, b db.File) int {
+			va, oka := r.m.fieldValue(a, field)
+			vb, okb := r.m.fieldValue(b, field)
+			switch {
+			case oka && !okb:
+				return -1
+			case !oka && okb:
+				return 1
+			case oka && okb:
+				c := compareValues(field, va, vb)
+				if query.Desc {
+					c = -c
+				}
+				if c != 0 {
+					return c
+				}
+			}
+			return byPathDesc(a, b)
+		}
+	}
+
+	files := r.m.sortedFiles(keep, compare)
+	result := page(files, offset, limit)
+	for i := range result {
+		result[i].Fields = r.m.withTags(result[i]).Fields
+	}
+	return result, int64(len(files)), nil
+}
+
+type MemoryTags struct {
+	m *Memory
+}
+
+func (r *MemoryTags) Create(tag *db.Tag) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	now := time.Now()
+	r.m.lastTag++
+	tag.ID = r.m.lastTag
+	tag.CreatedAt = now
+	tag.UpdatedAt = now
+
+	stored := *tag
+	stored.Parent = nil
+	stored.Aliases = nil
+	r.m.tags[tag.ID] = stored
+	return nil
+}
+
+func (r *MemoryTags) Get(id uint) (*db.Tag, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	tag, ok := r.m.tags[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	tag = r.m.withRelations(tag)
+	return &tag, nil
+}
+
+func (r *MemoryTags) GetByName(name string) (*db.Tag, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	tags := r.m.sortedTags(func(tag db.Tag) bool { return tag.TagName == name }, byTagID)
+	if len(tags) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &tags[0], nil
+}
+
+func (r *MemoryTags) Delete(id uint) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	if _, ok := r.m.tags[id]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	delete(r.m.tags, id)
+	return nil
+}
+
+func (r *MemoryTags) SetParent(id uint, parentId *int) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	tag, ok := r.m.tags[id]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	tag.ParentID = parentId
+	tag.UpdatedAt = time.Now()
+	r.m.tags[id] = tag
+	return nil
+}
+
+func (r *MemoryTags) AddAlias(tagId uint, alias *db.Alias) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	if _, ok := r.m.tags[tagId]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+
+	now := time.Now()
+	r.m.lastAlias++
+	alias.ID = r.m.lastAlias
+	alias.TagID = tagId
+	alias.CreatedAt = now
+	alias.UpdatedAt = now
+	r.m.aliases[alias.ID] = *alias
+	return nil
+}
+
+func (r *MemoryTags) DeleteAlias(id uint) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	delete(r.m.aliases, id)
+	return nil
+}
+
+func (r *MemoryTags) Children(parentId *uint) ([]db.Tag, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	return r.m.sortedTags(func(tag db.Tag) bool {
+		if parentId == nil {
+			return tag.ParentID == nil
+		}
+		return tag.ParentID != nil && uint(*tag.ParentID) == *parentId
+	}, byNameDesc), nil
+}
+
+func (r *MemoryTags) All() ([]db.Tag, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	return r.m.sortedTags(func(db.Tag) bool { return true }, byNameDesc), nil
+}
+
+func (r *MemoryTags) ids(keep func(db.Tag) bool) []uint {
+	result := []uint{}
+	for _, tag := range r.m.sortedTags(keep, byTagID) {
+		result = append(result, tag.ID)
+	}
+	return result
+}
+
+// subtree returns ids and every tag below them.
+func (r *MemoryTags) subtree(ids []uint) map[uint]bool {
+	children := map[uint][]uint{}
+	for _, tag := range r.m.tags {
+		if tag.ParentID != nil {
+			parentId := uint(*tag.ParentID)
+			children[parentId] = append(children[parentId], tag.ID)
+		}
+	}
+
+	seen := map[uint]bool{}
+	queue := []uint{}
+	for _, id := range ids {
+		if _, ok := r.m.tags[id]; ok {
+			queue = append(queue, id)
+		}
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		queue = append(queue, children[id]...)
+	}
+	return seen
+}
+
+func (r *MemoryTags) Ancestors(id uint) ([]db.Tag, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	result := []db.Tag{}
+	seen := map[uint]bool{id: true}
+	for tag, ok := r.m.tags[id]; ok && tag.ParentID != nil; {
+		parentId := uint(*tag.ParentID)
+		if seen[parentId] {
+			break
+		}
+		seen[parentId] = true
+
+		tag, ok = r.m.tags[parentId]
+		if ok {
+			result = append(result, r.m.withRelations(tag))
+		}
+	}
+	return result, nil
+}
+
+func (r *MemoryTags) Descendants(id uint) ([]db.Tag, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	subtree := r.subtree([]uint{id})
+	return r.m.sortedTags(func(tag db.Tag) bool { return tag.ID != id && subtree[tag.ID] }, byNameDesc), nil
+}
+
+func (r *MemoryTags) DescendantIDs(ids []uint) ([]uint, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	subtree := r.subtree(ids)
+	return r.ids(func(tag db.Tag) bool { return subtree[tag.ID] }), nil
+}
+
+func (r *MemoryTags) NamedIDs(names []string) ([]uint, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	return r.ids(func(tag db.Tag) bool { return slices.Contains(names, tag.TagName) }), nil
+}
+
+func (r *MemoryTags) AliasedIDs(names []string) ([]uint, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	result := []uint{}
+	for _, alias := range r.m.aliases {
+		if slices.Contains(names, alias.Name) {
+			result = append(result, alias.TagID)
+		}
+	}
+	slices.Sort(result)
+	return result, nil
+}
+
+func (r *MemoryTags) Search(term string, offset, limit int) ([]db.Tag, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	tags := r.m.sortedTags(func(tag db.Tag) bool { return contains(tag.TagName, term) }, byTagID)
+	return page(tags, offset, limit), nil
+}
+
+func (r *MemoryTags) SearchAliases(term string, offset, limit int) ([]db.Tag, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	aliased := map[uint]bool{}
+	for _, alias := range r.m.aliases {
+		if contains(alias.Name, term) {
+			aliased[alias.TagID] = true
+		}
+	}
+
+	tags := r.m.sortedTags(func(tag db.Tag) bool { return aliased[tag.ID] }, byTagID)
+	return page(tags, offset, limit), nil
+}
+
+type MemoryFields struct {
+	m *Memory
+}
+
+func (r *MemoryFields) Create(field *db.Field) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	for _, existing := range r.m.fields {
+		if existing.Name == field.Name {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+
+	now := time.Now()
+	r.m.lastField++
+	field.ID = r.m.lastField
+	field.CreatedAt = now
+	field.UpdatedAt = now
+	r.m.fields[field.ID] = *field
+	return nil
+}
+
+func (r *MemoryFields) GetByName(name string) (*db.Field, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	for _, field := range r.m.fields {
+		if field.Name == name {
+			return &field, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *MemoryFields) List() ([]db.Field, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	fields := []db.Field{}
+	for _, field := range r.m.fields {
+		fields = append(fields, field)
+	}
+	slices.SortFunc(fields, func(a, b db.Field) int { return cmp.Compare(a.Name, b.Name) })
+	return fields, nil
+}
+
+func (r *MemoryFields) Delete(id uint) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	if _, ok := r.m.fields[id]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	delete(r.m.fields, id)
+	for _, values := range r.m.values {
+		delete(values, id)
+	}
+	return nil
+}
+
+func (r *MemoryFields) Value(fileId, fieldId uint) (*db.FileField, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	value, ok := r.m.values[fileId][fieldId]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	value.Field = r.m.fields[fieldId]
+	return &value, nil
+}
+
+func (r *MemoryFields) Values(fieldId uint) ([]db.FileField, error) {
+	r.m.mu.RLock()
+	defer r.m.mu.RUnlock()
+
+	values := []db.FileField{}
+	for _, fileValues := range r.m.values {
+		if value, ok := fileValues[fieldId]; ok {
+			values = append(values, value)
+		}
+	}
+	slices.SortFunc(values, func(a, b db.FileField) int { return cmp.Compare(a.FileID, b.FileID) })
+	return values, nil
+}
+
+func (r *MemoryFields) SetValue(value *db.FileField) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	if _, ok := r.m.files[value.FileID]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	if _, ok := r.m.fields[value.FieldID]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	if r.m.values[value.FileID] == nil {
+		r.m.values[value.FileID] = map[uint]db.FileField{}
+	}
+
+	stored := *value
+	stored.Field = db.Field{}
+	r.m.values[value.FileID][value.FieldID] = stored
+	return nil
+}
+
+func (r *MemoryFields) DeleteValue(fileId, fieldId uint) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	delete(r.m.values[fileId], fieldId)
+	return nil
+}
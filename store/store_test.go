@@ -0,0 +1,367 @@
+package store_test
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/CanPacis/tstud-core/controllers"
+	"github.com/CanPacis/tstud-core/db"
+	"github.com/CanPacis/tstud-core/store"
+	"gorm.io/gorm"
+)
+
+// backend is one implementation of the repositories, every test runs against
+// all of them so they behave the same for the controllers.
+type backend struct {
+	Files  controllers.FileRepository
+	Tags   controllers.TagRepository
+	Fields controllers.FieldRepository
+}
+
+var backends = map[string]func(t *testing.T) backend{
+	"memory": func(t *testing.T) backend {
+		m := store.NewMemory()
+		return backend{Files: m.Files, Tags: m.Tags, Fields: m.Fields}
+	},
+	"gorm": func(t *testing.T) backend {
+		dbs, err := db.OpenMemory()
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			if sqlDB, err := dbs.DB(); err == nil {
+				sqlDB.Close()
+			}
+		})
+		return backend{Files: store.NewGormFiles(dbs), Tags: store.NewGormTags(dbs), Fields: store.NewGormFields(dbs)}
+	},
+}
+
+func run(t *testing.T, test func(t *testing.T, b backend)) {
+	for name, open := range backends {
+		t.Run(name, func(t *testing.T) {
+			test(t, open(t))
+		})
+	}
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func fileIDs(files []db.File) []uint {
+	ids := []uint{}
+	for _, file := range files {
+		ids = append(ids, file.ID)
+	}
+	return ids
+}
+
+func tagIDs(tags []db.Tag) []uint {
+	ids := []uint{}
+	for _, tag := range tags {
+		ids = append(ids, tag.ID)
+	}
+	return ids
+}
+
+func expectIDs(t *testing.T, what string, got, want []uint) {
+	t.Helper()
+	if !slices.Equal(got, want) {
+		t.Errorf("%s: got %v, expected %v", what, got, want)
+	}
+}
+
+func createFiles(t *testing.T, b backend, paths ...string) {
+	t.Helper()
+	files := []db.File{}
+	for _, path := range paths {
+		files = append(files, db.File{FilePath: path})
+	}
+	must(t, b.Files.Create(files))
+}
+
+func createTag(t *testing.T, b backend, name string, parent uint) uint {
+	t.Helper()
+	tag := db.Tag{TagName: name}
+	if parent > 0 {
+		id := int(parent)
+		tag.ParentID = &id
+	}
+	must(t, b.Tags.Create(&tag))
+	return tag.ID
+}
+
+func TestFiles(t *testing.T) {
+	run(t, func(t *testing.T, b backend) {
+		createFiles(t, b, "/a/x.txt", "/b/x.txt", "/c/y.md")
+
+		err := b.Files.Create([]db.File{{FilePath: "/d/z"}, {FilePath: "/a/x.txt"}})
+		if !errors.Is(err, gorm.ErrDuplicatedKey) {
+			t.Errorf("creating a duplicate path: got %v", err)
+		}
+		if count, err := b.Files.Count(); err != nil || count != 3 {
+			t.Errorf("count: got %d %v, expected 3", count, err)
+		}
+
+		file, err := b.Files.GetByPath("/b/x.txt")
+		must(t, err)
+		if file.ID != 2 {
+			t.Errorf("get by path: got file %d", file.ID)
+		}
+
+		if _, err := b.Files.Get(42); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("getting a missing file: got %v", err)
+		}
+		if err := b.Files.Delete(42); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("deleting a missing file: got %v", err)
+		}
+
+		files, err := b.Files.List(0, -1)
+		must(t, err)
+		expectIDs(t, "list", fileIDs(files), []uint{3, 2, 1})
+
+		paths, err := b.Files.Indexed([]string{"/c/y.md", "/nope", "/a/x.txt"})
+		must(t, err)
+		slices.Sort(paths)
+		if !slices.Equal(paths, []string{"/a/x.txt", "/c/y.md"}) {
+			t.Errorf("indexed: got %v", paths)
+		}
+
+		files, err = b.Files.After(1, 1)
+		must(t, err)
+		expectIDs(t, "after", fileIDs(files), []uint{2})
+
+		must(t, b.Files.Delete(2))
+		if _, err := b.Files.GetByPath("/b/x.txt"); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("getting a deleted file: got %v", err)
+		}
+	})
+}
+
+func TestCreateDeleted(t *testing.T) {
+	run(t, func(t *testing.T, b backend) {
+		createFiles(t, b, "/a", "/b")
+		tag := createTag(t, b, "red", 0)
+		must(t, b.Files.AddTag(2, tag))
+		must(t, b.Files.Delete(2))
+
+		// Indexing a deleted path again starts it over.
+		files := []db.File{{FilePath: "/c"}, {FilePath: "/b", Author: "me"}}
+		must(t, b.Files.Create(files))
+		if files[0].ID == 0 || files[1].ID == 0 {
+			t.Errorf("create did not assign IDs: %v", fileIDs(files))
+		}
+
+		file, err := b.Files.GetByPath("/b")
+		must(t, err)
+		if file.ID != files[1].ID || file.Author != "me" || len(file.Tags) > 0 {
+			t.Errorf("recreated file: got %d %q with tags %v", file.ID, file.Author, tagIDs(file.Tags))
+		}
+		if count, err := b.Files.Count(); err != nil || count != 3 {
+			t.Errorf("count: got %d %v, expected 3", count, err)
+		}
+	})
+}
+
+func TestNamed(t *testing.T) {
+	run(t, func(t *testing.T, b backend) {
+		createFiles(t, b, "/a/x.txt", "/b/x.txt", "/c/y.md", "/d/X.TXT", "/e/ax.txt", "/f/100%.txt")
+
+		cases := []struct {
+			names         []string
+			offset, limit int
+			want          []uint
+		}{
+			{[]string{"x.txt"}, 0, -1, []uint{1, 2}},
+			{[]string{"x.txt", "y.md"}, 0, -1, []uint{1, 2, 3}},
+			{[]string{"x.txt", "y.md"}, 1, 1, []uint{2}},
+			{[]string{"100%.txt"}, 0, -1, []uint{6}},
+			{[]string{"%.txt", "_.txt", "x", "b/x.txt", ""}, 0, -1, []uint{}},
+		}
+		for _, c := range cases {
+			files, err := b.Files.Named(c.names, c.offset, c.limit)
+			must(t, err)
+			expectIDs(t, "named", fileIDs(files), c.want)
+		}
+	})
+}
+
+func TestTagged(t *testing.T) {
+	run(t, func(t *testing.T, b backend) {
+		createFiles(t, b, "/a", "/b", "/c")
+		red := createTag(t, b, "red", 0)
+		blue := createTag(t, b, "blue", 0)
+		must(t, b.Files.AddTag(1, red))
+		must(t, b.Files.AddTag(3, red))
+		must(t, b.Files.AddTag(3, blue))
+
+		files, err := b.Files.Tagged([]uint{red, blue}, 0, -1)
+		must(t, err)
+		expectIDs(t, "tagged", fileIDs(files), []uint{3, 1})
+
+		must(t, b.Files.RemoveTag(3, red))
+		files, err = b.Files.Tagged([]uint{red}, 0, -1)
+		must(t, err)
+		expectIDs(t, "tagged after untag", fileIDs(files), []uint{1})
+
+		file, err := b.Files.Get(3)
+		must(t, err)
+		expectIDs(t, "file tags", tagIDs(file.Tags), []uint{blue})
+	})
+}
+
+func TestTagTree(t *testing.T) {
+	run(t, func(t *testing.T, b backend) {
+		root := createTag(t, b, "root", 0)
+		a := createTag(t, b, "a", root)
+		b1 := createTag(t, b, "b", a)
+		c := createTag(t, b, "c", root)
+		other := createTag(t, b, "other", 0)
+
+		tags, err := b.Tags.Children(nil)
+		must(t, err)
+		expectIDs(t, "roots", tagIDs(tags), []uint{root, other})
+
+		tags, err = b.Tags.Ancestors(b1)
+		must(t, err)
+		expectIDs(t, "ancestors", tagIDs(tags), []uint{a, root})
+
+		tags, err = b.Tags.Descendants(root)
+		must(t, err)
+		expectIDs(t, "descendants", tagIDs(tags), []uint{c, b1, a})
+
+		ids, err := b.Tags.DescendantIDs([]uint{a, other})
+		must(t, err)
+		slices.Sort(ids)
+		expectIDs(t, "descendant ids", ids, []uint{a, b1, other})
+
+		ids, err = b.Tags.NamedIDs([]string{"c", "nope"})
+		must(t, err)
+		expectIDs(t, "named ids", ids, []uint{c})
+
+		if _, err := b.Tags.Get(42); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("getting a missing tag: got %v", err)
+		}
+	})
+}
+
+func TestQuery(t *testing.T) {
+	run(t, func(t *testing.T, b backend) {
+		createFiles(t, b, "/a", "/b", "/c")
+		pages := db.Field{Name: "pages", Type: db.FieldNumber}
+		must(t, b.Fields.Create(&pages))
+
+		for fileId, value := range map[uint]float64{1: 20, 2: 100, 3: 5} {
+			must(t, b.Fields.SetValue(&db.FileField{FileID: fileId, FieldID: pages.ID, Value: "", Number: &value}))
+		}
+
+		ten := 10.0
+		query := db.FileQuery{
+			Filters: []db.FieldFilter{{Field: pages, Op: ">", Value: db.FileField{Number: &ten}}},
+			Sort:    &pages,
+		}
+		files, total, err := b.Files.Query(query, 0, -1)
+		must(t, err)
+		expectIDs(t, "query", fileIDs(files), []uint{1, 2})
+		if total != 2 {
+			t.Errorf("query total: got %d, expected 2", total)
+		}
+
+		query.Desc = true
+		query.FileIDs = []uint{2, 3}
+		query.Filters = nil
+		files, _, err = b.Files.Query(query, 0, -1)
+		must(t, err)
+		expectIDs(t, "query by ids", fileIDs(files), []uint{2, 3})
+
+		must(t, b.Fields.DeleteValue(2, pages.ID))
+		values, err := b.Fields.Values(pages.ID)
+		must(t, err)
+		if len(values) != 2 || values[0].FileID != 1 || values[1].FileID != 3 {
+			t.Errorf("values: got %v", values)
+		}
+		if _, err := b.Fields.Value(2, pages.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("getting a deleted value: got %v", err)
+		}
+	})
+}
+
+func TestQueryBuiltin(t *testing.T) {
+	run(t, func(t *testing.T, b backend) {
+		createFiles(t, b, "/a", "/b", "/c")
+		for fileId, author := range map[uint]string{1: "zed", 3: "amy"} {
+			file, err := b.Files.Get(fileId)
+			must(t, err)
+			file.Author = author
+			must(t, b.Files.Save(file))
+		}
+
+		author := db.Field{Name: "author", Type: db.FieldString}
+		query := db.FileQuery{
+			Filters: []db.FieldFilter{{Field: author, Op: "!=", Value: db.FileField{Value: "zed"}}},
+		}
+		files, total, err := b.Files.Query(query, 0, -1)
+		must(t, err)
+		expectIDs(t, "query by author", fileIDs(files), []uint{3})
+		if total != 1 {
+			t.Errorf("query total: got %d, expected 1", total)
+		}
+
+		query.Filters = []db.FieldFilter{{Field: author, Op: "~", Value: db.FileField{Value: "E"}}}
+		files, _, err = b.Files.Query(query, 0, -1)
+		must(t, err)
+		expectIDs(t, "query author contains", fileIDs(files), []uint{1})
+
+		query.Filters = nil
+		query.Sort = &author
+		files, _, err = b.Files.Query(query, 0, -1)
+		must(t, err)
+		expectIDs(t, "sort by author", fileIDs(files), []uint{3, 1, 2})
+
+		query.Desc = true
+		files, _, err = b.Files.Query(query, 0, -1)
+		must(t, err)
+		expectIDs(t, "sort by author desc", fileIDs(files), []uint{1, 3, 2})
+	})
+}
+
+func TestSearchMeta(t *testing.T) {
+	run(t, func(t *testing.T, b backend) {
+		createFiles(t, b, "/a.txt", "/b.txt", "/c.md")
+		meta := map[uint][2]string{1: {"Zed", "meeting notes"}, 2: {"Amy", "Notes"}, 3: {"amy", "draft"}}
+		for fileId, m := range meta {
+			file, err := b.Files.Get(fileId)
+			must(t, err)
+			file.Author, file.Description = m[0], m[1]
+			must(t, b.Files.Save(file))
+		}
+
+		c := &controllers.FileController{Files: b.Files, Tags: b.Tags, Fields: b.Fields}
+		cases := []struct {
+			options controllers.SearchOptions
+			want    []uint
+		}{
+			{controllers.SearchOptions{Author: "amy"}, []uint{2, 3}},
+			{controllers.SearchOptions{Description: "notes"}, []uint{1, 2}},
+			{controllers.SearchOptions{Author: "amy", Description: "notes"}, []uint{2}},
+			{controllers.SearchOptions{Author: "amy", Term: "c.md"}, []uint{3}},
+			{controllers.SearchOptions{Author: "nobody"}, []uint{}},
+		}
+		for _, tc := range cases {
+			result, err := c.Search(tc.options)
+			must(t, err)
+			got := []uint{}
+			for _, file := range result.Items {
+				got = append(got, file.ID)
+			}
+			slices.Sort(got)
+			expectIDs(t, fmt.Sprintf("search %+v", tc.options), got, tc.want)
+		}
+	})
+}
@@ -0,0 +1,225 @@
+package tsgen
+
+const runtime = `export interface FieldError {
+  field: string;
+  code: string;
+  message: string;
+}
+
+export interface ErrorDetails {
+  status: number;
+  code: string;
+  error: string;
+  fields?: FieldError[];
+}
+
+export class P2PJSONError extends Error {
+  status: number;
+  code: string;
+  fields: FieldError[];
+
+  constructor(details: ErrorDetails) {
+    super(details.error);
+    this.status = details.status;
+    this.code = details.code;
+    this.fields = details.fields ?? [];
+  }
+}
+
+export interface Transport {
+  write(data: Uint8Array): void;
+  onData(listener: (chunk: Uint8Array) => void): void;
+}
+
+export interface Frame {
+  type: string;
+  startLine: string;
+  headers: Record<string, string>;
+  body: Uint8Array;
+}
+
+const encoder = new TextEncoder();
+const decoder = new TextDecoder();
+const CRLF = encoder.encode("\r\n");
+
+function indexOf(buffer: Uint8Array, needle: Uint8Array, from: number): number {
+  outer: for (let i = from; i <= buffer.length - needle.length; i++) {
+    for (let j = 0; j < needle.length; j++) {
+      if (buffer[i + j] !== needle[j]) continue outer;
+    }
+    return i;
+  }
+  return -1;
+}
+
+export function encodeFrame(type: string, startLine: string, headers: Record<string, string>, body: Uint8Array): Uint8Array {
+  let head = type + "\r\n" + startLine + "\r\n";
+  for (const [key, value] of Object.entries({ ...headers, "Content-Length": String(body.length) })) {
+    head += key + ": " + value + "\r\n";
+  }
+  head += "\r\n";
+
+  const encoded = encoder.encode(head);
+  const frame = new Uint8Array(encoded.length + body.length);
+  frame.set(encoded, 0);
+  frame.set(body, encoded.length);
+  return frame;
+}
+
+export class FrameDecoder {
+  private buffer = new Uint8Array(0);
+
+  push(chunk: Uint8Array): Frame[] {
+    const next = new Uint8Array(this.buffer.length + chunk.length);
+    next.set(this.buffer, 0);
+    next.set(chunk, this.buffer.length);
+    this.buffer = next;
+
+    const frames: Frame[] = [];
+    for (let frame = this.next(); frame !== null; frame = this.next()) {
+      frames.push(frame);
+    }
+    return frames;
+  }
+
+  private next(): Frame | null {
+    const typeEnd = indexOf(this.buffer, CRLF, 0);
+    if (typeEnd < 0) return null;
+
+    const type = decoder.decode(this.buffer.subarray(0, typeEnd));
+    if (type === "EXIT") {
+      this.buffer = this.buffer.slice(typeEnd + 2);
+      return { type, startLine: "", headers: {}, body: new Uint8Array(0) };
+    }
+
+    const headEnd = indexOf(this.buffer, encoder.encode("\r\n\r\n"), typeEnd + 2);
+    if (headEnd < 0) return null;
+
+    const lines = decoder.decode(this.buffer.subarray(typeEnd + 2, headEnd)).split("\r\n");
+    const headers: Record<string, string> = {};
+    for (const line of lines.slice(1)) {
+      const colon = line.indexOf(":");
+      if (colon < 0) continue;
+      headers[line.slice(0, colon).trim().toLowerCase()] = line.slice(colon + 1).trim();
+    }
+
+    const length = Number(headers["content-length"] ?? 0);
+    const bodyStart = headEnd + 4;
+    if (this.buffer.length < bodyStart + length) return null;
+
+    const body = this.buffer.slice(bodyStart, bodyStart + length);
+    this.buffer = this.buffer.slice(bodyStart + length);
+    return { type, startLine: lines[0], headers, body };
+  }
+}
+
+function decodeBody<T>(frame: Frame): T {
+  return JSON.parse(decoder.decode(frame.body)) as T;
+}
+
+interface Pending {
+  resolve: (frame: Frame) => void;
+  reject: (err: Error) => void;
+  onPartial?: (frame: Frame) => void;
+}
+
+export class Client {
+  private nextId = 1;
+  private pending = new Map<number, Pending>();
+  private decoder = new FrameDecoder();
+
+  constructor(private transport: Transport, private defaultHost = "tstud") {
+    transport.onData((chunk) => {
+      for (const frame of this.decoder.push(chunk)) {
+        this.receive(frame);
+      }
+    });
+  }
+
+  private receive(frame: Frame) {
+    if (frame.type !== "RESPONSE") return;
+
+    const id = Number(frame.headers["identifier"]);
+    const pending = this.pending.get(id);
+    if (pending === undefined) return;
+
+    const status = Number(frame.startLine.split(" ")[1]);
+    if (status === 206) {
+      pending.onPartial?.(frame);
+      return;
+    }
+
+    this.pending.delete(id);
+    if (status >= 400) {
+      pending.reject(new P2PJSONError(decodeBody<ErrorDetails>(frame)));
+    } else {
+      pending.resolve(frame);
+    }
+  }
+
+  private send(path: string, body: unknown, host?: string, onPartial?: (frame: Frame) => void): Promise<Frame> {
+    const id = this.nextId++;
+    const url = "p2pjson://" + (host ?? this.defaultHost) + path;
+    const payload = encoder.encode(JSON.stringify(body ?? {}));
+
+    return new Promise((resolve, reject) => {
+      this.pending.set(id, { resolve, reject, onPartial });
+      this.transport.write(
+        encodeFrame("REQUEST", url + " P2PJSON/0.1", { Identifier: String(id), "Content-Type": "application/json" }, payload),
+      );
+    });
+  }
+
+  async call<P extends keyof Routes>(path: P, body: Routes[P]["request"], host?: string): Promise<Routes[P]["response"]> {
+    const frame = await this.send(path, body, host);
+    return decodeBody<Routes[P]["response"]>(frame);
+  }
+
+  async *stream<P extends keyof StreamRoutes>(
+    path: P,
+    body: StreamRoutes[P]["request"],
+    host?: string,
+  ): AsyncGenerator<StreamRoutes[P]["item"]> {
+    const items: StreamRoutes[P]["item"][] = [];
+    let done = false;
+    let failure: Error | null = null;
+    let wake: (() => void) | null = null;
+
+    this.send(path, body, host, (frame) => {
+      items.push(decodeBody<StreamRoutes[P]["item"]>(frame));
+      wake?.();
+    }).then(
+      () => {
+        done = true;
+        wake?.();
+      },
+      (err: Error) => {
+        failure = err;
+        done = true;
+        wake?.();
+      },
+    );
+
+    while (true) {
+      const item = items.shift();
+      if (item !== undefined) {
+        yield item;
+        continue;
+      }
+      if (failure !== null) throw failure;
+      if (done) return;
+
+      await new Promise<void>((resolve) => {
+        wake = resolve;
+      });
+      wake = null;
+    }
+  }
+
+  exit() {
+    this.transport.write(encoder.encode("EXIT\r\n"));
+  }
+
+  // methods
+}
+`
@@ -0,0 +1,693 @@
+// Code generated by tstud gen ts. DO NOT EDIT.
+
+export interface IndexFileRequest {
+  /** required */
+  path: string;
+  dir?: boolean;
+  recursive?: boolean;
+  exclude?: string[];
+}
+
+export interface AliasDTO {
+  id: number;
+  name: string;
+  tag_id: number;
+}
+
+export interface TagDTO {
+  id: number;
+  name: string;
+  parent: TagDTO | null;
+  aliases: (AliasDTO | null)[];
+}
+
+export interface FileDTO {
+  id: number;
+  file_path: string;
+  name: string;
+  mime_type: string;
+  description: string;
+  author: string;
+  tags: TagDTO[];
+  fields: Record<string, unknown>;
+  size: number;
+  mod_time: string | null;
+  inode: number;
+  device: number;
+  sha256: string;
+}
+
+export interface PaginatedResourceFileDTO {
+  items: FileDTO[];
+  page: number;
+  total_pages: number;
+}
+
+export interface UnindexFileRequest {
+  /** required */
+  path: string;
+  dir?: boolean;
+  recursive?: boolean;
+  exclude?: string[];
+}
+
+export interface RenameFileRequest {
+  /** required */
+  oldpath: string;
+  /** required */
+  newpath: string;
+}
+
+export interface TagFileRequest {
+  /** required */
+  file_id: number;
+  /** required */
+  tag_id: number;
+}
+
+export interface TagFileResponse {
+  file: FileDTO | null;
+  tag: TagDTO | null;
+}
+
+export interface UntagFileRequest {
+  /** required */
+  file_id: number;
+  /** required */
+  tag_id: number;
+}
+
+export interface SetAuthorRequest {
+  /** required */
+  file_id: number;
+  /** required, max=256 */
+  author: string;
+}
+
+export interface UnsetMetaRequest {
+  /** required */
+  file_id: number;
+}
+
+export interface SetDescriptionRequest {
+  /** required */
+  file_id: number;
+  /** required, max=4096 */
+  description: string;
+}
+
+export interface SetFieldRequest {
+  /** required */
+  file_id: number;
+  /** required */
+  key: string;
+  /** max=4096 */
+  value?: string;
+}
+
+export interface UnsetFieldRequest {
+  /** required */
+  file_id: number;
+  /** required */
+  key: string;
+}
+
+export interface ListFileRequest {
+  /** min=0 */
+  page?: number;
+  /** min=0, max=100 */
+  per_page?: number;
+}
+
+export interface SearchFileRequest {
+  /** min=0 */
+  page?: number;
+  /** min=0, max=100 */
+  per_page?: number;
+  term?: string;
+  tags?: string[];
+  author?: string;
+  description?: string;
+  where?: string[];
+  sort?: string;
+  desc?: boolean;
+}
+
+export interface FileDetailsRequest {
+  file_id?: number;
+  path?: string;
+}
+
+export interface EmptyRequest {}
+
+export interface CreateTagRequest {
+  /** required, max=128 */
+  name: string;
+  /** min=0 */
+  parent_id?: number;
+}
+
+export interface DeleteTagRequest {
+  /** required */
+  id: number;
+}
+
+export interface AliasTagRequest {
+  /** required */
+  id: number;
+  /** required, max=128 */
+  string: string;
+}
+
+export interface MessageResponse {
+  message: string;
+}
+
+export interface UnaliasTagRequest {
+  /** required */
+  id: number;
+  /** required */
+  string: string;
+}
+
+export interface ParentTagRequest {
+  /** required */
+  tag_id: number;
+  parent_tag_id?: number | null;
+}
+
+export interface ListTagRequest {
+  /** min=0 */
+  page?: number;
+  /** min=0, max=100 */
+  per_page?: number;
+  /** min=0 */
+  parent_id?: number;
+  all?: boolean;
+}
+
+export interface PaginatedResourceTagDTO {
+  items: TagDTO[];
+  page: number;
+  total_pages: number;
+}
+
+export interface TagTreeRequest {
+  /** required */
+  tag_id: number;
+}
+
+export interface SearchTagRequest {
+  /** min=0 */
+  page?: number;
+  /** min=0, max=100 */
+  per_page?: number;
+  term?: string;
+}
+
+export interface CreateFieldRequest {
+  /** required, max=64 */
+  name: string;
+  /** required, oneof=string number date url boolean enum */
+  type: string;
+  /** max=256 */
+  values?: string[];
+}
+
+export interface FieldDTO {
+  id: number;
+  name: string;
+  type: string;
+  values: string[];
+}
+
+export interface DeleteFieldRequest {
+  /** required */
+  name: string;
+}
+
+export interface StartJobRequest {
+  /** required */
+  kind: string;
+  params?: unknown;
+}
+
+export interface JobDTO {
+  id: number;
+  kind: string;
+  state: string;
+  params?: unknown;
+  result?: unknown;
+  error?: string;
+  done: number;
+  total: number;
+  created_at: string;
+  started_at: string | null;
+  finished_at: string | null;
+}
+
+export interface JobRequest {
+  /** required */
+  id: number;
+}
+
+export interface ListJobRequest {
+  /** oneof=queued running done failed canceled */
+  state?: string;
+  /** min=0, max=100 */
+  limit?: number;
+}
+
+export interface OperationDTO {
+  id: number;
+  kind: string;
+  description: string;
+  state: string;
+  created_at: string;
+}
+
+export interface ListHistoryRequest {
+  /** min=0, max=100 */
+  limit?: number;
+}
+
+export interface Bucket {
+  le: number;
+  count: number;
+}
+
+export interface Sample {
+  labels: Record<string, string>;
+  value: number;
+  count?: number;
+  buckets?: Bucket[];
+}
+
+export interface Family {
+  name: string;
+  help: string;
+  kind: string;
+  samples: Sample[];
+}
+
+export interface Routes {
+  "/file/index": { request: IndexFileRequest; response: PaginatedResourceFileDTO };
+  "/file/unindex": { request: UnindexFileRequest; response: PaginatedResourceFileDTO };
+  "/file/rename": { request: RenameFileRequest; response: FileDTO };
+  "/file/tag": { request: TagFileRequest; response: TagFileResponse };
+  "/file/untag": { request: UntagFileRequest; response: TagFileResponse };
+  "/file/meta/set/author": { request: SetAuthorRequest; response: FileDTO };
+  "/file/meta/unset/author": { request: UnsetMetaRequest; response: FileDTO };
+  "/file/meta/set/description": { request: SetDescriptionRequest; response: FileDTO };
+  "/file/meta/unset/description": { request: UnsetMetaRequest; response: FileDTO };
+  "/file/meta/set": { request: SetFieldRequest; response: FileDTO };
+  "/file/meta/unset": { request: UnsetFieldRequest; response: FileDTO };
+  "/file/details": { request: FileDetailsRequest; response: FileDTO };
+  "/tag/create": { request: CreateTagRequest; response: TagDTO };
+  "/tag/delete": { request: DeleteTagRequest; response: TagDTO };
+  "/tag/alias": { request: AliasTagRequest; response: MessageResponse };
+  "/tag/unalias": { request: UnaliasTagRequest; response: MessageResponse };
+  "/tag/parent": { request: ParentTagRequest; response: TagDTO };
+  "/tag/list": { request: ListTagRequest; response: PaginatedResourceTagDTO };
+  "/tag/ancestors": { request: TagTreeRequest; response: PaginatedResourceTagDTO };
+  "/tag/descendants": { request: TagTreeRequest; response: PaginatedResourceTagDTO };
+  "/tag/search": { request: SearchTagRequest; response: PaginatedResourceTagDTO };
+  "/field/create": { request: CreateFieldRequest; response: FieldDTO };
+  "/field/delete": { request: DeleteFieldRequest; response: FieldDTO };
+  "/field/list": { request: EmptyRequest; response: FieldDTO[] };
+  "/jobs/start": { request: StartJobRequest; response: JobDTO };
+  "/jobs/status": { request: JobRequest; response: JobDTO };
+  "/jobs/cancel": { request: JobRequest; response: JobDTO };
+  "/jobs/list": { request: ListJobRequest; response: JobDTO[] };
+  "/history/undo": { request: EmptyRequest; response: OperationDTO };
+  "/history/redo": { request: EmptyRequest; response: OperationDTO };
+  "/history/list": { request: ListHistoryRequest; response: OperationDTO[] };
+  "/_meta/metrics": { request: EmptyRequest; response: Family[] };
+}
+
+export interface StreamRoutes {
+  "/file/list": { request: ListFileRequest; item: FileDTO };
+  "/file/search": { request: SearchFileRequest; item: FileDTO };
+  "/file/export": { request: EmptyRequest; item: FileDTO };
+}
+
+export interface FieldError {
+  field: string;
+  code: string;
+  message: string;
+}
+
+export interface ErrorDetails {
+  status: number;
+  code: string;
+  error: string;
+  fields?: FieldError[];
+}
+
+export class P2PJSONError extends Error {
+  status: number;
+  code: string;
+  fields: FieldError[];
+
+  constructor(details: ErrorDetails) {
+    super(details.error);
+    this.status = details.status;
+    this.code = details.code;
+    this.fields = details.fields ?? [];
+  }
+}
+
+export interface Transport {
+  write(data: Uint8Array): void;
+  onData(listener: (chunk: Uint8Array) => void): void;
+}
+
+export interface Frame {
+  type: string;
+  startLine: string;
+  headers: Record<string, string>;
+  body: Uint8Array;
+}
+
+const encoder = new TextEncoder();
+const decoder = new TextDecoder();
+const CRLF = encoder.encode("\r\n");
+
+function indexOf(buffer: Uint8Array, needle: Uint8Array, from: number): number {
+  outer: for (let i = from; i <= buffer.length - needle.length; i++) {
+    for (let j = 0; j < needle.length; j++) {
+      if (buffer[i + j] !== needle[j]) continue outer;
+    }
+    return i;
+  }
+  return -1;
+}
+
+export function encodeFrame(type: string, startLine: string, headers: Record<string, string>, body: Uint8Array): Uint8Array {
+  let head = type + "\r\n" + startLine + "\r\n";
+  for (const [key, value] of Object.entries({ ...headers, "Content-Length": String(body.length) })) {
+    head += key + ": " + value + "\r\n";
+  }
+  head += "\r\n";
+
+  const encoded = encoder.encode(head);
+  const frame = new Uint8Array(encoded.length + body.length);
+  frame.set(encoded, 0);
+  frame.set(body, encoded.length);
+  return frame;
+}
+
+export class FrameDecoder {
+  private buffer = new Uint8Array(0);
+
+  push(chunk: Uint8Array): Frame[] {
+    const next = new Uint8Array(this.buffer.length + chunk.length);
+    next.set(this.buffer, 0);
+    next.set(chunk, this.buffer.length);
+    this.buffer = next;
+
+    const frames: Frame[] = [];
+    for (let frame = this.next(); frame !== null; frame = this.next()) {
+      frames.push(frame);
+    }
+    return frames;
+  }
+
+  private next(): Frame | null {
+    const typeEnd = indexOf(this.buffer, CRLF, 0);
+    if (typeEnd < 0) return null;
+
+    const type = decoder.decode(this.buffer.subarray(0, typeEnd));
+    if (type === "EXIT") {
+      this.buffer = this.buffer.slice(typeEnd + 2);
+      return { type, startLine: "", headers: {}, body: new Uint8Array(0) };
+    }
+
+    const headEnd = indexOf(this.buffer, encoder.encode("\r\n\r\n"), typeEnd + 2);
+    if (headEnd < 0) return null;
+
+    const lines = decoder.decode(this.buffer.subarray(typeEnd + 2, headEnd)).split("\r\n");
+    const headers: Record<string, string> = {};
+    for (const line of lines.slice(1)) {
+      const colon = line.indexOf(":");
+      if (colon < 0) continue;
+      headers[line.slice(0, colon).trim().toLowerCase()] = line.slice(colon + 1).trim();
+    }
+
+    const length = Number(headers["content-length"] ?? 0);
+    const bodyStart = headEnd + 4;
+    if (this.buffer.length < bodyStart + length) return null;
+
+    const body = this.buffer.slice(bodyStart, bodyStart + length);
+    this.buffer = this.buffer.slice(bodyStart + length);
+    return { type, startLine: lines[0], headers, body };
+  }
+}
+
+function decodeBody<T>(frame: Frame): T {
+  return JSON.parse(decoder.decode(frame.body)) as T;
+}
+
+interface Pending {
+  resolve: (frame: Frame) => void;
+  reject: (err: Error) => void;
+  onPartial?: (frame: Frame) => void;
+}
+
+export class Client {
+  private nextId = 1;
+  private pending = new Map<number, Pending>();
+  private decoder = new FrameDecoder();
+
+  constructor(private transport: Transport, private defaultHost = "tstud") {
+    transport.onData((chunk) => {
+      for (const frame of this.decoder.push(chunk)) {
+        this.receive(frame);
+      }
+    });
+  }
+
+  private receive(frame: Frame) {
+    if (frame.type !== "RESPONSE") return;
+
+    const id = Number(frame.headers["identifier"]);
+    const pending = this.pending.get(id);
+    if (pending === undefined) return;
+
+    const status = Number(frame.startLine.split(" ")[1]);
+    if (status === 206) {
+      pending.onPartial?.(frame);
+      return;
+    }
+
+    this.pending.delete(id);
+    if (status >= 400) {
+      pending.reject(new P2PJSONError(decodeBody<ErrorDetails>(frame)));
+    } else {
+      pending.resolve(frame);
+    }
+  }
+
+  private send(path: string, body: unknown, host?: string, onPartial?: (frame: Frame) => void): Promise<Frame> {
+    const id = this.nextId++;
+    const url = "p2pjson://" + (host ?? this.defaultHost) + path;
+    const payload = encoder.encode(JSON.stringify(body ?? {}));
+
+    return new Promise((resolve, reject) => {
+      this.pending.set(id, { resolve, reject, onPartial });
+      this.transport.write(
+        encodeFrame("REQUEST", url + " P2PJSON/0.1", { Identifier: String(id), "Content-Type": "application/json" }, payload),
+      );
+    });
+  }
+
+  async call<P extends keyof Routes>(path: P, body: Routes[P]["request"], host?: string): Promise<Routes[P]["response"]> {
+    const frame = await this.send(path, body, host);
+    return decodeBody<Routes[P]["response"]>(frame);
+  }
+
+  async *stream<P extends keyof StreamRoutes>(
+    path: P,
+    body: StreamRoutes[P]["request"],
+    host?: string,
+  ): AsyncGenerator<StreamRoutes[P]["item"]> {
+    const items: StreamRoutes[P]["item"][] = [];
+    let done = false;
+    let failure: Error | null = null;
+    let wake: (() => void) | null = null;
+
+    this.send(path, body, host, (frame) => {
+      items.push(decodeBody<StreamRoutes[P]["item"]>(frame));
+      wake?.();
+    }).then(
+      () => {
+        done = true;
+        wake?.();
+      },
+      (err: Error) => {
+        failure = err;
+        done = true;
+        wake?.();
+      },
+    );
+
+    while (true) {
+      const item = items.shift();
+      if (item !== undefined) {
+        yield item;
+        continue;
+      }
+      if (failure !== null) throw failure;
+      if (done) return;
+
+      await new Promise<void>((resolve) => {
+        wake = resolve;
+      });
+      wake = null;
+    }
+  }
+
+  exit() {
+    this.transport.write(encoder.encode("EXIT\r\n"));
+  }
+
+  fileIndex(body: IndexFileRequest, host?: string): Promise<PaginatedResourceFileDTO> {
+    return this.call("/file/index", body, host);
+  }
+
+  fileUnindex(body: UnindexFileRequest, host?: string): Promise<PaginatedResourceFileDTO> {
+    return this.call("/file/unindex", body, host);
+  }
+
+  fileRename(body: RenameFileRequest, host?: string): Promise<FileDTO> {
+    return this.call("/file/rename", body, host);
+  }
+
+  fileTag(body: TagFileRequest, host?: string): Promise<TagFileResponse> {
+    return this.call("/file/tag", body, host);
+  }
+
+  fileUntag(body: UntagFileRequest, host?: string): Promise<TagFileResponse> {
+    return this.call("/file/untag", body, host);
+  }
+
+  fileMetaSetAuthor(body: SetAuthorRequest, host?: string): Promise<FileDTO> {
+    return this.call("/file/meta/set/author", body, host);
+  }
+
+  fileMetaUnsetAuthor(body: UnsetMetaRequest, host?: string): Promise<FileDTO> {
+    return this.call("/file/meta/unset/author", body, host);
+  }
+
+  fileMetaSetDescription(body: SetDescriptionRequest, host?: string): Promise<FileDTO> {
+    return this.call("/file/meta/set/description", body, host);
+  }
+
+  fileMetaUnsetDescription(body: UnsetMetaRequest, host?: string): Promise<FileDTO> {
+    return this.call("/file/meta/unset/description", body, host);
+  }
+
+  fileMetaSet(body: SetFieldRequest, host?: string): Promise<FileDTO> {
+    return this.call("/file/meta/set", body, host);
+  }
+
+  fileMetaUnset(body: UnsetFieldRequest, host?: string): Promise<FileDTO> {
+    return this.call("/file/meta/unset", body, host);
+  }
+
+  fileList(body: ListFileRequest, host?: string): AsyncIterable<FileDTO> {
+    return this.stream("/file/list", body, host);
+  }
+
+  fileSearch(body: SearchFileRequest, host?: string): AsyncIterable<FileDTO> {
+    return this.stream("/file/search", body, host);
+  }
+
+  fileDetails(body: FileDetailsRequest, host?: string): Promise<FileDTO> {
+    return this.call("/file/details", body, host);
+  }
+
+  fileExport(body: EmptyRequest, host?: string): AsyncIterable<FileDTO> {
+    return this.stream("/file/export", body, host);
+  }
+
+  tagCreate(body: CreateTagRequest, host?: string): Promise<TagDTO> {
+    return this.call("/tag/create", body, host);
+  }
+
+  tagDelete(body: DeleteTagRequest, host?: string): Promise<TagDTO> {
+    return this.call("/tag/delete", body, host);
+  }
+
+  tagAlias(body: AliasTagRequest, host?: string): Promise<MessageResponse> {
+    return this.call("/tag/alias", body, host);
+  }
+
+  tagUnalias(body: UnaliasTagRequest, host?: string): Promise<MessageResponse> {
+    return this.call("/tag/unalias", body, host);
+  }
+
+  tagParent(body: ParentTagRequest, host?: string): Promise<TagDTO> {
+    return this.call("/tag/parent", body, host);
+  }
+
+  tagList(body: ListTagRequest, host?: string): Promise<PaginatedResourceTagDTO> {
+    return this.call("/tag/list", body, host);
+  }
+
+  tagAncestors(body: TagTreeRequest, host?: string): Promise<PaginatedResourceTagDTO> {
+    return this.call("/tag/ancestors", body, host);
+  }
+
+  tagDescendants(body: TagTreeRequest, host?: string): Promise<PaginatedResourceTagDTO> {
+    return this.call("/tag/descendants", body, host);
+  }
+
+  tagSearch(body: SearchTagRequest, host?: string): Promise<PaginatedResourceTagDTO> {
+    return this.call("/tag/search", body, host);
+  }
+
+  fieldCreate(body: CreateFieldRequest, host?: string): Promise<FieldDTO> {
+    return this.call("/field/create", body, host);
+  }
+
+  fieldDelete(body: DeleteFieldRequest, host?: string): Promise<FieldDTO> {
+    return this.call("/field/delete", body, host);
+  }
+
+  fieldList(body: EmptyRequest, host?: string): Promise<FieldDTO[]> {
+    return this.call("/field/list", body, host);
+  }
+
+  jobsStart(body: StartJobRequest, host?: string): Promise<JobDTO> {
+    return this.call("/jobs/start", body, host);
+  }
+
+  jobsStatus(body: JobRequest, host?: string): Promise<JobDTO> {
+    return this.call("/jobs/status", body, host);
+  }
+
+  jobsCancel(body: JobRequest, host?: string): Promise<JobDTO> {
+    return this.call("/jobs/cancel", body, host);
+  }
+
+  jobsList(body: ListJobRequest, host?: string): Promise<JobDTO[]> {
+    return this.call("/jobs/list", body, host);
+  }
+
+  historyUndo(body: EmptyRequest, host?: string): Promise<OperationDTO> {
+    return this.call("/history/undo", body, host);
+  }
+
+  historyRedo(body: EmptyRequest, host?: string): Promise<OperationDTO> {
+    return this.call("/history/redo", body, host);
+  }
+
+  historyList(body: ListHistoryRequest, host?: string): Promise<OperationDTO[]> {
+    return this.call("/history/list", body, host);
+  }
+
+  metaMetrics(body: EmptyRequest, host?: string): Promise<Family[]> {
+    return this.call("/_meta/metrics", body, host);
+  }
+}
@@ -0,0 +1,238 @@
+package tsgen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type Route struct {
+	Path     string
+	Request  reflect.Type
+	Response reflect.Type
+	Stream   bool
+}
+
+type generator struct {
+	types    map[string]string
+	order    []string
+	visiting map[reflect.Type]bool
+	// request is set while generating request types, their fields are
+	// optional unless validation requires them.
+	request bool
+}
+
+var timeType = reflect.TypeFor[time.Time]()
+var rawMessageType = reflect.TypeFor[json.RawMessage]()
+
+// Generate writes a typescript module with an interface for every type
+// reachable from routes and a client that speaks the p2pjson framing.
+func Generate(w io.Writer, routes []Route) error {
+	g := &generator{
+		types:    map[string]string{},
+		visiting: map[reflect.Type]bool{},
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	buf.WriteString("// Code generated by tstud gen ts. DO NOT EDIT.\n\n")
+
+	routeTypes := bytes.NewBuffer([]byte{})
+	routeTypes.WriteString("export interface Routes {\n")
+	streamTypes := bytes.NewBuffer([]byte{})
+	streamTypes.WriteString("export interface StreamRoutes {\n")
+
+	methods := bytes.NewBuffer([]byte{})
+	for _, route := range routes {
+		g.request = true
+		req := g.typeOf(route.Request)
+		g.request = false
+		resp := g.typeOf(route.Response)
+		name := methodName(route.Path)
+
+		if route.Stream {
+			fmt.Fprintf(streamTypes, "  %q: { request: %s; item: %s };\n", route.Path, req, resp)
+			fmt.Fprintf(methods, "  %s(body: %s, host?: string): AsyncIterable<%s> {\n    return this.stream(%q, body, host);\n  }\n\n", name, req, resp, route.Path)
+		} else {
+			fmt.Fprintf(routeTypes, "  %q: { request: %s; response: %s };\n", route.Path, req, resp)
+			fmt.Fprintf(methods, "  %s(body: %s, host?: string): Promise<%s> {\n    return this.call(%q, body, host);\n  }\n\n", name, req, resp, route.Path)
+		}
+	}
+	routeTypes.WriteString("}\n\n")
+	streamTypes.WriteString("}\n\n")
+
+	for _, name := range g.order {
+		buf.WriteString(g.types[name])
+		buf.WriteString("\n")
+	}
+	buf.WriteString(routeTypes.String())
+	buf.WriteString(streamTypes.String())
+	buf.WriteString(strings.Replace(runtime, "  // methods\n", strings.TrimSuffix(methods.String(), "\n"), 1))
+
+	_, err := io.Copy(w, buf)
+	return err
+}
+
+func methodName(path string) string {
+	parts := strings.FieldsFunc(path, func(r rune) bool {
+		return r == '/' || r == '_' || r == '-'
+	})
+
+	name := ""
+	for i, part := range parts {
+		if i == 0 {
+			name += part
+			continue
+		}
+		runes := []rune(part)
+		runes[0] = unicode.ToUpper(runes[0])
+		name += string(runes)
+	}
+	return name
+}
+
+func (g *generator) typeOf(t reflect.Type) string {
+	if t == nil {
+		return "null"
+	}
+
+	switch t {
+	case timeType:
+		return "string"
+	case rawMessageType:
+		return "unknown"
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return fmt.Sprintf("%s | null", g.typeOf(t.Elem()))
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "string"
+		}
+		elem := g.typeOf(t.Elem())
+		if strings.Contains(elem, " ") {
+			elem = fmt.Sprintf("(%s)", elem)
+		}
+		return elem + "[]"
+	case reflect.Map:
+		return fmt.Sprintf("Record<string, %s>", g.typeOf(t.Elem()))
+	case reflect.Struct:
+		if len(t.Name()) == 0 {
+			return g.fields(t, "")
+		}
+		g.declare(t)
+		return typeName(t)
+	default:
+		return "unknown"
+	}
+}
+
+// packagePath matches the import path go prefixes type arguments with.
+var packagePath = regexp.MustCompile(`[\w./-]*\.`)
+
+// typeName names the interface of t. Instances of generic types get their
+// type arguments appended, e.g. PaginatedResourceFileDTO for
+// PaginatedResource[db.FileDTO], so each keeps its concrete item type.
+func typeName(t reflect.Type) string {
+	base, args, ok := strings.Cut(t.Name(), "[")
+	if !ok {
+		return base
+	}
+
+	name := base
+	for _, arg := range strings.FieldsFunc(packagePath.ReplaceAllString(args, ""), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	}) {
+		runes := []rune(arg)
+		runes[0] = unicode.ToUpper(runes[0])
+		name += string(runes)
+	}
+	return name
+}
+
+func (g *generator) declare(t reflect.Type) {
+	name := typeName(t)
+	if _, ok := g.types[name]; ok || g.visiting[t] {
+		return
+	}
+
+	g.visiting[t] = true
+	body := g.fields(t, "")
+	delete(g.visiting, t)
+
+	g.types[name] = fmt.Sprintf("export interface %s %s\n", name, body)
+	g.order = append(g.order, name)
+}
+
+func (g *generator) fields(t reflect.Type, indent string) string {
+	lines := g.fieldLines(t)
+	if len(lines) == 0 {
+		return "{}"
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	buf.WriteString("{\n")
+	for _, line := range lines {
+		buf.WriteString(indent + "  " + line + "\n")
+	}
+	buf.WriteString(indent + "}")
+	return buf.String()
+}
+
+func (g *generator) fieldLines(t reflect.Type) []string {
+	lines := []string{}
+
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && len(name) == 0 && field.Type.Kind() == reflect.Struct {
+			lines = append(lines, g.fieldLines(field.Type)...)
+			continue
+		}
+
+		if len(name) == 0 {
+			name = field.Name
+		}
+		rules := field.Tag.Get("validate")
+		optional := ""
+		if slices.Contains(strings.Split(opts, ","), "omitempty") {
+			optional = "?"
+		}
+		if g.request && !slices.Contains(strings.Split(rules, ","), "required") {
+			optional = "?"
+		}
+
+		// Validation rules are checked by the core, document them for
+		// the caller.
+		if len(rules) > 0 {
+			lines = append(lines, fmt.Sprintf("/** %s */", strings.ReplaceAll(rules, ",", ", ")))
+		}
+		lines = append(lines, fmt.Sprintf("%s%s: %s;", name, optional, g.typeOf(field.Type)))
+	}
+
+	return lines
+}
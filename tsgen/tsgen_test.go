@@ -0,0 +1,48 @@
+package tsgen_test
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/CanPacis/tstud-core/proto"
+	"github.com/CanPacis/tstud-core/tsgen"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// TestGenerate compares the client for the protocol routes with
+// testdata/client.ts, run with -update after changing routes on purpose.
+func TestGenerate(t *testing.T) {
+	routes := []tsgen.Route{}
+	for _, route := range proto.Routes {
+		routes = append(routes, tsgen.Route{
+			Path:     route.Path,
+			Request:  route.Request,
+			Response: route.Response,
+			Stream:   route.Stream,
+		})
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	if err := tsgen.Generate(buf, routes); err != nil {
+		t.Fatal(err)
+	}
+
+	golden := filepath.Join("testdata", "client.ts")
+	if *update {
+		if err := os.WriteFile(golden, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("generated client differs from %s, run go test ./tsgen -update to accept the change", golden)
+	}
+}
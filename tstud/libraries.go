@@ -0,0 +1,212 @@
+package tstud
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+)
+
+var (
+	ErrUnknownLibrary = errors.New("unknown library")
+	ErrLibraryExists  = errors.New("library already exists")
+	ErrLibraryName    = errors.New("library names may only contain letters, digits, - and _")
+)
+
+var libraryName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// DataDir is $XDG_DATA_HOME/tstud, falling back to ~/.local/share/tstud.
+func DataDir() (string, error) {
+	if dir := os.Getenv("XDG_DATA_HOME"); len(dir) > 0 {
+		return filepath.Join(dir, "tstud"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share", "tstud"), nil
+}
+
+// Config lists the named libraries and the one used when none is selected.
+// It is stored as libraries.json in the data directory.
+type Config struct {
+	Default   string            `json:"default,omitempty"`
+	Libraries map[string]string `json:"libraries"`
+}
+
+func configPath() (string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "libraries.json"), nil
+}
+
+// LoadConfig reads the library config. A missing file is an empty config.
+func LoadConfig() (*Config, error) {
+	config := &Config{Libraries: map[string]string{}}
+
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, config); err != nil {
+		return nil, fmt.Errorf("could not read %s: %w", path, err)
+	}
+	if config.Libraries == nil {
+		config.Libraries = map[string]string{}
+	}
+	return config, nil
+}
+
+func (c *Config) Save() error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(content, '\n'), 0o644)
+}
+
+// Names returns the library names in order.
+func (c *Config) Names() []string {
+	names := []string{}
+	for name := range c.Libraries {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Path returns the database path of a named library.
+func (c *Config) Path(name string) (string, error) {
+	path, ok := c.Libraries[name]
+	if !ok {
+		return "", fmt.Errorf("%w %q", ErrUnknownLibrary, name)
+	}
+	return path, nil
+}
+
+// Create adds a named library. An empty path places the database in the
+// data directory. The first library created becomes the default.
+func (c *Config) Create(name, path string) (string, error) {
+	if !libraryName.MatchString(name) {
+		return "", ErrLibraryName
+	}
+	if _, ok := c.Libraries[name]; ok {
+		return "", fmt.Errorf("%w %q", ErrLibraryExists, name)
+	}
+
+	if len(path) == 0 {
+		dir, err := DataDir()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(dir, "libraries", name+".db")
+	}
+
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	c.Libraries[name] = path
+	if len(c.Default) == 0 {
+		c.Default = name
+	}
+	return path, nil
+}
+
+// Use makes a named library the default.
+func (c *Config) Use(name string) error {
+	if _, err := c.Path(name); err != nil {
+		return err
+	}
+	c.Default = name
+	return nil
+}
+
+// Remove forgets a named library and returns its database path. The database
+// itself is left in place.
+func (c *Config) Remove(name string) (string, error) {
+	path, err := c.Path(name)
+	if err != nil {
+		return "", err
+	}
+
+	delete(c.Libraries, name)
+	if c.Default == name {
+		c.Default = ""
+	}
+	return path, nil
+}
+
+// ResolvePath picks the database for opts. In order of precedence: the
+// explicit path, the named library, $TSTUD_DB, the default library, ./tstud.db
+// when TSTUD_ENV is development, the legacy ~/tstud.db if it exists and
+// finally tstud.db in the data directory.
+func ResolvePath(opts Options) (string, error) {
+	if len(opts.Path) > 0 {
+		return opts.Path, nil
+	}
+
+	if len(opts.Library) > 0 {
+		config, err := LoadConfig()
+		if err != nil {
+			return "", err
+		}
+		return config.Path(opts.Library)
+	}
+
+	if path := os.Getenv("TSTUD_DB"); len(path) > 0 {
+		return path, nil
+	}
+
+	config, err := LoadConfig()
+	if err != nil {
+		return "", err
+	}
+	if len(config.Default) > 0 {
+		return config.Path(config.Default)
+	}
+
+	if os.Getenv("TSTUD_ENV") == "development" {
+		return filepath.Join("./", "tstud.db"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	legacy := filepath.Join(home, "tstud.db")
+	if _, err := os.Stat(legacy); err == nil {
+		return legacy, nil
+	}
+
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "tstud.db"), nil
+}
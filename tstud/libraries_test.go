@@ -0,0 +1,95 @@
+package tstud
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolvePath(t *testing.T) {
+	type setup struct {
+		env     string // $TSTUD_DB
+		dev     bool   // TSTUD_ENV=development
+		def     bool   // a default library is configured
+		legacy  bool   // ~/tstud.db exists
+		options Options
+	}
+
+	cases := []struct {
+		name  string
+		setup setup
+		// want starts with ~/ for paths in the home directory.
+		want string
+		err  error
+	}{
+		{"explicit path", setup{env: "env.db", dev: true, def: true, legacy: true, options: Options{Path: "/explicit.db", Library: "work"}}, "/explicit.db", nil},
+		{"named library", setup{env: "env.db", dev: true, def: true, legacy: true, options: Options{Library: "work"}}, "~/work.db", nil},
+		{"unknown library", setup{env: "env.db", options: Options{Library: "nope"}}, "", ErrUnknownLibrary},
+		{"environment", setup{env: "/env.db", dev: true, def: true, legacy: true}, "/env.db", nil},
+		{"default library", setup{dev: true, def: true, legacy: true}, "~/home.db", nil},
+		{"development", setup{dev: true, legacy: true}, "tstud.db", nil},
+		{"legacy", setup{legacy: true}, "~/tstud.db", nil},
+		{"data directory", setup{}, "~/.local/share/tstud/tstud.db", nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			home := t.TempDir()
+			t.Setenv("HOME", home)
+			t.Setenv("XDG_DATA_HOME", "")
+			t.Setenv("TSTUD_DB", c.setup.env)
+			t.Setenv("TSTUD_ENV", "")
+			if c.setup.dev {
+				t.Setenv("TSTUD_ENV", "development")
+			}
+
+			config := &Config{Libraries: map[string]string{"work": filepath.Join(home, "work.db")}}
+			if c.setup.def {
+				config.Libraries["home"] = filepath.Join(home, "home.db")
+				config.Default = "home"
+			}
+			if err := config.Save(); err != nil {
+				t.Fatal(err)
+			}
+			if c.setup.legacy {
+				if err := os.WriteFile(filepath.Join(home, "tstud.db"), nil, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			path, err := ResolvePath(c.setup.options)
+			if !errors.Is(err, c.err) {
+				t.Fatalf("got error %v, expected %v", err, c.err)
+			}
+			if c.err != nil {
+				return
+			}
+
+			want := c.want
+			if rest, ok := strings.CutPrefix(want, "~/"); ok {
+				want = filepath.Join(home, rest)
+			}
+			if path != want {
+				t.Errorf("got %s, expected %s", path, want)
+			}
+		})
+	}
+}
+
+func TestResolvePathDataHome(t *testing.T) {
+	data := t.TempDir()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", data)
+	t.Setenv("TSTUD_DB", "")
+	t.Setenv("TSTUD_ENV", "")
+
+	path, err := ResolvePath(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(data, "tstud", "tstud.db"); path != want {
+		t.Errorf("got %s, expected %s", path, want)
+	}
+}
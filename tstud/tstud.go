@@ -0,0 +1,187 @@
+// Package tstud is the embeddable entry point of the core. Open a library
+// against a database and use its controllers directly, or hand it to proto
+// to serve it over p2pjson.
+package tstud
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/CanPacis/tstud-core/controllers"
+	"github.com/CanPacis/tstud-core/db"
+	"github.com/CanPacis/tstud-core/events"
+	"github.com/CanPacis/tstud-core/jobs"
+	"github.com/CanPacis/tstud-core/store"
+	"gorm.io/gorm"
+)
+
+type Options struct {
+	// Path of the sqlite database. See ResolvePath for the default.
+	Path string
+	// Library opens a named library from the config instead of Path.
+	Library string
+	// Memory keeps files and tags in memory, nothing is written to disk and
+	// everything is lost on Close. Jobs still work, history calls return
+	// controllers.ErrHistoryUnavailable.
+	Memory bool
+	// HashLimit is FileController.HashLimit, files above it are indexed
+	// without a content hash.
+	HashLimit int64
+}
+
+type Library struct {
+	DB      *gorm.DB
+	File    *controllers.FileController
+	Tag     *controllers.TagController
+	Field   *controllers.FieldController
+	History *controllers.HistoryController
+	// Events carries the changes made through File and Tag.
+	Events *events.Bus
+	// Jobs is not started by Open, call Jobs.Start in long running
+	// processes that should execute background jobs.
+	Jobs *jobs.Runner
+}
+
+func Open(opts Options) (*Library, error) {
+	if opts.Memory {
+		return openMemory(opts)
+	}
+
+	path, err := ResolvePath(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	dbs, err := db.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	repos := repositories{
+		files:   store.NewGormFiles(dbs),
+		tags:    store.NewGormTags(dbs),
+		fields:  store.NewGormFields(dbs),
+		journal: controllers.NewJournal(dbs),
+		history: dbs,
+	}
+	return newLibrary(opts, dbs, repos), nil
+}
+
+// openMemory backs files, tags and fields with store.Memory. Jobs live in an
+// in-memory sqlite database. There is no journal since history can only be
+// replayed against sqlite, undo and redo return ErrHistoryUnavailable.
+func openMemory(opts Options) (*Library, error) {
+	dbs, err := db.OpenMemory()
+	if err != nil {
+		return nil, err
+	}
+
+	mem := store.NewMemory()
+	return newLibrary(opts, dbs, repositories{files: mem.Files, tags: mem.Tags, fields: mem.Fields}), nil
+}
+
+type repositories struct {
+	files   controllers.FileRepository
+	tags    controllers.TagRepository
+	fields  controllers.FieldRepository
+	journal controllers.Journal
+	// history is where journaled operations are replayed, nil without a
+	// journal.
+	history *gorm.DB
+}
+
+func newLibrary(opts Options, dbs *gorm.DB, repos repositories) *Library {
+	bus := events.NewBus()
+	lib := &Library{
+		DB: dbs,
+		File: &controllers.FileController{
+			Files:     repos.files,
+			Tags:      repos.tags,
+			Fields:    repos.fields,
+			Journal:   repos.journal,
+			HashLimit: opts.HashLimit,
+			Events:    bus,
+		},
+		Tag:     &controllers.TagController{Tags: repos.tags, Journal: repos.journal, Events: bus},
+		Field:   &controllers.FieldController{Fields: repos.fields, Journal: repos.journal, Events: bus},
+		History: &controllers.HistoryController{DB: repos.history, Events: bus},
+		Events:  bus,
+		Jobs:    jobs.NewRunner(dbs),
+	}
+	lib.registerJobs()
+	return lib
+}
+
+type IndexParams struct {
+	Path      string   `json:"path"`
+	Recursive bool     `json:"recursive"`
+	Exclude   []string `json:"exclude"`
+}
+
+type IndexResult struct {
+	Files int `json:"files"`
+}
+
+type RehashParams struct {
+	// All fingerprints every file again instead of only the ones indexed
+	// without a fingerprint.
+	All bool `json:"all"`
+}
+
+func (l *Library) registerJobs() {
+	l.Jobs.Register("index", func(ctx context.Context, raw json.RawMessage, progress func(done, total int)) (any, error) {
+		var params IndexParams
+		if err := json.Unmarshal(raw, &params); err != nil {
+			return nil, err
+		}
+
+		result, err := l.File.IndexContext(ctx, params.Path, params.Recursive, params.Exclude, progress)
+		if err != nil {
+			return nil, err
+		}
+		return IndexResult{Files: len(result.Items)}, nil
+	})
+
+	l.Jobs.Register("unindex", func(ctx context.Context, raw json.RawMessage, progress func(done, total int)) (any, error) {
+		var params IndexParams
+		if err := json.Unmarshal(raw, &params); err != nil {
+			return nil, err
+		}
+
+		result, err := l.File.UnindexContext(ctx, params.Path, params.Recursive, params.Exclude, progress)
+		if err != nil {
+			return nil, err
+		}
+		return IndexResult{Files: len(result.Items)}, nil
+	})
+
+	l.Jobs.Register("rehash", func(ctx context.Context, raw json.RawMessage, progress func(done, total int)) (any, error) {
+		var params RehashParams
+		if len(raw) > 0 {
+			if err := json.Unmarshal(raw, &params); err != nil {
+				return nil, err
+			}
+		}
+
+		updated, err := l.File.Rehash(ctx, params.All, progress)
+		if err != nil {
+			return nil, err
+		}
+		return IndexResult{Files: updated}, nil
+	})
+}
+
+func (l *Library) Close() error {
+	l.Jobs.Stop()
+
+	sqlDB, err := l.DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
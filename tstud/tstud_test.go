@@ -0,0 +1,52 @@
+package tstud
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/CanPacis/tstud-core/controllers"
+)
+
+func TestHistory(t *testing.T) {
+	cases := []struct {
+		name    string
+		options Options
+		err     error
+	}{
+		{"sqlite", Options{Path: filepath.Join(t.TempDir(), "tstud.db")}, nil},
+		{"memory", Options{Memory: true}, controllers.ErrHistoryUnavailable},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			lib, err := Open(c.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer lib.Close()
+
+			if _, err := lib.Tag.Create("music", nil); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := lib.History.Undo(); !errors.Is(err, c.err) {
+				t.Fatalf("undo: got %v, expected %v", err, c.err)
+			}
+			if _, err := lib.History.Redo(); !errors.Is(err, c.err) {
+				t.Fatalf("redo: got %v, expected %v", err, c.err)
+			}
+			if _, err := lib.History.List(10); !errors.Is(err, c.err) {
+				t.Fatalf("list: got %v, expected %v", err, c.err)
+			}
+
+			tags, err := lib.Tag.Search("music", controllers.ListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tags.Items) != 1 {
+				t.Errorf("got %d tags after undo and redo, expected 1", len(tags.Items))
+			}
+		})
+	}
+}